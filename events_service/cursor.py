@@ -0,0 +1,74 @@
+import base64
+import hashlib
+import hmac
+import json
+import os
+from collections import namedtuple
+from datetime import datetime
+
+
+class InvalidCursor(Exception):
+    pass
+
+
+# Position is the keyset of the last row of a page. rank is only set for
+# orderings that sort by something other than the creation time, e.g. likes.
+Position = namedtuple("Position", ["created_at", "id", "rank"], defaults=[None])
+
+
+def _secret():
+    secret = os.getenv("CURSOR_SECRET")
+    if not secret:
+        raise RuntimeError("CURSOR_SECRET is not set")
+    return secret.encode()
+
+
+def check_secret():
+    """Fails at startup instead of on the first paginated request."""
+    _secret()
+
+
+def _b64encode(data: bytes) -> str:
+    return base64.urlsafe_b64encode(data).rstrip(b"=").decode()
+
+
+def _b64decode(data: str) -> bytes:
+    return base64.urlsafe_b64decode(data + "=" * (-len(data) % 4))
+
+
+def _sign(payload: str) -> str:
+    digest = hmac.new(_secret(), payload.encode(), hashlib.sha256).digest()
+    return _b64encode(digest[:16])
+
+
+def encode_cursor(scope: str, created_at: datetime, item_id, rank=None) -> str:
+    """Builds an opaque cursor pointing after the row with the given keyset.
+
+    scope binds the cursor to one listing, e.g. the comments of a single post,
+    so it cannot be replayed against another one.
+    """
+    data = {"s": scope, "t": created_at.isoformat(), "id": str(item_id)}
+    if rank is not None:
+        data["r"] = rank
+    payload = _b64encode(json.dumps(data, separators=(",", ":")).encode())
+    return payload + "." + _sign(payload)
+
+
+def decode_cursor(scope: str, cursor: str):
+    try:
+        payload, signature = cursor.split(".", 1)
+    except ValueError:
+        raise InvalidCursor("malformed cursor")
+    if not hmac.compare_digest(signature, _sign(payload)):
+        raise InvalidCursor("invalid cursor signature")
+
+    try:
+        data = json.loads(_b64decode(payload))
+        created_at = datetime.fromisoformat(data["t"])
+        item_id = data["id"]
+        rank = data.get("r")
+    except (ValueError, KeyError, TypeError, AttributeError):
+        raise InvalidCursor("malformed cursor")
+    if data.get("s") != scope:
+        raise InvalidCursor("cursor belongs to another listing")
+    return Position(created_at, item_id, rank)
@@ -0,0 +1,52 @@
+import json
+import uuid
+from datetime import datetime, timezone
+from pathlib import Path
+
+import jsonschema
+
+PRODUCER = "events_service"
+
+SCHEMA_DIR = Path(__file__).parent / "schemas"
+
+# Copies of gateway/events/schemas, the gateway registry checks that new
+# versions stay compatible.
+_ENVELOPE_SCHEMA = json.loads((SCHEMA_DIR / "envelope.json").read_text())
+
+
+def _load_payload_schemas():
+    schemas = {}
+    for path in SCHEMA_DIR.glob("*.v*.json"):
+        event_type, _, version = path.stem.rpartition(".v")
+        schemas[(event_type, int(version))] = json.loads(path.read_text())
+    return schemas
+
+
+_PAYLOAD_SCHEMAS = _load_payload_schemas()
+
+
+def latest_version(event_type: str) -> int:
+    return max((v for t, v in _PAYLOAD_SCHEMAS if t == event_type), default=0)
+
+
+def build_envelope(event_type: str, payload: dict) -> dict:
+    """Wraps payload into the shared event envelope.
+
+    The payload is validated against the latest schema of event_type, an
+    invalid event raises jsonschema.ValidationError instead of being sent.
+    """
+    version = latest_version(event_type)
+    if version == 0:
+        raise ValueError(f"no schema registered for {event_type}")
+
+    envelope = {
+        "id": str(uuid.uuid4()),
+        "type": event_type,
+        "version": version,
+        "occurred_at": datetime.now(timezone.utc).isoformat().replace("+00:00", "Z"),
+        "producer": PRODUCER,
+        "payload": payload,
+    }
+    jsonschema.validate(envelope, _ENVELOPE_SCHEMA)
+    jsonschema.validate(payload, _PAYLOAD_SCHEMAS[(event_type, version)])
+    return envelope
@@ -5,8 +5,11 @@ CREATE TABLE posts (
     user_id UUID NOT NULL,
     is_private BOOLEAN NOT NULL DEFAULT false,
     tags TEXT[] NOT NULL,
+    like_count INTEGER NOT NULL DEFAULT 0,
     created_at TIMESTAMP WITH TIME ZONE NOT NULL,
-    updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    -- Set while the post is hidden by a moderator.
+    hidden_at TIMESTAMP WITH TIME ZONE
 );
 
 
@@ -17,8 +20,102 @@ CREATE TABLE comments (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     post_id UUID NOT NULL REFERENCES posts(id),
     user_id UUID NOT NULL,
+    parent_id UUID REFERENCES comments(id),
+    -- Top-level comment of the thread, NULL for top-level comments themselves.
+    root_id UUID REFERENCES comments(id),
+    depth INTEGER NOT NULL DEFAULT 0,
     content TEXT NOT NULL,
-    created_at TIMESTAMP WITH TIME ZONE NOT NULL
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    edited_at TIMESTAMP WITH TIME ZONE,
+    deleted_at TIMESTAMP WITH TIME ZONE,
+    hidden_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE TABLE likes (
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (post_id, user_id)
+);
+
+CREATE TABLE post_reactions (
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    reaction TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (post_id, user_id)
+);
+
+CREATE TABLE comment_reactions (
+    comment_id UUID NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    reaction TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (comment_id, user_id)
+);
+
+CREATE TABLE bookmark_collections (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    name TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, name)
+);
+
+CREATE TABLE bookmarks (
+    user_id UUID NOT NULL,
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    -- NULL for bookmarks outside of collections.
+    collection_id UUID REFERENCES bookmark_collections(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, post_id)
+);
+
+-- Decisions are kept after the content they concern is deleted, so the
+-- targets are not foreign keys.
+CREATE TABLE moderation_decisions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    moderator_id UUID NOT NULL,
+    target_type TEXT NOT NULL CHECK (target_type IN ('post', 'comment', 'user')),
+    target_id UUID NOT NULL,
+    -- Author of the content or the reported user.
+    subject_id UUID NOT NULL,
+    action TEXT NOT NULL CHECK (action IN ('hide', 'restore', 'delete', 'dismiss', 'warn', 'suspend')),
+    note TEXT NOT NULL DEFAULT '',
+    -- End of a suspension.
+    expires_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE reports (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    reporter_id UUID NOT NULL,
+    target_type TEXT NOT NULL CHECK (target_type IN ('post', 'comment', 'user')),
+    target_id UUID NOT NULL,
+    reason TEXT NOT NULL,
+    details TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'resolved')),
+    decision_id UUID REFERENCES moderation_decisions(id),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    resolved_at TIMESTAMP WITH TIME ZONE
 );
 
-CREATE INDEX IF NOT EXISTS comments_post_id_idx ON comments(post_id);
\ No newline at end of file
+CREATE INDEX IF NOT EXISTS comments_post_id_idx ON comments(post_id);
+CREATE INDEX IF NOT EXISTS posts_created_at_id_idx ON posts(created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS comments_post_id_created_at_id_idx ON comments(post_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS comments_roots_idx ON comments(post_id, created_at DESC, id DESC) WHERE parent_id IS NULL;
+CREATE INDEX IF NOT EXISTS comments_parent_id_idx ON comments(parent_id);
+CREATE INDEX IF NOT EXISTS comments_root_id_idx ON comments(root_id);
+CREATE INDEX IF NOT EXISTS bookmarks_user_created_at_idx ON bookmarks(user_id, created_at DESC, post_id DESC);
+CREATE INDEX IF NOT EXISTS bookmarks_collection_id_idx ON bookmarks(collection_id);
+CREATE INDEX IF NOT EXISTS posts_like_count_idx ON posts(like_count DESC, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS posts_tags_idx ON posts USING GIN (tags);
+CREATE INDEX IF NOT EXISTS posts_search_idx ON posts USING GIN (
+    (setweight(to_tsvector('simple', title), 'A') || setweight(to_tsvector('simple', description), 'B'))
+);
+-- A reporter has at most one open report per target.
+CREATE UNIQUE INDEX IF NOT EXISTS reports_open_reporter_idx ON reports(reporter_id, target_type, target_id) WHERE status = 'open';
+CREATE INDEX IF NOT EXISTS reports_open_target_idx ON reports(target_type, target_id) WHERE status = 'open';
+CREATE INDEX IF NOT EXISTS moderation_decisions_created_at_idx ON moderation_decisions(created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS moderation_decisions_target_idx ON moderation_decisions(target_type, target_id);
+CREATE INDEX IF NOT EXISTS moderation_decisions_subject_idx ON moderation_decisions(subject_id, action);
@@ -1,15 +1,202 @@
 import asyncpg
-import sys
+import html
+from dataclasses import dataclass, field
+from datetime import datetime
+from typing import List, Optional
+
+# Order and keyset condition for every supported sort. The keyset placeholders
+# are filled with the position of the last row of the previous page.
+_POST_SORTS = {
+    "newest": ("created_at DESC, id DESC", "(created_at, id) < ({}, {}::uuid)"),
+    "oldest": ("created_at ASC, id ASC", "(created_at, id) > ({}, {}::uuid)"),
+    "most_liked": (
+        "like_count DESC, created_at DESC, id DESC",
+        "(like_count, created_at, id) < ({}, {}, {}::uuid)",
+    ),
+}
+
+
+# Must stay identical to the expression of posts_search_idx in init.sql,
+# otherwise the planner will not use the index.
+_SEARCH_VECTOR = (
+    "setweight(to_tsvector('simple', title), 'A') || "
+    "setweight(to_tsvector('simple', description), 'B')"
+)
+
+# ts_headline does not escape the document, so matches are marked with control
+# characters and the snippet is escaped before they are turned into tags.
+_HIGHLIGHT_START, _HIGHLIGHT_STOP = "\x02", "\x03"
+_TITLE_HEADLINE = f"StartSel={_HIGHLIGHT_START}, StopSel={_HIGHLIGHT_STOP}, HighlightAll=true"
+_DESCRIPTION_HEADLINE = (
+    f"StartSel={_HIGHLIGHT_START}, StopSel={_HIGHLIGHT_STOP}, "
+    "MaxWords=30, MinWords=10, MaxFragments=2"
+)
+
+
+# A suspended user can't write, edit, like, react or report until the
+# suspension expires.
+_NOT_SUSPENDED = """NOT EXISTS (
+                SELECT 1 FROM moderation_decisions
+                WHERE subject_id = {user} AND action = 'suspend' AND expires_at > NOW()
+            )"""
+
+# Reactions to posts and comments live in tables of the same shape. The
+# target query selects the id of the target if the user may see it and is
+# not suspended.
+_REACTION_TARGETS = {
+    "post": (
+        "post_reactions",
+        "post_id",
+        "SELECT id FROM posts WHERE id = $1 AND hidden_at IS NULL AND (NOT is_private OR user_id = $2) "
+        f"AND {_NOT_SUSPENDED.format(user='$2::uuid')}",
+    ),
+    "comment": (
+        "comment_reactions",
+        "comment_id",
+        "SELECT comments.id FROM comments JOIN posts ON posts.id = comments.post_id "
+        "WHERE comments.id = $1 AND comments.post_id = {post_id} AND comments.deleted_at IS NULL "
+        "AND comments.hidden_at IS NULL AND posts.hidden_at IS NULL "
+        "AND (NOT posts.is_private OR posts.user_id = $2) "
+        f"AND {_NOT_SUSPENDED.format(user='$2::uuid')}",
+    ),
+}
+
+
+# Reports select the target if the reporter may see it and is not
+# suspended. Users can't be checked here, they live in the users service.
+_REPORTER_NOT_SUSPENDED = _NOT_SUSPENDED.format(user="$1::uuid")
+_REPORT_TARGETS = {
+    "post": (
+        "SELECT id FROM posts WHERE id = $3 AND hidden_at IS NULL AND (NOT is_private OR user_id = $1) "
+        f"AND {_REPORTER_NOT_SUSPENDED}"
+    ),
+    "comment": (
+        "SELECT comments.id FROM comments JOIN posts ON posts.id = comments.post_id "
+        "WHERE comments.id = $3 AND comments.deleted_at IS NULL AND comments.hidden_at IS NULL "
+        "AND posts.hidden_at IS NULL AND (NOT posts.is_private OR posts.user_id = $1) "
+        f"AND {_REPORTER_NOT_SUSPENDED}"
+    ),
+    "user": f"SELECT $3::uuid AS id WHERE {_REPORTER_NOT_SUSPENDED}",
+}
+
+# Moderators see everything, the target query also selects the user a
+# decision concerns.
+_MODERATION_TARGETS = {
+    "post": "SELECT id, user_id AS subject_id FROM posts WHERE id = $3",
+    "comment": "SELECT id, user_id AS subject_id FROM comments WHERE id = $3 AND deleted_at IS NULL",
+    "user": "SELECT $3::uuid AS id, $3::uuid AS subject_id",
+}
+
+# Statements applying a decision to the target, run as CTEs next to the
+# insert of the decision. Decisions without an entry only get recorded.
+_MODERATION_EFFECTS = {
+    ("post", "hide"): ["UPDATE posts SET hidden_at = COALESCE(hidden_at, NOW()) WHERE id = (SELECT id FROM target)"],
+    ("post", "restore"): ["UPDATE posts SET hidden_at = NULL WHERE id = (SELECT id FROM target)"],
+    ("post", "delete"): [
+        "DELETE FROM comments WHERE post_id = (SELECT id FROM target)",
+        "DELETE FROM posts WHERE id = (SELECT id FROM target)",
+    ],
+    ("comment", "hide"): ["UPDATE comments SET hidden_at = COALESCE(hidden_at, NOW()) WHERE id = (SELECT id FROM target)"],
+    ("comment", "restore"): ["UPDATE comments SET hidden_at = NULL WHERE id = (SELECT id FROM target)"],
+    # Same as delete_comment: a comment with replies becomes a tombstone.
+    ("comment", "delete"): [
+        "UPDATE comments SET content = '', deleted_at = NOW() WHERE id = (SELECT id FROM target) "
+        "AND EXISTS (SELECT 1 FROM comments AS replies WHERE replies.parent_id = (SELECT id FROM target))",
+        "DELETE FROM comments WHERE id = (SELECT id FROM target) "
+        "AND NOT EXISTS (SELECT 1 FROM comments AS replies WHERE replies.parent_id = (SELECT id FROM target))",
+    ],
+}
+
+
+def _liked_by_me(table: str, user_param: str) -> str:
+    return (
+        f"EXISTS (SELECT 1 FROM likes WHERE likes.post_id = {table}.id "
+        f"AND likes.user_id = {user_param}) AS liked_by_me"
+    )
+
+
+def _reactions(target: str, id_expr: str, user_param: str) -> str:
+    """Selects the reaction counts as a JSON object and the reaction of the
+    user."""
+    table, column, _ = _REACTION_TARGETS[target]
+    return (
+        f"(SELECT COALESCE(json_object_agg(reaction, count), '{{}}') FROM ("
+        f"SELECT reaction, COUNT(*) AS count FROM {table} WHERE {column} = {id_expr} GROUP BY reaction"
+        f") AS counts) AS reactions, "
+        f"(SELECT reaction FROM {table} WHERE {column} = {id_expr} AND user_id = {user_param}) AS my_reaction"
+    )
+
+
+def _post_columns(table: str, user_param: str) -> str:
+    return (
+        f"{table}.*, {_liked_by_me(table, user_param)}, "
+        f"{_reactions('post', f'{table}.id', user_param)}"
+    )
+
+
+def _comment_columns(table: str, user_param: str) -> str:
+    return f"{table}.*, {_reactions('comment', f'{table}.id', user_param)}"
+
+
+def _visible_comments(post_param: str, user_param: str, roots_only: bool) -> str:
+    """Conditions on comments joined with posts: the visible comments of a
+    post the user may see, as in get_post."""
+    return (
+        f"comments.post_id = {post_param}{' AND comments.parent_id IS NULL' if roots_only else ''} "
+        "AND comments.hidden_at IS NULL AND posts.hidden_at IS NULL "
+        f"AND (NOT posts.is_private OR posts.user_id = {user_param})"
+    )
+
+
+def render_snippet(snippet: str) -> str:
+    return (
+        html.escape(snippet, quote=False)
+        .replace(_HIGHLIGHT_START, "<mark>")
+        .replace(_HIGHLIGHT_STOP, "</mark>")
+    )
+
+
+@dataclass
+class PostFilter:
+    author_id: Optional[str] = None
+    tags: List[str] = field(default_factory=list)
+    match_all_tags: bool = False
+    created_from: Optional[datetime] = None
+    created_to: Optional[datetime] = None
+    sort: str = "newest"
+
+
+def _arg(args, value):
+    args.append(value)
+    return f"${len(args)}"
+
+
+def _post_conditions(user_id, filters, args):
+    # user_id is always bound first, the list queries refer to it as $1.
+    conditions = [f"(NOT is_private OR user_id = {_arg(args, user_id)})", "hidden_at IS NULL"]
+    if filters.author_id:
+        conditions.append(f"user_id = {_arg(args, filters.author_id)}")
+    if filters.tags:
+        op = "@>" if filters.match_all_tags else "&&"
+        conditions.append(f"tags {op} {_arg(args, list(filters.tags))}::text[]")
+    if filters.created_from:
+        conditions.append(f"created_at >= {_arg(args, filters.created_from)}")
+    if filters.created_to:
+        conditions.append(f"created_at < {_arg(args, filters.created_to)}")
+    return " AND ".join(conditions)
+
 
 class PostRepository:
     def __init__(self, pool: asyncpg.Pool):
         self.pool = pool
 
     async def create_post(self, title: str, description: str, user_id: str, is_private: bool, tags: list):
-        query = """
+        """Returns None if the user is suspended."""
+        query = f"""
             INSERT INTO posts 
             (title, description, user_id, is_private, tags, created_at, updated_at)
-            VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+            SELECT $1::text, $2::text, $3::uuid, $4::boolean, $5::text[], NOW(), NOW()
+            WHERE {_NOT_SUSPENDED.format(user="$3::uuid")}
             RETURNING *
         """
         return await self.pool.fetchrow(
@@ -23,6 +210,7 @@ class PostRepository:
         return "DELETE 1" in result
 
     async def update_post(self, post_id: str, user_id: str, fields):
+        """Returns None if the post is not found or the user is suspended."""
         current_post = await self.get_post(post_id, user_id)
         if not current_post:
             return None
@@ -35,11 +223,14 @@ class PostRepository:
         }
         merged_fields.update(fields)
 
-        query = """
-            UPDATE posts 
-            SET title = $1, description = $2, is_private = $3, tags = $4, updated_at = NOW()
-            WHERE id = $5 AND user_id = $6
-            RETURNING *
+        query = f"""
+            WITH updated AS (
+                UPDATE posts 
+                SET title = $1, description = $2, is_private = $3, tags = $4, updated_at = NOW()
+                WHERE id = $5 AND user_id = $6 AND {_NOT_SUSPENDED.format(user="$6::uuid")}
+                RETURNING *
+            )
+            SELECT {_post_columns("updated", "$6")} FROM updated
         """
         
         return await self.pool.fetchrow(
@@ -53,52 +244,462 @@ class PostRepository:
         )
 
     async def get_post(self, post_id: str, user_id: str):
-        query = """
-            SELECT * FROM posts 
-            WHERE id = $1 AND (NOT is_private OR user_id = $2)
+        query = f"""
+            SELECT {_post_columns("posts", "$2")} FROM posts
+            WHERE id = $1 AND hidden_at IS NULL AND (NOT is_private OR user_id = $2)
         """
         return await self.pool.fetchrow(query, post_id, user_id)
 
-    async def list_posts(self, page: int, page_size: int, user_id: str):
+    async def list_posts(self, page: int, page_size: int, user_id: str, filters=None):
+        filters = filters or PostFilter()
         offset = (page - 1) * page_size
-        query = """
-            SELECT * FROM posts 
-            WHERE NOT is_private OR user_id = $3
-            ORDER BY created_at DESC
-            LIMIT $1 OFFSET $2
-        """
-        print("query", file=sys.stderr)
-        posts = await self.pool.fetch(query, 
-            page_size,
-            offset,
-            user_id
+        args = []
+        where = _post_conditions(user_id, filters, args)
+        posts = await self.pool.fetch(
+            f"""
+            SELECT {_post_columns("posts", "$1")} FROM posts
+            WHERE {where}
+            ORDER BY {_POST_SORTS[filters.sort][0]}
+            LIMIT {_arg(args, page_size)} OFFSET {_arg(args, offset)}
+            """,
+            *args
         )
-        total = await self.pool.fetchval("SELECT COUNT(*) FROM posts")
-        print("sended", file=sys.stderr)
+        total = await self._count_posts(user_id, filters)
         return posts, total
-    
-    async def add_comment(self, post_id: str, user_id: str, content: str):
-        query = """
-            INSERT INTO comments (post_id, user_id, content, created_at)
-            VALUES ($1, $2, $3, NOW())
-            RETURNING *
+
+    async def list_posts_after(self, limit: int, user_id: str, after=None, filters=None):
+        filters = filters or PostFilter()
+        order, keyset = _POST_SORTS[filters.sort]
+        args = []
+        conditions = [_post_conditions(user_id, filters, args)]
+        if after:
+            if filters.sort == "most_liked":
+                position = (after.rank or 0, after.created_at, after.id)
+            else:
+                position = (after.created_at, after.id)
+            conditions.append(keyset.format(*[_arg(args, v) for v in position]))
+        posts = await self.pool.fetch(
+            f"""
+            SELECT {_post_columns("posts", "$1")} FROM posts
+            WHERE {" AND ".join(conditions)}
+            ORDER BY {order}
+            LIMIT {_arg(args, limit)}
+            """,
+            *args
+        )
+        total = await self._count_posts(user_id, filters)
+        return posts, total
+
+    async def _count_posts(self, user_id: str, filters):
+        args = []
+        where = _post_conditions(user_id, filters, args)
+        return await self.pool.fetchval(f"SELECT COUNT(*) FROM posts WHERE {where}", *args)
+
+    async def like_post(self, post_id: str, user_id: str):
+        """Adds the like of user_id unless it exists. Returns the new like
+        count and whether anything changed, or None if the post is not
+        visible to the user or the user is suspended."""
+        query = f"""
+            WITH post AS (
+                SELECT id FROM posts WHERE id = $1 AND hidden_at IS NULL AND (NOT is_private OR user_id = $2)
+                  AND {_NOT_SUSPENDED.format(user="$2::uuid")}
+            ), inserted AS (
+                INSERT INTO likes (post_id, user_id)
+                SELECT id, $2 FROM post
+                ON CONFLICT DO NOTHING
+                RETURNING post_id
+            )
+            UPDATE posts SET like_count = like_count + (SELECT COUNT(*) FROM inserted)
+            WHERE id = (SELECT id FROM post)
+            RETURNING like_count, EXISTS (SELECT 1 FROM inserted) AS changed
+        """
+        return await self.pool.fetchrow(query, post_id, user_id)
+
+    async def unlike_post(self, post_id: str, user_id: str):
+        """Removes the like of user_id if it exists, the result is the same
+        as for like_post."""
+        query = f"""
+            WITH post AS (
+                SELECT id FROM posts WHERE id = $1 AND hidden_at IS NULL AND (NOT is_private OR user_id = $2)
+                  AND {_NOT_SUSPENDED.format(user="$2::uuid")}
+            ), deleted AS (
+                DELETE FROM likes
+                WHERE post_id = (SELECT id FROM post) AND user_id = $2
+                RETURNING post_id
+            )
+            UPDATE posts SET like_count = like_count - (SELECT COUNT(*) FROM deleted)
+            WHERE id = (SELECT id FROM post)
+            RETURNING like_count, EXISTS (SELECT 1 FROM deleted) AS changed
         """
-        return await self.pool.fetchrow(query, post_id, user_id, content)
+        return await self.pool.fetchrow(query, post_id, user_id)
+
+    async def set_reaction(self, target: str, target_id: str, user_id: str, reaction: str, post_id: str = None):
+        """Sets or switches the reaction of user_id to a post or a comment of
+        post_id. Returns found, false if the target is not visible to the
+        user or the user is suspended, and the previous reaction."""
+        table, column, visible = _REACTION_TARGETS[target]
+        args = [target_id, user_id, reaction]
+        visible = visible.format(post_id=_arg(args, post_id) if target == "comment" else None)
+        query = f"""
+            WITH target AS ({visible}),
+            previous AS (
+                SELECT reaction FROM {table} WHERE {column} = (SELECT id FROM target) AND user_id = $2
+            ), upserted AS (
+                INSERT INTO {table} ({column}, user_id, reaction)
+                SELECT id, $2, $3 FROM target
+                ON CONFLICT ({column}, user_id) DO UPDATE SET reaction = EXCLUDED.reaction, created_at = NOW()
+                RETURNING reaction
+            )
+            SELECT EXISTS (SELECT 1 FROM upserted) AS found, (SELECT reaction FROM previous) AS previous
+        """
+        return await self.pool.fetchrow(query, *args)
+
+    async def remove_reaction(self, target: str, target_id: str, user_id: str, post_id: str = None):
+        """Removes the reaction of user_id, the result is the same as for
+        set_reaction."""
+        table, column, visible = _REACTION_TARGETS[target]
+        args = [target_id, user_id]
+        visible = visible.format(post_id=_arg(args, post_id) if target == "comment" else None)
+        query = f"""
+            WITH target AS ({visible}),
+            deleted AS (
+                DELETE FROM {table} WHERE {column} = (SELECT id FROM target) AND user_id = $2
+                RETURNING reaction
+            )
+            SELECT EXISTS (SELECT 1 FROM target) AS found, (SELECT reaction FROM deleted) AS previous
+        """
+        return await self.pool.fetchrow(query, *args)
+
+    async def get_reactions(self, target: str, target_id: str, user_id: str):
+        return await self.pool.fetchrow(f"SELECT {_reactions(target, '$1::uuid', '$2')}", target_id, user_id)
+
+    async def search_posts(self, query: str, user_id: str, page: int, page_size: int, tags=None):
+        args = [query, user_id]
+        conditions = [f"({_SEARCH_VECTOR}) @@ q", "(NOT is_private OR user_id = $2)", "hidden_at IS NULL"]
+        if tags:
+            conditions.append(f"tags @> {_arg(args, list(tags))}::text[]")
+        where = " AND ".join(conditions)
+        filter_args = list(args)
 
-    async def get_comments(self, post_id: str, page: int, page_size: int):
         offset = (page - 1) * page_size
+        hits = await self.pool.fetch(
+            f"""
+            SELECT {_post_columns("posts", "$2")},
+                   ts_rank_cd({_SEARCH_VECTOR}, q) AS rank,
+                   ts_headline('simple', title, q, {_arg(args, _TITLE_HEADLINE)}) AS title_snippet,
+                   ts_headline('simple', description, q, {_arg(args, _DESCRIPTION_HEADLINE)}) AS description_snippet
+            FROM posts, websearch_to_tsquery('simple', $1) AS q
+            WHERE {where}
+            ORDER BY rank DESC, created_at DESC, id DESC
+            LIMIT {_arg(args, page_size)} OFFSET {_arg(args, offset)}
+            """,
+            *args
+        )
+        total = await self.pool.fetchval(
+            f"""
+            SELECT COUNT(*)
+            FROM posts, websearch_to_tsquery('simple', $1) AS q
+            WHERE {where}
+            """,
+            *filter_args
+        )
+        facets = await self.pool.fetch(
+            f"""
+            SELECT tag, COUNT(*) AS count
+            FROM posts, websearch_to_tsquery('simple', $1) AS q, unnest(tags) AS tag
+            WHERE {where}
+            GROUP BY tag
+            ORDER BY count DESC, tag
+            LIMIT 20
+            """,
+            *filter_args
+        )
+
+        hits = [
+            dict(
+                hit,
+                title_snippet=render_snippet(hit["title_snippet"]),
+                description_snippet=render_snippet(hit["description_snippet"])
+            )
+            for hit in hits
+        ]
+        return hits, total, facets
+
+    async def add_comment(self, post_id: str, user_id: str, content: str, parent=None):
+        """parent is the row of the comment being replied to, as returned by
+        get_comment. Returns None if the post is not visible to the user or
+        the user is suspended."""
+        parent_id = root_id = None
+        depth = 0
+        if parent:
+            parent_id = parent["id"]
+            root_id = parent["root_id"] or parent["id"]
+            depth = parent["depth"] + 1
+        query = f"""
+            INSERT INTO comments (post_id, user_id, content, parent_id, root_id, depth, created_at)
+            SELECT id, $2::uuid, $3::text, $4::uuid, $5::uuid, $6::integer, NOW() FROM posts
+            WHERE id = $1::uuid AND hidden_at IS NULL AND (NOT is_private OR user_id = $2::uuid)
+              AND {_NOT_SUSPENDED.format(user="$2::uuid")}
+            RETURNING *
+        """
+        return await self.pool.fetchrow(query, post_id, user_id, content, parent_id, root_id, depth)
+
+    async def get_comment(self, post_id: str, comment_id: str):
+        return await self.pool.fetchrow(
+            "SELECT * FROM comments WHERE id = $1 AND post_id = $2", comment_id, post_id
+        )
+
+    async def update_comment(self, post_id: str, comment_id: str, user_id: str, content: str):
+        """Returns None if the comment is not found or the user is suspended."""
+        query = f"""
+            WITH updated AS (
+                UPDATE comments SET content = $4, edited_at = NOW()
+                WHERE id = $1 AND post_id = $2 AND user_id = $3 AND deleted_at IS NULL
+                  AND {_NOT_SUSPENDED.format(user="$3::uuid")}
+                RETURNING *
+            )
+            SELECT {_comment_columns("updated", "$3")} FROM updated
+        """
+        return await self.pool.fetchrow(query, comment_id, post_id, user_id, content)
+
+    async def delete_comment(self, post_id: str, comment_id: str, user_id: str):
+        """Deletes a comment of user_id or on a post of user_id. A comment
+        with replies is turned into a tombstone so the thread stays intact.
+        Returns "deleted", "tombstoned" or None if there was nothing to
+        delete."""
         query = """
-            SELECT * FROM comments
-            WHERE post_id = $1
-            ORDER BY created_at DESC
+            WITH target AS (
+                SELECT comments.id,
+                       EXISTS (SELECT 1 FROM comments AS replies WHERE replies.parent_id = comments.id) AS has_replies
+                FROM comments JOIN posts ON posts.id = comments.post_id
+                WHERE comments.id = $1 AND comments.post_id = $2 AND comments.deleted_at IS NULL
+                  AND (comments.user_id = $3 OR posts.user_id = $3)
+                FOR UPDATE OF comments
+            ), tombstoned AS (
+                UPDATE comments SET content = '', deleted_at = NOW()
+                WHERE id IN (SELECT id FROM target WHERE has_replies)
+                RETURNING id
+            ), deleted AS (
+                DELETE FROM comments
+                WHERE id IN (SELECT id FROM target WHERE NOT has_replies)
+                RETURNING id
+            )
+            SELECT CASE
+                WHEN EXISTS (SELECT 1 FROM deleted) THEN 'deleted'
+                WHEN EXISTS (SELECT 1 FROM tombstoned) THEN 'tombstoned'
+            END
+        """
+        return await self.pool.fetchval(query, comment_id, post_id, user_id)
+
+    async def get_comments(self, post_id: str, page: int, page_size: int, user_id: str, roots_only: bool = False):
+        offset = (page - 1) * page_size
+        query = f"""
+            SELECT {_comment_columns("comments", "$4")} FROM comments
+            JOIN posts ON posts.id = comments.post_id
+            WHERE {_visible_comments("$1", "$4", roots_only)}
+            ORDER BY comments.created_at DESC
             LIMIT $2 OFFSET $3
         """
-        return await self.pool.fetch(query, post_id, page_size, offset)
+        return await self.pool.fetch(query, post_id, page_size, offset, user_id)
 
-    async def get_total_comments(self, post_id: str):
+    async def get_comments_after(self, post_id: str, limit: int, user_id: str, after=None, roots_only: bool = False):
+        created_at, comment_id = (after.created_at, after.id) if after else (None, None)
+        query = f"""
+            SELECT {_comment_columns("comments", "$5")} FROM comments
+            JOIN posts ON posts.id = comments.post_id
+            WHERE {_visible_comments("$1", "$5", roots_only)}
+              AND ($2::timestamptz IS NULL OR (comments.created_at, comments.id) < ($2, $3::uuid))
+            ORDER BY comments.created_at DESC, comments.id DESC
+            LIMIT $4
+        """
+        return await self.pool.fetch(query, post_id, created_at, comment_id, limit, user_id)
+
+    async def get_replies(self, root_ids, user_id: str):
+        """Returns every visible reply in the threads of root_ids, oldest
+        first. Replies to hidden comments are returned too, the layout drops
+        them with their parent."""
+        query = f"""
+            SELECT {_comment_columns("comments", "$2")} FROM comments
+            WHERE root_id = ANY($1::uuid[]) AND hidden_at IS NULL
+            ORDER BY created_at ASC, id ASC
+        """
+        return await self.pool.fetch(query, list(root_ids), user_id)
+
+    async def get_total_comments(self, post_id: str, user_id: str, roots_only: bool = False):
         return await self.pool.fetchval(
-            "SELECT COUNT(*) FROM comments WHERE post_id = $1", post_id
+            "SELECT COUNT(*) FROM comments JOIN posts ON posts.id = comments.post_id "
+            f"WHERE {_visible_comments('$1', '$2', roots_only)}",
+            post_id, user_id
+        )
+
+    async def bookmark_post(self, post_id: str, user_id: str, collection_id: str = None):
+        """Bookmarks a post visible to user_id, or moves the bookmark to
+        collection_id. Nothing is written unless both the post and the
+        collection of the user are found."""
+        query = """
+            WITH post AS (
+                SELECT id FROM posts WHERE id = $1 AND hidden_at IS NULL AND (NOT is_private OR user_id = $2)
+            ), collection AS (
+                SELECT id FROM bookmark_collections WHERE id = $3::uuid AND user_id = $2
+            ), upserted AS (
+                INSERT INTO bookmarks (user_id, post_id, collection_id)
+                SELECT $2, id, (SELECT id FROM collection) FROM post
+                WHERE $3::uuid IS NULL OR EXISTS (SELECT 1 FROM collection)
+                ON CONFLICT (user_id, post_id) DO UPDATE SET collection_id = EXCLUDED.collection_id
+                RETURNING collection_id
+            )
+            SELECT EXISTS (SELECT 1 FROM post) AS post_found,
+                   $3::uuid IS NULL OR EXISTS (SELECT 1 FROM collection) AS collection_found,
+                   (SELECT collection_id FROM upserted) AS collection_id
+        """
+        return await self.pool.fetchrow(query, post_id, user_id, collection_id)
+
+    async def remove_bookmark(self, post_id: str, user_id: str):
+        result = await self.pool.execute(
+            "DELETE FROM bookmarks WHERE post_id = $1 AND user_id = $2", post_id, user_id
         )
+        return "DELETE 1" in result
+
+    async def list_bookmarks(self, user_id: str, limit: int, after=None, collection_id: str = None):
+        """Returns the bookmarked posts newest bookmark first. Bookmarks of
+        posts that became private are skipped rather than removed, they come
+        back if the post is made public again."""
+        created_at, post_id = (after.created_at, after.id) if after else (None, None)
+        query = f"""
+            SELECT {_post_columns("posts", "$1")},
+                   bookmarks.collection_id, bookmarks.created_at AS bookmarked_at
+            FROM bookmarks JOIN posts ON posts.id = bookmarks.post_id
+            WHERE bookmarks.user_id = $1 AND posts.hidden_at IS NULL AND (NOT posts.is_private OR posts.user_id = $1)
+              AND ($2::uuid IS NULL OR bookmarks.collection_id = $2)
+              AND ($3::timestamptz IS NULL OR (bookmarks.created_at, bookmarks.post_id) < ($3, $4::uuid))
+            ORDER BY bookmarks.created_at DESC, bookmarks.post_id DESC
+            LIMIT $5
+        """
+        return await self.pool.fetch(query, user_id, collection_id, created_at, post_id, limit)
+
+    async def create_bookmark_collection(self, user_id: str, name: str):
+        """Returns None if the user already has a collection with the name."""
+        query = """
+            INSERT INTO bookmark_collections (user_id, name) VALUES ($1, $2)
+            ON CONFLICT (user_id, name) DO NOTHING
+            RETURNING *, 0 AS bookmark_count
+        """
+        return await self.pool.fetchrow(query, user_id, name)
+
+    async def list_bookmark_collections(self, user_id: str):
+        query = """
+            SELECT bookmark_collections.*, (
+                SELECT COUNT(*) FROM bookmarks JOIN posts ON posts.id = bookmarks.post_id
+                WHERE bookmarks.collection_id = bookmark_collections.id AND posts.hidden_at IS NULL
+                  AND (NOT posts.is_private OR posts.user_id = $1)
+            ) AS bookmark_count
+            FROM bookmark_collections
+            WHERE user_id = $1
+            ORDER BY created_at, id
+        """
+        return await self.pool.fetch(query, user_id)
+
+    async def delete_bookmark_collection(self, collection_id: str, user_id: str):
+        result = await self.pool.execute(
+            "DELETE FROM bookmark_collections WHERE id = $1 AND user_id = $2", collection_id, user_id
+        )
+        return "DELETE 1" in result
+
+    async def is_suspended(self, user_id: str) -> bool:
+        return not await self.pool.fetchval(f"SELECT {_NOT_SUSPENDED.format(user='$1::uuid')}", user_id)
+
+    async def create_report(self, reporter_id: str, target_type: str, target_id: str, reason: str, details: str):
+        """Opens a report unless the reporter already has an open report on
+        the target, which is returned instead with created false. Returns
+        None if the target is not visible to the reporter or the reporter is
+        suspended."""
+        query = f"""
+            WITH target AS ({_REPORT_TARGETS[target_type]}),
+            inserted AS (
+                INSERT INTO reports (reporter_id, target_type, target_id, reason, details)
+                SELECT $1::uuid, $2::text, id, $4::text, $5::text FROM target
+                ON CONFLICT (reporter_id, target_type, target_id) WHERE status = 'open' DO NOTHING
+                RETURNING *
+            )
+            SELECT *, true AS created FROM inserted
+            UNION ALL
+            SELECT reports.*, false AS created FROM reports
+            WHERE reporter_id = $1 AND target_type = $2 AND target_id = $3 AND status = 'open'
+              AND NOT EXISTS (SELECT 1 FROM inserted)
+        """
+        return await self.pool.fetchrow(query, reporter_id, target_type, target_id, reason, details)
+
+    async def moderate(self, moderator_id: str, target_type: str, target_id: str, action: str,
+                       note: str = "", duration_hours: int = 0):
+        """Applies and records a decision and resolves the open reports on
+        the target in one statement. Returns the decision with the number of
+        resolved reports, or None if the target does not exist."""
+        effects = "".join(
+            f", effect{i} AS ({effect})"
+            for i, effect in enumerate(_MODERATION_EFFECTS.get((target_type, action), []))
+        )
+        query = f"""
+            WITH target AS ({_MODERATION_TARGETS[target_type]}){effects},
+            decision AS (
+                INSERT INTO moderation_decisions (moderator_id, target_type, target_id, subject_id, action, note, expires_at)
+                SELECT $1::uuid, $2::text, id, subject_id, $4::text, $5::text,
+                       CASE WHEN $6::integer > 0 THEN NOW() + make_interval(hours => $6::integer) END
+                FROM target
+                RETURNING *
+            ), resolved AS (
+                UPDATE reports SET status = 'resolved', resolved_at = NOW(), decision_id = (SELECT id FROM decision)
+                WHERE target_type = $2 AND target_id = $3 AND status = 'open' AND EXISTS (SELECT 1 FROM decision)
+                RETURNING id
+            )
+            SELECT decision.*, (SELECT COUNT(*) FROM resolved) AS resolved_reports FROM decision
+        """
+        return await self.pool.fetchrow(query, moderator_id, target_type, target_id, action, note, duration_hours)
+
+    async def list_moderation_queue(self, limit: int, after=None, target_type: str = None):
+        """Returns the targets with open reports, the longest waiting first,
+        with the report counts per reason as a JSON object."""
+        first_reported_at, target_id = (after.created_at, after.id) if after else (None, None)
+        query = """
+            SELECT cases.*,
+                   COALESCE(posts.id, comments.post_id) AS post_id,
+                   COALESCE(posts.user_id, comments.user_id, CASE WHEN cases.target_type = 'user' THEN cases.id END) AS author_id,
+                   COALESCE(posts.title, comments.content, '') AS preview,
+                   COALESCE(posts.hidden_at, comments.hidden_at) IS NOT NULL AS hidden
+            FROM (
+                SELECT target_type, target_id AS id, SUM(count)::integer AS report_count,
+                       json_object_agg(reason, count) AS reasons,
+                       MIN(first_reported_at) AS first_reported_at, MAX(last_reported_at) AS last_reported_at
+                FROM (
+                    SELECT target_type, target_id, reason, COUNT(*) AS count,
+                           MIN(created_at) AS first_reported_at, MAX(created_at) AS last_reported_at
+                    FROM reports
+                    WHERE status = 'open' AND ($1::text IS NULL OR target_type = $1)
+                    GROUP BY target_type, target_id, reason
+                ) AS by_reason
+                GROUP BY target_type, target_id
+            ) AS cases
+            LEFT JOIN posts ON cases.target_type = 'post' AND posts.id = cases.id
+            LEFT JOIN comments ON cases.target_type = 'comment' AND comments.id = cases.id
+            WHERE ($2::timestamptz IS NULL OR (cases.first_reported_at, cases.id) > ($2, $3::uuid))
+            ORDER BY cases.first_reported_at, cases.id
+            LIMIT $4
+        """
+        return await self.pool.fetch(query, target_type, first_reported_at, target_id, limit)
+
+    async def list_moderation_decisions(self, limit: int, after=None, target_type: str = None,
+                                        target_id: str = None, subject_id: str = None):
+        created_at, decision_id = (after.created_at, after.id) if after else (None, None)
+        query = """
+            SELECT * FROM moderation_decisions
+            WHERE ($1::text IS NULL OR target_type = $1)
+              AND ($2::uuid IS NULL OR target_id = $2)
+              AND ($3::uuid IS NULL OR subject_id = $3)
+              AND ($4::timestamptz IS NULL OR (created_at, id) < ($4, $5::uuid))
+            ORDER BY created_at DESC, id DESC
+            LIMIT $6
+        """
+        return await self.pool.fetch(query, target_type, target_id, subject_id, created_at, decision_id, limit)
+
 
 async def create_pool(dsn: str) -> asyncpg.Pool:
     return await asyncpg.create_pool(dsn=dsn)
\ No newline at end of file
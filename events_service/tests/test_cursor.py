@@ -0,0 +1,35 @@
+import datetime
+import pytest
+
+from cursor import InvalidCursor, Position, decode_cursor, encode_cursor
+
+CREATED_AT = datetime.datetime(2024, 5, 1, 12, 30, tzinfo=datetime.timezone.utc)
+
+def test_cursor_round_trip():
+    cursor = encode_cursor("posts", CREATED_AT, "post-1")
+    assert decode_cursor("posts", cursor) == Position(CREATED_AT, "post-1")
+
+def test_cursor_keeps_rank():
+    cursor = encode_cursor("posts:most_liked", CREATED_AT, "post-1", 42)
+    assert decode_cursor("posts:most_liked", cursor).rank == 42
+
+def test_cursor_rejects_tampering():
+    payload, signature = encode_cursor("posts", CREATED_AT, "post-1").split(".")
+    other = encode_cursor("posts", CREATED_AT, "post-2").split(".")[0]
+    with pytest.raises(InvalidCursor):
+        decode_cursor("posts", other + "." + signature)
+
+def test_cursor_is_bound_to_scope():
+    cursor = encode_cursor("comments:p1", CREATED_AT, "c1")
+    with pytest.raises(InvalidCursor):
+        decode_cursor("comments:p2", cursor)
+
+@pytest.mark.parametrize("cursor", ["", "garbage", "a.b.c", "!!!.???"])
+def test_cursor_rejects_garbage(cursor):
+    with pytest.raises(InvalidCursor):
+        decode_cursor("posts", cursor)
+
+def test_cursor_requires_secret(monkeypatch):
+    monkeypatch.delenv("CURSOR_SECRET")
+    with pytest.raises(RuntimeError):
+        encode_cursor("posts", CREATED_AT, "post-1")
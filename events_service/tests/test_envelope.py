@@ -0,0 +1,24 @@
+import jsonschema
+import pytest
+
+from envelope import build_envelope, latest_version
+
+
+def test_build_envelope():
+    event = build_envelope("post.liked", {"user_id": "user1", "post_id": "1"})
+
+    assert event["type"] == "post.liked"
+    assert event["version"] == latest_version("post.liked") == 1
+    assert event["producer"] == "events_service"
+    assert event["occurred_at"].endswith("Z")
+    assert event["id"]
+
+
+def test_build_envelope_rejects_invalid_payload():
+    with pytest.raises(jsonschema.ValidationError):
+        build_envelope("post.commented", {"user_id": "user1", "post_id": "1"})
+
+
+def test_build_envelope_unknown_type():
+    with pytest.raises(ValueError):
+        build_envelope("post.shared", {"post_id": "1"})
@@ -1,10 +1,14 @@
 import datetime
+import json
 import pytest
 from unittest.mock import AsyncMock, MagicMock
 from grpc import StatusCode
 import asyncpg
+from google.rpc import error_details_pb2, status_pb2
 
-from events_server import PostService
+from events_server import PostService, request_id_var
+from cursor import Position, decode_cursor, encode_cursor
+from repository import PostFilter
 from generated import post_pb2
 
 @pytest.fixture
@@ -49,6 +53,8 @@ async def test_create_post_success(post_service, mock_context):
     response = await post_service.CreatePost(request, mock_context)
     assert response.id == "1"
     assert response.title == "Test"
+    assert response.like_count == 0
+    assert response.liked_by_me is False
 
 @pytest.mark.asyncio
 async def test_update_post_success(post_service, mock_context):
@@ -83,12 +89,21 @@ async def test_get_post_success(post_service, mock_context):
         "created_at": datetime.datetime(2023, 10, 1, 0, 0, 0),
         "updated_at": datetime.datetime(2023, 10, 1, 0, 0, 0),
         "is_private": False,
-        "tags": []
+        "tags": [],
+        "like_count": 5,
+        "liked_by_me": True,
+        "reactions": '{"😂": 1, "👍": 3, "🦄": 2}',
+        "my_reaction": "👍"
     }
     post_service.repo.get_post = AsyncMock(return_value=mock_post)
     request = post_pb2.GetPostRequest(post_id="1", user_id="user1")
     response = await post_service.GetPost(request, mock_context)
     assert response.id == "1"
+    assert response.like_count == 5
+    assert response.liked_by_me is True
+    # Configured reactions come first in their order, unknown ones after them.
+    assert [(r.reaction, r.count) for r in response.reactions] == [("👍", 3), ("😂", 1), ("🦄", 2)]
+    assert response.my_reaction == "👍"
 
 @pytest.mark.asyncio
 async def test_list_posts_success(post_service, mock_context):
@@ -140,6 +155,26 @@ async def test_delete_post_failure(post_service, mock_context):
     mock_context.set_code.assert_called_with(StatusCode.NOT_FOUND)
     assert response.success is False
 
+@pytest.mark.asyncio
+async def test_delete_post_error(post_service, mock_context):
+    post_service.repo.delete_post = AsyncMock(side_effect=Exception("DB error"))
+    request = post_pb2.DeletePostRequest(post_id="1", user_id="user1")
+
+    response = await post_service.DeletePost(request, mock_context)
+
+    mock_context.set_code.assert_called_with(StatusCode.INTERNAL)
+    assert response.success is False
+
+@pytest.mark.asyncio
+async def test_get_post_error(post_service, mock_context):
+    post_service.repo.get_post = AsyncMock(side_effect=Exception("DB error"))
+    request = post_pb2.GetPostRequest(post_id="1", user_id="user1")
+
+    response = await post_service.GetPost(request, mock_context)
+
+    mock_context.set_code.assert_called_with(StatusCode.INTERNAL)
+    assert response == post_pb2.PostResponse()
+
 @pytest.mark.asyncio
 async def test_update_post_full_fields(post_service, mock_context):
     mock_post = {
@@ -170,6 +205,7 @@ async def test_update_post_full_fields(post_service, mock_context):
 @pytest.mark.asyncio
 async def test_update_post_not_found(post_service, mock_context):
     post_service.repo.update_post = AsyncMock(return_value=None)
+    post_service.repo.is_suspended = AsyncMock(return_value=False)
     request = post_pb2.UpdatePostRequest(post_id="999", user_id="user1")
     
     response = await post_service.UpdatePost(request, mock_context)
@@ -193,11 +229,11 @@ async def test_list_posts_pagination(post_service, mock_context):
     
     request = post_pb2.ListPostsRequest(page=0, page_size=5, user_id="user1")
     await post_service.ListPosts(request, mock_context)
-    post_service.repo.list_posts.assert_called_with(page=1, page_size=5, user_id="user1")
+    post_service.repo.list_posts.assert_called_with(page=1, page_size=5, user_id="user1", filters=PostFilter())
     
     request = post_pb2.ListPostsRequest(page=2, page_size=150, user_id="user1")
     await post_service.ListPosts(request, mock_context)
-    post_service.repo.list_posts.assert_called_with(page=2, page_size=10, user_id="user1")
+    post_service.repo.list_posts.assert_called_with(page=2, page_size=10, user_id="user1", filters=PostFilter())
 
 @pytest.mark.asyncio
 async def test_list_posts_exception(post_service, mock_context):
@@ -237,18 +273,69 @@ async def test_view_post_success(post_service, mock_context):
         "post_views", "user1", "1"
     )
 
+POST_ID = "6f1c2b9e-7d4a-4b6e-9c1d-2a8f5e6b7c90"
+
 @pytest.mark.asyncio
 async def test_like_post_success(post_service, mock_context):
     post_service._send_kafka_event = AsyncMock()
-    request = post_pb2.LikePostRequest(post_id="1", user_id="user1")
+    post_service.repo.like_post = AsyncMock(return_value={"like_count": 3, "changed": True})
+    request = post_pb2.LikePostRequest(post_id=POST_ID, user_id="user1")
     
     response = await post_service.LikePost(request, mock_context)
     
     assert response.success is True
+    assert response.liked is True
+    assert response.like_count == 3
+    post_service._send_kafka_event.assert_called_with(
+        "post_likes", "user1", POST_ID, event_type="post.liked"
+    )
+    post_service.repo.like_post.assert_called_once_with(POST_ID, "user1")
+
+@pytest.mark.asyncio
+async def test_like_post_twice_sends_no_event(post_service, mock_context):
+    post_service._send_kafka_event = AsyncMock()
+    post_service.repo.like_post = AsyncMock(return_value={"like_count": 3, "changed": False})
+
+    response = await post_service.LikePost(post_pb2.LikePostRequest(post_id=POST_ID, user_id="user1"), mock_context)
+
+    assert response.liked is True
+    assert response.like_count == 3
+    post_service._send_kafka_event.assert_not_called()
+
+@pytest.mark.asyncio
+async def test_unlike_post_sends_compensating_event(post_service, mock_context):
+    post_service._send_kafka_event = AsyncMock()
+    post_service.repo.unlike_post = AsyncMock(return_value={"like_count": 2, "changed": True})
+
+    response = await post_service.UnlikePost(post_pb2.UnlikePostRequest(post_id=POST_ID, user_id="user1"), mock_context)
+
+    assert response.success is True
+    assert response.liked is False
+    assert response.like_count == 2
     post_service._send_kafka_event.assert_called_with(
-        "post_likes", "user1", "1"
+        "post_likes", "user1", POST_ID, event_type="post.unliked"
     )
 
+@pytest.mark.asyncio
+async def test_like_post_not_found(post_service, mock_context):
+    post_service._send_kafka_event = AsyncMock()
+    post_service.repo.like_post = AsyncMock(return_value=None)
+    post_service.repo.is_suspended = AsyncMock(return_value=False)
+
+    await post_service.LikePost(post_pb2.LikePostRequest(post_id=POST_ID, user_id="user1"), mock_context)
+
+    mock_context.set_code.assert_called_with(StatusCode.NOT_FOUND)
+    post_service._send_kafka_event.assert_not_called()
+
+@pytest.mark.asyncio
+async def test_like_post_invalid_id(post_service, mock_context):
+    post_service.repo.like_post = AsyncMock()
+
+    await post_service.LikePost(post_pb2.LikePostRequest(post_id="1", user_id="user1"), mock_context)
+
+    mock_context.set_code.assert_called_with(StatusCode.INVALID_ARGUMENT)
+    post_service.repo.like_post.assert_not_called()
+
 @pytest.mark.asyncio
 async def test_comment_post_success(post_service, mock_context):
     mock_comment = {"id": "c1", "content": "test"}
@@ -289,6 +376,334 @@ async def test_get_comments_success(post_service, mock_context):
     assert len(response.comments) == 2
     assert response.total == 2
 
+@pytest.mark.asyncio
+async def test_get_comments_pagination_defaults(post_service, mock_context):
+    post_service.repo.get_comments = AsyncMock(return_value=[])
+    post_service.repo.get_total_comments = AsyncMock(return_value=0)
+
+    request = post_pb2.GetCommentsRequest(post_id="1", page=0, page_size=500, user_id="user1")
+    await post_service.GetComments(request, mock_context)
+
+    post_service.repo.get_comments.assert_called_with(post_id="1", page=1, page_size=10, user_id="user1", roots_only=False)
+
+COMMENT_ID = "0b7e4c1a-93f2-4d8e-8a5b-6c2d1e0f9a37"
+
+def _comment(id, parent_id=None, depth=0, **fields):
+    return dict({
+        "id": id, "content": "text " + id, "user_id": "user1", "parent_id": parent_id, "depth": depth,
+        "created_at": datetime.datetime(2024, 5, 1), "edited_at": None, "deleted_at": None,
+    }, **fields)
+
+@pytest.mark.asyncio
+async def test_comment_post_reply(post_service, mock_context):
+    parent = _comment(COMMENT_ID, depth=1, root_id="r1")
+    post_service.repo.get_comment = AsyncMock(return_value=parent)
+    post_service.repo.add_comment = AsyncMock(return_value={"id": "c2"})
+    post_service._send_kafka_event = AsyncMock()
+
+    request = post_pb2.CommentPostRequest(post_id="1", user_id="user1", content="reply", parent_id=COMMENT_ID)
+    response = await post_service.CommentPost(request, mock_context)
+
+    assert response.comment_id == "c2"
+    post_service.repo.get_comment.assert_called_once_with("1", COMMENT_ID)
+    assert post_service.repo.add_comment.call_args.kwargs["parent"] is parent
+
+@pytest.mark.asyncio
+@pytest.mark.parametrize("parent", [
+    None,
+    _comment(COMMENT_ID, depth=5),
+    _comment(COMMENT_ID, deleted_at=datetime.datetime(2024, 5, 2)),
+])
+async def test_comment_post_rejects_parent(post_service, mock_context, parent):
+    post_service.repo.get_comment = AsyncMock(return_value=parent)
+    post_service.repo.add_comment = AsyncMock()
+
+    request = post_pb2.CommentPostRequest(post_id="1", user_id="user1", content="reply", parent_id=COMMENT_ID)
+    await post_service.CommentPost(request, mock_context)
+
+    mock_context.set_code.assert_called_with(StatusCode.INVALID_ARGUMENT)
+    post_service.repo.add_comment.assert_not_called()
+
+@pytest.mark.asyncio
+async def test_update_comment(post_service, mock_context):
+    edited = _comment(COMMENT_ID, content="new", edited_at=datetime.datetime(2024, 5, 2))
+    post_service.repo.update_comment = AsyncMock(return_value=edited)
+
+    request = post_pb2.UpdateCommentRequest(post_id=POST_ID, comment_id=COMMENT_ID, user_id="user1", content="new")
+    response = await post_service.UpdateComment(request, mock_context)
+
+    assert response.content == "new"
+    assert response.edited_at == "2024-05-02T00:00:00"
+    post_service.repo.update_comment.assert_called_once_with(
+        post_id=POST_ID, comment_id=COMMENT_ID, user_id="user1", content="new"
+    )
+
+@pytest.mark.asyncio
+async def test_update_comment_not_found(post_service, mock_context):
+    post_service.repo.update_comment = AsyncMock(return_value=None)
+    post_service.repo.is_suspended = AsyncMock(return_value=False)
+
+    request = post_pb2.UpdateCommentRequest(post_id=POST_ID, comment_id=COMMENT_ID, user_id="user2", content="new")
+    await post_service.UpdateComment(request, mock_context)
+
+    mock_context.set_code.assert_called_with(StatusCode.NOT_FOUND)
+
+@pytest.mark.asyncio
+async def test_update_comment_empty_content(post_service, mock_context):
+    post_service.repo.update_comment = AsyncMock()
+
+    request = post_pb2.UpdateCommentRequest(post_id=POST_ID, comment_id=COMMENT_ID, user_id="user1", content=" ")
+    await post_service.UpdateComment(request, mock_context)
+
+    mock_context.set_code.assert_called_with(StatusCode.INVALID_ARGUMENT)
+    post_service.repo.update_comment.assert_not_called()
+
+@pytest.mark.asyncio
+async def test_delete_comment_tombstone(post_service, mock_context):
+    post_service.repo.delete_comment = AsyncMock(return_value="tombstoned")
+
+    request = post_pb2.DeleteCommentRequest(post_id=POST_ID, comment_id=COMMENT_ID, user_id="user1")
+    response = await post_service.DeleteComment(request, mock_context)
+
+    assert response.success is True
+    assert response.tombstoned is True
+
+@pytest.mark.asyncio
+async def test_delete_comment_not_found(post_service, mock_context):
+    post_service.repo.delete_comment = AsyncMock(return_value=None)
+
+    request = post_pb2.DeleteCommentRequest(post_id=POST_ID, comment_id=COMMENT_ID, user_id="user2")
+    response = await post_service.DeleteComment(request, mock_context)
+
+    assert response.success is False
+    mock_context.set_code.assert_called_with(StatusCode.NOT_FOUND)
+
+@pytest.mark.asyncio
+async def test_delete_comment_invalid_id(post_service, mock_context):
+    post_service.repo.delete_comment = AsyncMock()
+
+    request = post_pb2.DeleteCommentRequest(post_id=POST_ID, comment_id="c1", user_id="user1")
+    await post_service.DeleteComment(request, mock_context)
+
+    mock_context.set_code.assert_called_with(StatusCode.INVALID_ARGUMENT)
+    post_service.repo.delete_comment.assert_not_called()
+
+def _thread_rows():
+    roots = [_comment("r1"), _comment("r2")]
+    replies = [
+        _comment("a", parent_id="r1", depth=1),
+        _comment("b", parent_id="a", depth=2, deleted_at=datetime.datetime(2024, 5, 2)),
+        _comment("c", parent_id="b", depth=3),
+        _comment("d", parent_id="r1", depth=1),
+    ]
+    return roots, replies
+
+@pytest.mark.asyncio
+async def test_get_comments_tree(post_service, mock_context):
+    roots, replies = _thread_rows()
+    post_service.repo.get_comments = AsyncMock(return_value=roots)
+    post_service.repo.get_replies = AsyncMock(return_value=replies)
+    post_service.repo.get_total_comments = AsyncMock(return_value=2)
+
+    request = post_pb2.GetCommentsRequest(post_id="1", user_id="user1", layout=post_pb2.TREE)
+    response = await post_service.GetComments(request, mock_context)
+
+    post_service.repo.get_replies.assert_called_once_with(["r1", "r2"], "user1")
+    post_service.repo.get_total_comments.assert_called_once_with("1", "user1", roots_only=True)
+    assert [c.id for c in response.comments] == ["r1", "r2"]
+    assert [c.id for c in response.comments[0].replies] == ["a", "d"]
+    tombstone = response.comments[0].replies[0].replies[0]
+    assert tombstone.deleted is True
+    assert tombstone.content == ""
+    assert tombstone.user_id == ""
+    assert tombstone.replies[0].id == "c"
+
+@pytest.mark.asyncio
+async def test_get_comments_thread(post_service, mock_context):
+    roots, replies = _thread_rows()
+    post_service.repo.get_comments_after = AsyncMock(return_value=roots)
+    post_service.repo.get_replies = AsyncMock(return_value=replies)
+    post_service.repo.get_total_comments = AsyncMock(return_value=2)
+
+    request = post_pb2.GetCommentsRequest(post_id="1", user_id="user1", limit=5, layout=post_pb2.THREAD)
+    response = await post_service.GetComments(request, mock_context)
+
+    assert post_service.repo.get_comments_after.call_args.kwargs["roots_only"] is True
+    assert [(c.id, c.depth) for c in response.comments] == [("r1", 0), ("a", 1), ("b", 2), ("c", 3), ("d", 1), ("r2", 0)]
+    assert all(not c.replies for c in response.comments)
+
+@pytest.mark.asyncio
+async def test_get_comments_unknown_layout(post_service, mock_context):
+    post_service.repo.get_comments = AsyncMock()
+
+    await post_service.GetComments(post_pb2.GetCommentsRequest(post_id="1", layout=7), mock_context)
+
+    mock_context.set_code.assert_called_with(StatusCode.INVALID_ARGUMENT)
+    post_service.repo.get_comments.assert_not_called()
+
+def _cursor_posts(count):
+    base = datetime.datetime(2024, 5, 1, tzinfo=datetime.timezone.utc)
+    return [
+        {
+            "id": f"p{i}",
+            "title": "Title",
+            "description": "Desc",
+            "user_id": "user1",
+            "created_at": base - datetime.timedelta(minutes=i),
+            "updated_at": base,
+            "is_private": False,
+            "tags": []
+        }
+        for i in range(count)
+    ]
+
+@pytest.mark.asyncio
+async def test_list_posts_cursor_next_page(post_service, mock_context):
+    posts = _cursor_posts(3)
+    post_service.repo.list_posts_after = AsyncMock(return_value=(posts, 10))
+
+    request = post_pb2.ListPostsRequest(user_id="user1", limit=2)
+    response = await post_service.ListPosts(request, mock_context)
+
+    post_service.repo.list_posts_after.assert_called_once_with(
+        limit=3, user_id="user1", after=None, filters=PostFilter()
+    )
+    assert [p.id for p in response.posts] == ["p0", "p1"]
+    assert decode_cursor("posts:newest", response.next_cursor) == Position(posts[1]["created_at"], "p1")
+
+@pytest.mark.asyncio
+async def test_list_posts_cursor_last_page(post_service, mock_context):
+    posts = _cursor_posts(2)
+    post_service.repo.list_posts_after = AsyncMock(return_value=(posts, 2))
+    cursor = encode_cursor("posts:newest", posts[0]["created_at"], "p0")
+
+    request = post_pb2.ListPostsRequest(user_id="user1", cursor=cursor, limit=5)
+    response = await post_service.ListPosts(request, mock_context)
+
+    post_service.repo.list_posts_after.assert_called_once_with(
+        limit=6, user_id="user1", after=Position(posts[0]["created_at"], "p0"), filters=PostFilter()
+    )
+    assert len(response.posts) == 2
+    assert response.next_cursor == ""
+
+@pytest.mark.asyncio
+async def test_list_posts_invalid_cursor(post_service, mock_context):
+    post_service.repo.list_posts_after = AsyncMock()
+
+    request = post_pb2.ListPostsRequest(user_id="user1", cursor="forged.cursor")
+    await post_service.ListPosts(request, mock_context)
+
+    mock_context.set_code.assert_called_with(StatusCode.INVALID_ARGUMENT)
+    post_service.repo.list_posts_after.assert_not_called()
+
+@pytest.mark.asyncio
+async def test_list_posts_filters(post_service, mock_context):
+    post_service.repo.list_posts = AsyncMock(return_value=([], 0))
+
+    request = post_pb2.ListPostsRequest(
+        user_id="user1",
+        author_id="6f1c2b9e-7d4a-4b6e-9c1d-2a8f5e6b7c90",
+        tags=["go", "grpc"],
+        tag_match=post_pb2.ALL_TAGS,
+        created_from="2024-01-01T00:00:00Z",
+        created_to="2024-02-01T00:00:00+03:00",
+        sort=post_pb2.MOST_LIKED
+    )
+    await post_service.ListPosts(request, mock_context)
+
+    filters = post_service.repo.list_posts.call_args.kwargs["filters"]
+    assert filters == PostFilter(
+        author_id="6f1c2b9e-7d4a-4b6e-9c1d-2a8f5e6b7c90",
+        tags=["go", "grpc"],
+        match_all_tags=True,
+        created_from=datetime.datetime(2024, 1, 1, tzinfo=datetime.timezone.utc),
+        created_to=datetime.datetime(2024, 2, 1, tzinfo=datetime.timezone(datetime.timedelta(hours=3))),
+        sort="most_liked"
+    )
+
+@pytest.mark.asyncio
+@pytest.mark.parametrize("fields, field", [
+    ({"sort": 7}, "sort"),
+    ({"tag_match": 3}, "tag_match"),
+    ({"author_id": "not-a-uuid"}, "author_id"),
+    ({"created_from": "yesterday"}, "created_from"),
+    ({"created_from": "2024-01-01T00:00:00"}, "created_from"),
+    ({"created_from": "2024-02-01T00:00:00Z", "created_to": "2024-01-01T00:00:00Z"}, "created_from"),
+])
+async def test_list_posts_invalid_filters(post_service, mock_context, fields, field):
+    post_service.repo.list_posts = AsyncMock()
+
+    await post_service.ListPosts(post_pb2.ListPostsRequest(user_id="user1", **fields), mock_context)
+
+    mock_context.set_code.assert_called_with(StatusCode.INVALID_ARGUMENT)
+    post_service.repo.list_posts.assert_not_called()
+
+    (key, value), = mock_context.set_trailing_metadata.call_args[0][0]
+    assert key == "grpc-status-details-bin"
+    details = error_details_pb2.BadRequest()
+    status_pb2.Status.FromString(value).details[0].Unpack(details)
+    assert details.field_violations[0].field == field
+
+@pytest.mark.asyncio
+async def test_list_posts_most_liked_cursor(post_service, mock_context):
+    posts = _cursor_posts(2)
+    for i, post in enumerate(posts):
+        post["like_count"] = 10 - i
+    post_service.repo.list_posts_after = AsyncMock(return_value=(posts, 2))
+
+    request = post_pb2.ListPostsRequest(user_id="user1", limit=1, sort=post_pb2.MOST_LIKED)
+    response = await post_service.ListPosts(request, mock_context)
+
+    assert decode_cursor("posts:most_liked", response.next_cursor) == Position(posts[0]["created_at"], "p0", 10)
+
+    request = post_pb2.ListPostsRequest(user_id="user1", cursor=response.next_cursor)
+    await post_service.ListPosts(request, mock_context)
+    mock_context.set_code.assert_called_with(StatusCode.INVALID_ARGUMENT)
+
+@pytest.mark.asyncio
+async def test_get_comments_cursor_scoped_to_post(post_service, mock_context):
+    comment = {"id": "c1", "content": "hi", "user_id": "user1",
+               "created_at": datetime.datetime(2024, 5, 1, tzinfo=datetime.timezone.utc)}
+    post_service.repo.get_comments_after = AsyncMock(return_value=[comment, comment])
+    post_service.repo.get_total_comments = AsyncMock(return_value=5)
+
+    request = post_pb2.GetCommentsRequest(post_id="p1", user_id="user1", limit=1)
+    response = await post_service.GetComments(request, mock_context)
+
+    assert len(response.comments) == 1
+    assert decode_cursor("comments:p1", response.next_cursor) == Position(comment["created_at"], "c1")
+
+    request = post_pb2.GetCommentsRequest(post_id="p2", user_id="user1", cursor=response.next_cursor)
+    await post_service.GetComments(request, mock_context)
+    mock_context.set_code.assert_called_with(StatusCode.INVALID_ARGUMENT)
+
+@pytest.mark.asyncio
+async def test_search_posts_success(post_service, mock_context):
+    hit = dict(_cursor_posts(1)[0], rank=0.5, title_snippet="<mark>Title</mark>", description_snippet="Desc")
+    post_service.repo.search_posts = AsyncMock(return_value=([hit], 1, [{"tag": "go", "count": 1}]))
+
+    request = post_pb2.SearchPostsRequest(query="  title ", user_id="user1", page=0, page_size=500, tags=["go"])
+    response = await post_service.SearchPosts(request, mock_context)
+
+    post_service.repo.search_posts.assert_called_once_with(
+        query="title", user_id="user1", page=1, page_size=10, tags=["go"]
+    )
+    assert response.total == 1
+    assert response.hits[0].post.id == "p0"
+    assert response.hits[0].rank == 0.5
+    assert response.hits[0].title_snippet == "<mark>Title</mark>"
+    assert response.facets[0] == post_pb2.TagFacet(tag="go", count=1)
+
+@pytest.mark.asyncio
+@pytest.mark.parametrize("query", ["", "   ", "x" * 201])
+async def test_search_posts_invalid_query(post_service, mock_context, query):
+    post_service.repo.search_posts = AsyncMock()
+
+    await post_service.SearchPosts(post_pb2.SearchPostsRequest(query=query, user_id="user1"), mock_context)
+
+    mock_context.set_code.assert_called_with(StatusCode.INVALID_ARGUMENT)
+    post_service.repo.search_posts.assert_not_called()
+
 @pytest.mark.asyncio
 async def test_send_kafka_event_error(post_service, mock_context):
     post_service._send_kafka_event = AsyncMock(side_effect=Exception("Kafka error"))
@@ -299,4 +714,529 @@ async def test_send_kafka_event_error(post_service, mock_context):
     assert response.success is True
     post_service._send_kafka_event.assert_called_with(
         "post_views", "user1", "1"
-    )
\ No newline at end of file
+    )
+
+@pytest.mark.asyncio
+async def test_send_kafka_event_forwards_request_id(post_service):
+    post_service.kafka.send = AsyncMock()
+    token = request_id_var.set("req-123")
+    try:
+        await post_service._send_kafka_event("post_likes", "user1", "1")
+    finally:
+        request_id_var.reset(token)
+
+    _, kwargs = post_service.kafka.send.call_args
+    assert kwargs["headers"] == [("X-Request-ID", b"req-123")]
+
+@pytest.mark.asyncio
+async def test_send_kafka_event_wraps_envelope(post_service):
+    post_service.kafka.send = AsyncMock()
+
+    await post_service._send_kafka_event("post_comments", "user1", "1", 'say "hi"')
+
+    args, kwargs = post_service.kafka.send.call_args
+    assert args[0] == "post_comments"
+    event = json.loads(args[1])
+    assert event["type"] == "post.commented"
+    assert event["version"] == 1
+    assert event["producer"] == "events_service"
+    assert event["payload"] == {"user_id": "user1", "post_id": "1", "content": 'say "hi"'}
+    assert kwargs["key"] == b"1"
+
+@pytest.mark.asyncio
+async def test_send_kafka_event_unliked(post_service):
+    post_service.kafka.send = AsyncMock()
+
+    await post_service._send_kafka_event("post_likes", "user1", "1", event_type="post.unliked")
+
+    args, _ = post_service.kafka.send.call_args
+    assert args[0] == "post_likes"
+    assert json.loads(args[1])["type"] == "post.unliked"
+
+@pytest.mark.asyncio
+async def test_set_reaction_switches(post_service, mock_context):
+    post_service.repo.set_reaction = AsyncMock(return_value={"found": True, "previous": "👍"})
+    post_service.repo.get_reactions = AsyncMock(return_value={"reactions": '{"❤️": 1}', "my_reaction": "❤️"})
+    post_service._send_event = AsyncMock()
+
+    request = post_pb2.SetReactionRequest(post_id=POST_ID, user_id="user1", reaction="❤️")
+    response = await post_service.SetReaction(request, mock_context)
+
+    post_service.repo.set_reaction.assert_called_once_with("post", POST_ID, "user1", "❤️", post_id=None)
+    assert response.my_reaction == "❤️"
+    assert [(r.reaction, r.count) for r in response.reactions] == [("❤️", 1)]
+    assert [c.args for c in post_service._send_event.call_args_list] == [
+        ("post_reactions", "reaction.removed", {"post_id": POST_ID, "user_id": "user1", "reaction": "👍"}),
+        ("post_reactions", "reaction.added", {"post_id": POST_ID, "user_id": "user1", "reaction": "❤️"}),
+    ]
+
+@pytest.mark.asyncio
+async def test_set_reaction_unchanged_sends_nothing(post_service, mock_context):
+    post_service.repo.set_reaction = AsyncMock(return_value={"found": True, "previous": "👍"})
+    post_service.repo.get_reactions = AsyncMock(return_value={"reactions": '{"👍": 1}', "my_reaction": "👍"})
+    post_service._send_event = AsyncMock()
+
+    request = post_pb2.SetReactionRequest(post_id=POST_ID, comment_id=COMMENT_ID, user_id="user1", reaction="👍")
+    await post_service.SetReaction(request, mock_context)
+
+    post_service.repo.set_reaction.assert_called_once_with("comment", COMMENT_ID, "user1", "👍", post_id=POST_ID)
+    post_service._send_event.assert_not_called()
+
+@pytest.mark.asyncio
+async def test_set_reaction_unknown(post_service, mock_context):
+    post_service.repo.set_reaction = AsyncMock()
+
+    request = post_pb2.SetReactionRequest(post_id=POST_ID, user_id="user1", reaction="🦄")
+    await post_service.SetReaction(request, mock_context)
+
+    mock_context.set_code.assert_called_with(StatusCode.INVALID_ARGUMENT)
+    post_service.repo.set_reaction.assert_not_called()
+
+@pytest.mark.asyncio
+async def test_remove_reaction_of_comment(post_service, mock_context):
+    post_service.repo.remove_reaction = AsyncMock(return_value={"found": True, "previous": "😂"})
+    post_service.repo.get_reactions = AsyncMock(return_value={"reactions": "{}", "my_reaction": None})
+    post_service._send_event = AsyncMock()
+
+    request = post_pb2.RemoveReactionRequest(post_id=POST_ID, comment_id=COMMENT_ID, user_id="user1")
+    response = await post_service.RemoveReaction(request, mock_context)
+
+    assert response.my_reaction == ""
+    assert len(response.reactions) == 0
+    post_service._send_event.assert_called_once_with("post_reactions", "reaction.removed", {
+        "post_id": POST_ID, "comment_id": COMMENT_ID, "user_id": "user1", "reaction": "😂"
+    })
+
+@pytest.mark.asyncio
+async def test_remove_reaction_not_found(post_service, mock_context):
+    post_service.repo.remove_reaction = AsyncMock(return_value={"found": False, "previous": None})
+    post_service.repo.is_suspended = AsyncMock(return_value=False)
+
+    request = post_pb2.RemoveReactionRequest(post_id=POST_ID, user_id="user1")
+    await post_service.RemoveReaction(request, mock_context)
+
+    mock_context.set_code.assert_called_with(StatusCode.NOT_FOUND)
+
+@pytest.mark.asyncio
+async def test_get_reaction_types(post_service, mock_context):
+    response = await post_service.GetReactionTypes(post_pb2.GetReactionTypesRequest(), mock_context)
+
+    assert list(response.reactions) == ["👍", "❤️", "😂", "😮", "😢", "😡"]
+
+COLLECTION_ID = "0b6f7e2a-3c4d-4e5f-8a9b-1c2d3e4f5a6b"
+
+@pytest.mark.asyncio
+async def test_bookmark_post_into_collection(post_service, mock_context):
+    post_service.repo.bookmark_post = AsyncMock(return_value={
+        "post_found": True, "collection_found": True, "collection_id": COLLECTION_ID
+    })
+
+    request = post_pb2.BookmarkPostRequest(post_id=POST_ID, user_id="user1", collection_id=COLLECTION_ID)
+    response = await post_service.BookmarkPost(request, mock_context)
+
+    assert response.bookmarked is True
+    assert response.collection_id == COLLECTION_ID
+    post_service.repo.bookmark_post.assert_called_once_with(POST_ID, "user1", COLLECTION_ID)
+
+@pytest.mark.asyncio
+@pytest.mark.parametrize("post_found,collection_found,details", [
+    (False, True, "Post not found"),
+    (True, False, "Collection not found"),
+])
+async def test_bookmark_post_not_found(post_service, mock_context, post_found, collection_found, details):
+    post_service.repo.bookmark_post = AsyncMock(return_value={
+        "post_found": post_found, "collection_found": collection_found, "collection_id": None
+    })
+
+    request = post_pb2.BookmarkPostRequest(post_id=POST_ID, user_id="user1", collection_id=COLLECTION_ID)
+    await post_service.BookmarkPost(request, mock_context)
+
+    mock_context.set_code.assert_called_with(StatusCode.NOT_FOUND)
+    mock_context.set_details.assert_called_with(details)
+
+@pytest.mark.asyncio
+async def test_remove_bookmark(post_service, mock_context):
+    post_service.repo.remove_bookmark = AsyncMock(return_value=False)
+
+    request = post_pb2.RemoveBookmarkRequest(post_id=POST_ID, user_id="user1")
+    response = await post_service.RemoveBookmark(request, mock_context)
+
+    assert response.bookmarked is False
+    mock_context.set_code.assert_not_called()
+
+@pytest.mark.asyncio
+async def test_list_bookmarks_next_page(post_service, mock_context):
+    rows = _cursor_posts(3)
+    for i, row in enumerate(rows):
+        row["collection_id"] = None
+        row["bookmarked_at"] = datetime.datetime(2024, 6, 1, tzinfo=datetime.timezone.utc) - datetime.timedelta(hours=i)
+    post_service.repo.list_bookmarks = AsyncMock(return_value=rows)
+
+    request = post_pb2.ListBookmarksRequest(user_id="user1", limit=2)
+    response = await post_service.ListBookmarks(request, mock_context)
+
+    post_service.repo.list_bookmarks.assert_called_once_with(
+        user_id="user1", limit=3, after=None, collection_id=None
+    )
+    assert [b.post.id for b in response.bookmarks] == ["p0", "p1"]
+    assert response.bookmarks[1].created_at == rows[1]["bookmarked_at"].isoformat()
+    # The cursor follows the bookmark time, not the creation of the post.
+    assert decode_cursor("bookmarks:", response.next_cursor) == Position(rows[1]["bookmarked_at"], "p1")
+
+@pytest.mark.asyncio
+async def test_list_bookmarks_cursor_of_other_collection(post_service, mock_context):
+    post_service.repo.list_bookmarks = AsyncMock()
+    cursor = encode_cursor("bookmarks:", datetime.datetime(2024, 6, 1, tzinfo=datetime.timezone.utc), "p1")
+
+    request = post_pb2.ListBookmarksRequest(user_id="user1", cursor=cursor, collection_id=COLLECTION_ID)
+    await post_service.ListBookmarks(request, mock_context)
+
+    mock_context.set_code.assert_called_with(StatusCode.INVALID_ARGUMENT)
+    post_service.repo.list_bookmarks.assert_not_called()
+
+@pytest.mark.asyncio
+async def test_create_bookmark_collection(post_service, mock_context):
+    post_service.repo.create_bookmark_collection = AsyncMock(return_value={
+        "id": COLLECTION_ID,
+        "name": "Рецепты",
+        "created_at": datetime.datetime(2024, 6, 1, tzinfo=datetime.timezone.utc),
+        "bookmark_count": 0
+    })
+
+    request = post_pb2.CreateBookmarkCollectionRequest(user_id="user1", name="  Рецепты ")
+    response = await post_service.CreateBookmarkCollection(request, mock_context)
+
+    assert response.id == COLLECTION_ID
+    assert response.name == "Рецепты"
+    post_service.repo.create_bookmark_collection.assert_called_once_with("user1", "Рецепты")
+
+@pytest.mark.asyncio
+async def test_create_bookmark_collection_duplicate(post_service, mock_context):
+    post_service.repo.create_bookmark_collection = AsyncMock(return_value=None)
+
+    request = post_pb2.CreateBookmarkCollectionRequest(user_id="user1", name="Рецепты")
+    await post_service.CreateBookmarkCollection(request, mock_context)
+
+    mock_context.set_code.assert_called_with(StatusCode.ALREADY_EXISTS)
+
+@pytest.mark.asyncio
+async def test_create_bookmark_collection_empty_name(post_service, mock_context):
+    post_service.repo.create_bookmark_collection = AsyncMock()
+
+    request = post_pb2.CreateBookmarkCollectionRequest(user_id="user1", name="   ")
+    await post_service.CreateBookmarkCollection(request, mock_context)
+
+    mock_context.set_code.assert_called_with(StatusCode.INVALID_ARGUMENT)
+    post_service.repo.create_bookmark_collection.assert_not_called()
+
+@pytest.mark.asyncio
+async def test_delete_bookmark_collection_not_found(post_service, mock_context):
+    post_service.repo.delete_bookmark_collection = AsyncMock(return_value=False)
+
+    request = post_pb2.DeleteBookmarkCollectionRequest(collection_id=COLLECTION_ID, user_id="user1")
+    response = await post_service.DeleteBookmarkCollection(request, mock_context)
+
+    assert response.success is False
+    mock_context.set_code.assert_called_with(StatusCode.NOT_FOUND)
+
+@pytest.mark.asyncio
+async def test_create_post_suspended(post_service, mock_context):
+    post_service.repo.create_post = AsyncMock(return_value=None)
+
+    request = post_pb2.CreatePostRequest(title="Test", user_id="user1")
+    response = await post_service.CreatePost(request, mock_context)
+
+    mock_context.set_code.assert_called_with(StatusCode.PERMISSION_DENIED)
+    assert response == post_pb2.PostResponse()
+
+@pytest.mark.asyncio
+async def test_comment_post_suspended(post_service, mock_context):
+    post_service.repo.add_comment = AsyncMock(return_value=None)
+    post_service.repo.is_suspended = AsyncMock(return_value=True)
+    post_service._send_kafka_event = AsyncMock()
+
+    request = post_pb2.CommentPostRequest(post_id=POST_ID, user_id="user1", content="test")
+    await post_service.CommentPost(request, mock_context)
+
+    mock_context.set_code.assert_called_with(StatusCode.PERMISSION_DENIED)
+    post_service._send_kafka_event.assert_not_called()
+
+@pytest.mark.asyncio
+async def test_comment_post_not_visible(post_service, mock_context):
+    post_service.repo.add_comment = AsyncMock(return_value=None)
+    post_service.repo.is_suspended = AsyncMock(return_value=False)
+    post_service._send_kafka_event = AsyncMock()
+
+    request = post_pb2.CommentPostRequest(post_id=POST_ID, user_id="user1", content="test")
+    response = await post_service.CommentPost(request, mock_context)
+
+    mock_context.set_code.assert_called_with(StatusCode.NOT_FOUND)
+    assert response == post_pb2.CommentResponse()
+    post_service._send_kafka_event.assert_not_called()
+
+USER_ID = "5d2e8f1a-4b3c-4d6e-9f8a-7b6c5d4e3f21"
+
+@pytest.mark.asyncio
+@pytest.mark.parametrize("liked", [True, False])
+async def test_like_post_suspended(post_service, mock_context, liked):
+    post_service._send_kafka_event = AsyncMock()
+    post_service.repo.like_post = AsyncMock(return_value=None)
+    post_service.repo.unlike_post = AsyncMock(return_value=None)
+    post_service.repo.is_suspended = AsyncMock(return_value=True)
+
+    if liked:
+        response = await post_service.LikePost(post_pb2.LikePostRequest(post_id=POST_ID, user_id="user1"), mock_context)
+    else:
+        response = await post_service.UnlikePost(post_pb2.UnlikePostRequest(post_id=POST_ID, user_id="user1"), mock_context)
+
+    mock_context.set_code.assert_called_with(StatusCode.PERMISSION_DENIED)
+    post_service.repo.is_suspended.assert_called_once_with("user1")
+    post_service._send_kafka_event.assert_not_called()
+    assert response.success is False
+
+@pytest.mark.asyncio
+async def test_update_post_suspended(post_service, mock_context):
+    post_service.repo.update_post = AsyncMock(return_value=None)
+    post_service.repo.is_suspended = AsyncMock(return_value=True)
+
+    request = post_pb2.UpdatePostRequest(post_id=POST_ID, user_id="user1", title="New")
+    response = await post_service.UpdatePost(request, mock_context)
+
+    mock_context.set_code.assert_called_with(StatusCode.PERMISSION_DENIED)
+    assert response == post_pb2.PostResponse()
+
+@pytest.mark.asyncio
+async def test_update_comment_suspended(post_service, mock_context):
+    post_service.repo.update_comment = AsyncMock(return_value=None)
+    post_service.repo.is_suspended = AsyncMock(return_value=True)
+
+    request = post_pb2.UpdateCommentRequest(post_id=POST_ID, comment_id=COMMENT_ID, user_id="user1", content="new")
+    await post_service.UpdateComment(request, mock_context)
+
+    mock_context.set_code.assert_called_with(StatusCode.PERMISSION_DENIED)
+
+@pytest.mark.asyncio
+async def test_set_reaction_suspended(post_service, mock_context):
+    post_service.repo.set_reaction = AsyncMock(return_value={"found": False, "previous": None})
+    post_service.repo.is_suspended = AsyncMock(return_value=True)
+    post_service._send_kafka_event = AsyncMock()
+
+    request = post_pb2.SetReactionRequest(post_id=POST_ID, comment_id=COMMENT_ID, user_id="user1", reaction="👍")
+    await post_service.SetReaction(request, mock_context)
+
+    mock_context.set_code.assert_called_with(StatusCode.PERMISSION_DENIED)
+    post_service._send_kafka_event.assert_not_called()
+
+@pytest.mark.asyncio
+async def test_create_report_suspended(post_service, mock_context):
+    post_service.repo.create_report = AsyncMock(return_value=None)
+    post_service.repo.is_suspended = AsyncMock(return_value=True)
+
+    request = post_pb2.CreateReportRequest(user_id=USER_ID, target_type="post", target_id=POST_ID, reason="spam")
+    await post_service.CreateReport(request, mock_context)
+
+    mock_context.set_code.assert_called_with(StatusCode.PERMISSION_DENIED)
+
+@pytest.mark.asyncio
+async def test_suspension_lookup_error(post_service, mock_context):
+    post_service.repo.like_post = AsyncMock(return_value=None)
+    post_service.repo.is_suspended = AsyncMock(side_effect=Exception("DB error"))
+
+    await post_service.LikePost(post_pb2.LikePostRequest(post_id=POST_ID, user_id="user1"), mock_context)
+
+    mock_context.set_code.assert_called_with(StatusCode.INTERNAL)
+
+
+def _report(created=True):
+    return {
+        "id": "r1",
+        "target_type": "post",
+        "target_id": POST_ID,
+        "reason": "spam",
+        "details": "ads",
+        "status": "open",
+        "created_at": datetime.datetime(2024, 6, 1, tzinfo=datetime.timezone.utc),
+        "created": created,
+    }
+
+@pytest.mark.asyncio
+async def test_create_report(post_service, mock_context):
+    post_service.repo.create_report = AsyncMock(return_value=_report())
+
+    request = post_pb2.CreateReportRequest(user_id=USER_ID, target_type="post", target_id=POST_ID, reason="spam", details=" ads ")
+    response = await post_service.CreateReport(request, mock_context)
+
+    post_service.repo.create_report.assert_called_once_with(USER_ID, "post", POST_ID, "spam", "ads")
+    assert response.id == "r1"
+    assert response.status == "open"
+    assert response.already_reported is False
+
+@pytest.mark.asyncio
+async def test_create_report_duplicate(post_service, mock_context):
+    post_service.repo.create_report = AsyncMock(return_value=_report(created=False))
+
+    request = post_pb2.CreateReportRequest(user_id=USER_ID, target_type="post", target_id=POST_ID, reason="hate")
+    response = await post_service.CreateReport(request, mock_context)
+
+    assert response.id == "r1"
+    assert response.already_reported is True
+    mock_context.set_code.assert_not_called()
+
+@pytest.mark.asyncio
+@pytest.mark.parametrize("target_type, target_id, reason, field", [
+    ("video", POST_ID, "spam", "target_type"),
+    ("post", "1", "spam", "target_id"),
+    ("post", POST_ID, "boring", "reason"),
+    ("user", USER_ID, "spam", "target_id"),
+])
+async def test_create_report_invalid(post_service, mock_context, target_type, target_id, reason, field):
+    post_service.repo.create_report = AsyncMock()
+
+    request = post_pb2.CreateReportRequest(user_id=USER_ID, target_type=target_type, target_id=target_id, reason=reason)
+    await post_service.CreateReport(request, mock_context)
+
+    mock_context.set_code.assert_called_with(StatusCode.INVALID_ARGUMENT)
+    (key, value), = mock_context.set_trailing_metadata.call_args[0][0]
+    details = error_details_pb2.BadRequest()
+    status_pb2.Status.FromString(value).details[0].Unpack(details)
+    assert details.field_violations[0].field == field
+    post_service.repo.create_report.assert_not_called()
+
+@pytest.mark.asyncio
+async def test_create_report_target_not_found(post_service, mock_context):
+    post_service.repo.create_report = AsyncMock(return_value=None)
+    post_service.repo.is_suspended = AsyncMock(return_value=False)
+
+    request = post_pb2.CreateReportRequest(user_id=USER_ID, target_type="comment", target_id=COMMENT_ID, reason="spam")
+    await post_service.CreateReport(request, mock_context)
+
+    mock_context.set_code.assert_called_with(StatusCode.NOT_FOUND)
+    mock_context.set_details.assert_called_with("Comment not found")
+
+def _cases(count):
+    base = datetime.datetime(2024, 6, 1, tzinfo=datetime.timezone.utc)
+    return [
+        {
+            "target_type": "post",
+            "id": f"p{i}",
+            "post_id": f"p{i}",
+            "author_id": USER_ID,
+            "preview": f"Post {i}",
+            "hidden": False,
+            "report_count": 3,
+            "reasons": '{"spam": 1, "hate": 2}',
+            "first_reported_at": base + datetime.timedelta(hours=i),
+            "last_reported_at": base + datetime.timedelta(hours=i, minutes=5),
+        }
+        for i in range(count)
+    ]
+
+@pytest.mark.asyncio
+async def test_list_moderation_queue(post_service, mock_context):
+    rows = _cases(3)
+    post_service.repo.list_moderation_queue = AsyncMock(return_value=rows)
+
+    request = post_pb2.ListModerationQueueRequest(user_id=USER_ID, target_type="post", limit=2)
+    response = await post_service.ListModerationQueue(request, mock_context)
+
+    post_service.repo.list_moderation_queue.assert_called_once_with(limit=3, after=None, target_type="post")
+    assert [c.target_id for c in response.cases] == ["p0", "p1"]
+    assert [(r.reason, r.count) for r in response.cases[0].reasons] == [("hate", 2), ("spam", 1)]
+    assert decode_cursor("moderation:post", response.next_cursor) == Position(rows[1]["first_reported_at"], "p1")
+
+@pytest.mark.asyncio
+async def test_list_moderation_queue_unknown_target_type(post_service, mock_context):
+    post_service.repo.list_moderation_queue = AsyncMock()
+
+    request = post_pb2.ListModerationQueueRequest(user_id=USER_ID, target_type="video")
+    await post_service.ListModerationQueue(request, mock_context)
+
+    mock_context.set_code.assert_called_with(StatusCode.INVALID_ARGUMENT)
+    post_service.repo.list_moderation_queue.assert_not_called()
+
+def _decision(action="hide", expires_at=None):
+    return {
+        "id": "d1",
+        "moderator_id": USER_ID,
+        "target_type": "post",
+        "target_id": POST_ID,
+        "subject_id": "user1",
+        "action": action,
+        "note": "",
+        "created_at": datetime.datetime(2024, 6, 1, tzinfo=datetime.timezone.utc),
+        "expires_at": expires_at,
+        "resolved_reports": 2,
+    }
+
+@pytest.mark.asyncio
+async def test_create_moderation_decision(post_service, mock_context):
+    post_service.repo.moderate = AsyncMock(return_value=_decision())
+
+    request = post_pb2.CreateModerationDecisionRequest(user_id=USER_ID, target_type="post", target_id=POST_ID, action="hide")
+    response = await post_service.CreateModerationDecision(request, mock_context)
+
+    post_service.repo.moderate.assert_called_once_with(
+        moderator_id=USER_ID, target_type="post", target_id=POST_ID, action="hide", note="", duration_hours=0
+    )
+    assert response.action == "hide"
+    assert response.subject_id == "user1"
+    assert response.expires_at == ""
+    assert response.resolved_reports == 2
+
+@pytest.mark.asyncio
+async def test_create_moderation_decision_suspend(post_service, mock_context):
+    expires_at = datetime.datetime(2024, 6, 4, tzinfo=datetime.timezone.utc)
+    post_service.repo.moderate = AsyncMock(return_value=_decision("suspend", expires_at))
+
+    request = post_pb2.CreateModerationDecisionRequest(
+        user_id=USER_ID, target_type="post", target_id=POST_ID, action="suspend", duration_hours=72
+    )
+    response = await post_service.CreateModerationDecision(request, mock_context)
+
+    assert post_service.repo.moderate.call_args.kwargs["duration_hours"] == 72
+    assert response.expires_at == expires_at.isoformat()
+
+@pytest.mark.asyncio
+@pytest.mark.parametrize("target_type, action, duration_hours, field", [
+    ("user", "hide", 0, "action"),
+    ("post", "ban", 0, "action"),
+    ("post", "suspend", 0, "duration_hours"),
+    ("post", "suspend", 24 * 366, "duration_hours"),
+    ("post", "warn", 24, "duration_hours"),
+])
+async def test_create_moderation_decision_invalid(post_service, mock_context, target_type, action, duration_hours, field):
+    post_service.repo.moderate = AsyncMock()
+
+    request = post_pb2.CreateModerationDecisionRequest(
+        user_id=USER_ID, target_type=target_type, target_id=POST_ID, action=action, duration_hours=duration_hours
+    )
+    await post_service.CreateModerationDecision(request, mock_context)
+
+    mock_context.set_code.assert_called_with(StatusCode.INVALID_ARGUMENT)
+    (key, value), = mock_context.set_trailing_metadata.call_args[0][0]
+    details = error_details_pb2.BadRequest()
+    status_pb2.Status.FromString(value).details[0].Unpack(details)
+    assert details.field_violations[0].field == field
+    post_service.repo.moderate.assert_not_called()
+
+@pytest.mark.asyncio
+async def test_create_moderation_decision_not_found(post_service, mock_context):
+    post_service.repo.moderate = AsyncMock(return_value=None)
+
+    request = post_pb2.CreateModerationDecisionRequest(user_id=USER_ID, target_type="comment", target_id=COMMENT_ID, action="delete")
+    await post_service.CreateModerationDecision(request, mock_context)
+
+    mock_context.set_code.assert_called_with(StatusCode.NOT_FOUND)
+
+@pytest.mark.asyncio
+async def test_list_moderation_decisions_by_subject(post_service, mock_context):
+    post_service.repo.list_moderation_decisions = AsyncMock(return_value=[_decision("warn")])
+
+    request = post_pb2.ListModerationDecisionsRequest(user_id=USER_ID, subject_id=USER_ID)
+    response = await post_service.ListModerationDecisions(request, mock_context)
+
+    post_service.repo.list_moderation_decisions.assert_called_once_with(
+        limit=11, after=None, target_type=None, target_id=None, subject_id=USER_ID
+    )
+    assert [d.action for d in response.decisions] == ["warn"]
+    assert response.next_cursor == ""
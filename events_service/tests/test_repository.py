@@ -1,6 +1,9 @@
+import datetime
+import re
 import pytest
 from unittest.mock import AsyncMock
-from repository import PostRepository
+from cursor import Position
+from repository import PostFilter, PostRepository
 
 @pytest.mark.asyncio
 async def test_create_post():
@@ -35,8 +38,11 @@ async def test_get_post():
     await repo.get_post("post123", "user123")
     
     sql = mock_pool.fetchrow.call_args[0][0]
-    assert "SELECT * FROM posts" in sql
+    assert "SELECT posts.*" in sql
     assert "NOT is_private OR user_id = $2" in sql
+    assert "likes.user_id = $2) AS liked_by_me" in sql
+    assert "FROM post_reactions WHERE post_id = posts.id GROUP BY reaction" in sql
+    assert "AND user_id = $2) AS my_reaction" in sql
     assert mock_pool.fetchrow.call_args[0][1:] == ("post123", "user123")
 
 @pytest.mark.asyncio
@@ -73,8 +79,79 @@ async def test_list_posts():
     
     assert len(posts) == 2
     assert total == 10
-    assert "LIMIT $1 OFFSET $2" in mock_pool.fetch.call_args[0][0]
-    assert mock_pool.fetch.call_args[0][1:3] == (5, 5)
+    assert "LIMIT $2 OFFSET $3" in mock_pool.fetch.call_args[0][0]
+    assert "likes.user_id = $1) AS liked_by_me" in mock_pool.fetch.call_args[0][0]
+    assert mock_pool.fetch.call_args[0][1:] == ("user123", 5, 5)
+
+@pytest.mark.asyncio
+async def test_list_posts_filters():
+    mock_pool = AsyncMock()
+    repo = PostRepository(mock_pool)
+    created_from = datetime.datetime(2024, 1, 1, tzinfo=datetime.timezone.utc)
+    filters = PostFilter(author_id="author1", tags=["go"], created_from=created_from, sort="oldest")
+
+    await repo.list_posts(page=1, page_size=10, user_id="user123", filters=filters)
+
+    sql = mock_pool.fetch.call_args[0][0]
+    assert "user_id = $2" in sql
+    assert "tags && $3::text[]" in sql
+    assert "created_at >= $4" in sql
+    assert "ORDER BY created_at ASC, id ASC" in sql
+    assert mock_pool.fetch.call_args[0][1:] == ("user123", "author1", ["go"], created_from, 10, 0)
+
+    count_sql = mock_pool.fetchval.call_args[0][0]
+    assert "tags && $3::text[]" in count_sql
+    assert mock_pool.fetchval.call_args[0][1:] == ("user123", "author1", ["go"], created_from)
+
+@pytest.mark.asyncio
+async def test_list_posts_all_tags():
+    mock_pool = AsyncMock()
+    repo = PostRepository(mock_pool)
+
+    await repo.list_posts(1, 10, "user123", PostFilter(tags=["a", "b"], match_all_tags=True))
+
+    assert "tags @> $2::text[]" in mock_pool.fetch.call_args[0][0]
+
+@pytest.mark.asyncio
+async def test_list_posts_after():
+    mock_pool = AsyncMock()
+    mock_pool.fetch.return_value = [{"id": "1"}]
+    mock_pool.fetchval.return_value = 10
+    repo = PostRepository(mock_pool)
+    created_at = datetime.datetime(2024, 5, 1, tzinfo=datetime.timezone.utc)
+
+    posts, total = await repo.list_posts_after(limit=6, user_id="user123", after=Position(created_at, "p5"))
+
+    sql = mock_pool.fetch.call_args[0][0]
+    assert "(created_at, id) < ($2, $3::uuid)" in sql
+    assert "ORDER BY created_at DESC, id DESC" in sql
+    assert mock_pool.fetch.call_args[0][1:] == ("user123", created_at, "p5", 6)
+    assert total == 10
+
+@pytest.mark.asyncio
+async def test_list_posts_after_most_liked():
+    mock_pool = AsyncMock()
+    repo = PostRepository(mock_pool)
+    created_at = datetime.datetime(2024, 5, 1, tzinfo=datetime.timezone.utc)
+
+    await repo.list_posts_after(
+        limit=6, user_id="user123", after=Position(created_at, "p5", 3), filters=PostFilter(sort="most_liked")
+    )
+
+    sql = mock_pool.fetch.call_args[0][0]
+    assert "(like_count, created_at, id) < ($2, $3, $4::uuid)" in sql
+    assert "ORDER BY like_count DESC, created_at DESC, id DESC" in sql
+    assert mock_pool.fetch.call_args[0][1:] == ("user123", 3, created_at, "p5", 6)
+
+@pytest.mark.asyncio
+async def test_list_posts_after_first_page():
+    mock_pool = AsyncMock()
+    repo = PostRepository(mock_pool)
+
+    await repo.list_posts_after(limit=11, user_id="user123")
+
+    assert "(created_at, id) <" not in mock_pool.fetch.call_args[0][0]
+    assert mock_pool.fetch.call_args[0][1:] == ("user123", 11)
 
 @pytest.mark.asyncio
 async def test_delete_post():
@@ -115,23 +192,113 @@ async def test_add_comment():
     
     sql = mock_pool.fetchrow.call_args[0][0]
     assert "INSERT INTO comments" in sql
+    assert "WHERE id = $1::uuid AND hidden_at IS NULL AND (NOT is_private OR user_id = $2::uuid)" in sql
     assert mock_pool.fetchrow.call_args[0][1:] == (
         test_data["post_id"],
         test_data["user_id"],
-        test_data["content"]
+        test_data["content"],
+        None,
+        None,
+        0
     )
 
+@pytest.mark.asyncio
+async def test_add_reply():
+    mock_pool = AsyncMock()
+    repo = PostRepository(mock_pool)
+
+    await repo.add_comment("p1", "u1", "reply", parent={"id": "c2", "root_id": "c1", "depth": 1})
+
+    assert mock_pool.fetchrow.call_args[0][1:] == ("p1", "u1", "reply", "c2", "c1", 2)
+
+@pytest.mark.asyncio
+async def test_add_reply_to_top_level_comment():
+    mock_pool = AsyncMock()
+    repo = PostRepository(mock_pool)
+
+    await repo.add_comment("p1", "u1", "reply", parent={"id": "c1", "root_id": None, "depth": 0})
+
+    assert mock_pool.fetchrow.call_args[0][1:] == ("p1", "u1", "reply", "c1", "c1", 1)
+
+@pytest.mark.asyncio
+async def test_update_comment():
+    mock_pool = AsyncMock()
+    repo = PostRepository(mock_pool)
+
+    await repo.update_comment("p1", "c1", "u1", "new")
+
+    sql = mock_pool.fetchrow.call_args[0][0]
+    assert "edited_at = NOW()" in sql
+    assert "user_id = $3 AND deleted_at IS NULL" in sql
+    assert mock_pool.fetchrow.call_args[0][1:] == ("c1", "p1", "u1", "new")
+
+@pytest.mark.asyncio
+async def test_delete_comment():
+    mock_pool = AsyncMock()
+    mock_pool.fetchval.return_value = "tombstoned"
+    repo = PostRepository(mock_pool)
+
+    result = await repo.delete_comment("p1", "c1", "u1")
+
+    sql = mock_pool.fetchval.call_args[0][0]
+    assert "comments.user_id = $3 OR posts.user_id = $3" in sql
+    assert "UPDATE comments SET content = '', deleted_at = NOW()" in sql
+    assert "DELETE FROM comments" in sql
+    assert mock_pool.fetchval.call_args[0][1:] == ("c1", "p1", "u1")
+    assert result == "tombstoned"
+
+@pytest.mark.asyncio
+async def test_get_replies():
+    mock_pool = AsyncMock()
+    repo = PostRepository(mock_pool)
+
+    await repo.get_replies(["c1", "c2"], "u1")
+
+    sql = mock_pool.fetch.call_args[0][0]
+    assert "root_id = ANY($1::uuid[])" in sql
+    assert "ORDER BY created_at ASC" in sql
+    assert "FROM comment_reactions WHERE comment_id = comments.id AND user_id = $2) AS my_reaction" in sql
+    assert mock_pool.fetch.call_args[0][1:] == (["c1", "c2"], "u1")
+
 @pytest.mark.asyncio
 async def test_get_comments():
     mock_pool = AsyncMock()
     mock_pool.fetch.return_value = [{"id": "c1"}, {"id": "c2"}]
     repo = PostRepository(mock_pool)
     
-    comments = await repo.get_comments("p1", 2, 10)
+    comments = await repo.get_comments("p1", 2, 10, "u1")
     
     sql = mock_pool.fetch.call_args[0][0]
-    assert "WHERE post_id = $1" in sql
-    assert mock_pool.fetch.call_args[0][1:] == ("p1", 10, 10)
+    assert "WHERE comments.post_id = $1" in sql
+    assert "posts.hidden_at IS NULL AND (NOT posts.is_private OR posts.user_id = $4)" in sql
+    assert "parent_id IS NULL" not in sql
+    assert "AS reactions" in sql
+    assert mock_pool.fetch.call_args[0][1:] == ("p1", 10, 10, "u1")
+
+@pytest.mark.asyncio
+async def test_get_comments_roots_only():
+    mock_pool = AsyncMock()
+    repo = PostRepository(mock_pool)
+
+    await repo.get_comments("p1", 1, 10, "u1", roots_only=True)
+    await repo.get_total_comments("p1", "u1", roots_only=True)
+
+    assert "WHERE comments.post_id = $1 AND comments.parent_id IS NULL" in mock_pool.fetch.call_args[0][0]
+    assert "parent_id IS NULL" in mock_pool.fetchval.call_args[0][0]
+
+@pytest.mark.asyncio
+async def test_get_comments_after():
+    mock_pool = AsyncMock()
+    repo = PostRepository(mock_pool)
+    created_at = datetime.datetime(2024, 5, 1, tzinfo=datetime.timezone.utc)
+
+    await repo.get_comments_after("p1", 21, "u1", after=Position(created_at, "c9"))
+
+    sql = mock_pool.fetch.call_args[0][0]
+    assert "WHERE comments.post_id = $1" in sql
+    assert "(NOT posts.is_private OR posts.user_id = $5)" in sql
+    assert "(comments.created_at, comments.id) < ($2, $3::uuid)" in sql
+    assert mock_pool.fetch.call_args[0][1:] == ("p1", created_at, "c9", 21, "u1")
 
 @pytest.mark.asyncio
 async def test_get_total_comments():
@@ -139,8 +306,288 @@ async def test_get_total_comments():
     mock_pool.fetchval.return_value = 5
     repo = PostRepository(mock_pool)
     
-    total = await repo.get_total_comments("p1")
+    total = await repo.get_total_comments("p1", "u1")
     
     sql = mock_pool.fetchval.call_args[0][0]
-    assert "COUNT(*) FROM comments" in sql
-    assert mock_pool.fetchval.call_args[0][1] == "p1"
\ No newline at end of file
+    assert "COUNT(*) FROM comments JOIN posts ON posts.id = comments.post_id" in sql
+    assert "posts.hidden_at IS NULL AND (NOT posts.is_private OR posts.user_id = $2)" in sql
+    assert mock_pool.fetchval.call_args[0][1:] == ("p1", "u1")
+
+@pytest.mark.asyncio
+async def test_like_post():
+    mock_pool = AsyncMock()
+    mock_pool.fetchrow.return_value = {"like_count": 1, "changed": True}
+    repo = PostRepository(mock_pool)
+
+    result = await repo.like_post("post123", "user123")
+
+    sql = mock_pool.fetchrow.call_args[0][0]
+    assert "INSERT INTO likes" in sql
+    assert "ON CONFLICT DO NOTHING" in sql
+    assert "like_count = like_count + (SELECT COUNT(*) FROM inserted)" in sql
+    assert "(NOT is_private OR user_id = $2)" in sql
+    assert mock_pool.fetchrow.call_args[0][1:] == ("post123", "user123")
+    assert result == {"like_count": 1, "changed": True}
+
+@pytest.mark.asyncio
+async def test_unlike_post():
+    mock_pool = AsyncMock()
+    repo = PostRepository(mock_pool)
+
+    await repo.unlike_post("post123", "user123")
+
+    sql = mock_pool.fetchrow.call_args[0][0]
+    assert "DELETE FROM likes" in sql
+    assert "like_count = like_count - (SELECT COUNT(*) FROM deleted)" in sql
+    assert mock_pool.fetchrow.call_args[0][1:] == ("post123", "user123")
+
+@pytest.mark.asyncio
+async def test_set_post_reaction():
+    mock_pool = AsyncMock()
+    mock_pool.fetchrow.return_value = {"found": True, "previous": "👍"}
+    repo = PostRepository(mock_pool)
+
+    result = await repo.set_reaction("post", "post123", "user123", "❤️")
+
+    sql = mock_pool.fetchrow.call_args[0][0]
+    assert "SELECT id FROM posts WHERE id = $1 AND hidden_at IS NULL AND (NOT is_private OR user_id = $2)" in sql
+    assert "INSERT INTO post_reactions (post_id, user_id, reaction)" in sql
+    assert "ON CONFLICT (post_id, user_id) DO UPDATE SET reaction = EXCLUDED.reaction" in sql
+    assert mock_pool.fetchrow.call_args[0][1:] == ("post123", "user123", "❤️")
+    assert result["previous"] == "👍"
+
+@pytest.mark.asyncio
+async def test_set_comment_reaction():
+    mock_pool = AsyncMock()
+    repo = PostRepository(mock_pool)
+
+    await repo.set_reaction("comment", "c1", "user123", "😂", post_id="post123")
+
+    sql = mock_pool.fetchrow.call_args[0][0]
+    assert "comments.post_id = $4 AND comments.deleted_at IS NULL" in sql
+    assert "INSERT INTO comment_reactions (comment_id, user_id, reaction)" in sql
+    assert mock_pool.fetchrow.call_args[0][1:] == ("c1", "user123", "😂", "post123")
+
+@pytest.mark.asyncio
+async def test_remove_comment_reaction():
+    mock_pool = AsyncMock()
+    repo = PostRepository(mock_pool)
+
+    await repo.remove_reaction("comment", "c1", "user123", post_id="post123")
+
+    sql = mock_pool.fetchrow.call_args[0][0]
+    assert "comments.post_id = $3" in sql
+    assert "DELETE FROM comment_reactions WHERE comment_id = (SELECT id FROM target) AND user_id = $2" in sql
+    assert mock_pool.fetchrow.call_args[0][1:] == ("c1", "user123", "post123")
+
+@pytest.mark.asyncio
+async def test_get_reactions():
+    mock_pool = AsyncMock()
+    repo = PostRepository(mock_pool)
+
+    await repo.get_reactions("post", "post123", "user123")
+
+    sql = mock_pool.fetchrow.call_args[0][0]
+    assert "json_object_agg(reaction, count)" in sql
+    assert "WHERE post_id = $1::uuid AND user_id = $2) AS my_reaction" in sql
+    assert mock_pool.fetchrow.call_args[0][1:] == ("post123", "user123")
+
+@pytest.mark.asyncio
+async def test_bookmark_post():
+    mock_pool = AsyncMock()
+    repo = PostRepository(mock_pool)
+
+    await repo.bookmark_post("post123", "user123", "collection123")
+
+    sql = mock_pool.fetchrow.call_args[0][0]
+    assert "INSERT INTO bookmarks" in sql
+    assert "ON CONFLICT (user_id, post_id) DO UPDATE SET collection_id = EXCLUDED.collection_id" in sql
+    assert "(NOT is_private OR user_id = $2)" in sql
+    assert "FROM bookmark_collections WHERE id = $3::uuid AND user_id = $2" in sql
+    assert mock_pool.fetchrow.call_args[0][1:] == ("post123", "user123", "collection123")
+
+@pytest.mark.asyncio
+async def test_list_bookmarks_after():
+    mock_pool = AsyncMock()
+    repo = PostRepository(mock_pool)
+    after = Position(datetime.datetime(2024, 6, 1), "post9")
+
+    await repo.list_bookmarks("user123", limit=11, after=after)
+
+    sql = mock_pool.fetch.call_args[0][0]
+    assert "JOIN posts ON posts.id = bookmarks.post_id" in sql
+    assert "(NOT posts.is_private OR posts.user_id = $1)" in sql
+    assert "(bookmarks.created_at, bookmarks.post_id) < ($3, $4::uuid)" in sql
+    assert "ORDER BY bookmarks.created_at DESC, bookmarks.post_id DESC" in sql
+    assert mock_pool.fetch.call_args[0][1:] == ("user123", None, datetime.datetime(2024, 6, 1), "post9", 11)
+
+@pytest.mark.asyncio
+async def test_create_bookmark_collection_duplicate():
+    mock_pool = AsyncMock()
+    mock_pool.fetchrow.return_value = None
+    repo = PostRepository(mock_pool)
+
+    result = await repo.create_bookmark_collection("user123", "Рецепты")
+
+    assert "ON CONFLICT (user_id, name) DO NOTHING" in mock_pool.fetchrow.call_args[0][0]
+    assert result is None
+
+@pytest.mark.asyncio
+async def test_search_posts():
+    mock_pool = AsyncMock()
+    mock_pool.fetch.side_effect = [
+        [{"id": "p1", "title_snippet": "\x02Go\x03 <3", "description_snippet": "about \x02go\x03"}],
+        [{"tag": "go", "count": 1}],
+    ]
+    mock_pool.fetchval.return_value = 1
+    repo = PostRepository(mock_pool)
+
+    hits, total, facets = await repo.search_posts("go", "user123", page=2, page_size=5, tags=["backend"])
+
+    sql = mock_pool.fetch.call_args_list[0][0][0]
+    assert "websearch_to_tsquery('simple', $1)" in sql
+    assert "(NOT is_private OR user_id = $2)" in sql
+    assert "tags @> $3::text[]" in sql
+    assert "ORDER BY rank DESC" in sql
+    args = mock_pool.fetch.call_args_list[0][0][1:]
+    assert args[:3] == ("go", "user123", ["backend"])
+    assert args[-2:] == (5, 5)
+
+    assert "unnest(tags)" in mock_pool.fetch.call_args_list[1][0][0]
+    assert mock_pool.fetch.call_args_list[1][0][1:] == ("go", "user123", ["backend"])
+    assert mock_pool.fetchval.call_args[0][1:] == ("go", "user123", ["backend"])
+
+    assert hits[0]["title_snippet"] == "<mark>Go</mark> &lt;3"
+    assert hits[0]["description_snippet"] == "about <mark>go</mark>"
+    assert total == 1
+    assert facets == [{"tag": "go", "count": 1}]
+
+@pytest.mark.asyncio
+async def test_create_post_checks_suspension():
+    mock_pool = AsyncMock()
+    mock_pool.fetchrow.return_value = None
+    repo = PostRepository(mock_pool)
+
+    result = await repo.create_post("Title", "", "user123", False, [])
+
+    sql = mock_pool.fetchrow.call_args[0][0]
+    assert "action = 'suspend'" in sql
+    assert "expires_at > NOW()" in sql
+    assert result is None
+
+@pytest.mark.asyncio
+async def test_hidden_content_filtered():
+    mock_pool = AsyncMock()
+    repo = PostRepository(mock_pool)
+
+    await repo.get_post("post123", "user123")
+    assert "hidden_at IS NULL" in mock_pool.fetchrow.call_args[0][0]
+
+    await repo.get_comments("post123", 1, 10, "user123")
+    assert "hidden_at IS NULL" in mock_pool.fetch.call_args[0][0]
+
+@pytest.mark.asyncio
+async def test_hidden_targets_cannot_be_liked_reacted_or_bookmarked():
+    mock_pool = AsyncMock()
+    repo = PostRepository(mock_pool)
+
+    writes = [
+        repo.like_post("post123", "user123"),
+        repo.unlike_post("post123", "user123"),
+        repo.set_reaction("post", "post123", "user123", "👍"),
+        repo.remove_reaction("comment", "comment123", "user123", post_id="post123"),
+        repo.bookmark_post("post123", "user123"),
+    ]
+    for write in writes:
+        await write
+        target = mock_pool.fetchrow.call_args[0][0].split("), ")[0]
+        assert "hidden_at IS NULL" in target
+
+    await repo.set_reaction("comment", "comment123", "user123", "👍", post_id="post123")
+    target = mock_pool.fetchrow.call_args[0][0]
+    assert "comments.hidden_at IS NULL AND posts.hidden_at IS NULL" in target
+
+@pytest.mark.asyncio
+async def test_writes_check_suspension_of_acting_user():
+    mock_pool = AsyncMock()
+    mock_pool.fetchrow.return_value = {"title": "", "description": "", "is_private": False, "tags": []}
+    repo = PostRepository(mock_pool)
+
+    writes = [
+        repo.update_post("post123", "user123", {"title": "New"}),
+        repo.update_comment("post123", "comment123", "user123", "new"),
+        repo.like_post("post123", "user123"),
+        repo.unlike_post("post123", "user123"),
+        repo.set_reaction("post", "post123", "user123", "👍"),
+        repo.remove_reaction("comment", "comment123", "user123", post_id="post123"),
+        repo.create_report("user123", "post", "post456", "spam", ""),
+        repo.create_report("user123", "user", "user456", "spam", ""),
+    ]
+    for write in writes:
+        await write
+        sql, *args = mock_pool.fetchrow.call_args[0]
+        param = re.search(r"subject_id = \$(\d+)", sql).group(1)
+        assert args[int(param) - 1] == "user123"
+
+@pytest.mark.asyncio
+async def test_is_suspended():
+    mock_pool = AsyncMock()
+    repo = PostRepository(mock_pool)
+
+    mock_pool.fetchval.return_value = False
+    assert await repo.is_suspended("user123") is True
+    mock_pool.fetchval.return_value = True
+    assert await repo.is_suspended("user123") is False
+    assert mock_pool.fetchval.call_args[0][1:] == ("user123",)
+
+@pytest.mark.asyncio
+async def test_create_report():
+    mock_pool = AsyncMock()
+    repo = PostRepository(mock_pool)
+
+    await repo.create_report("user123", "comment", "comment123", "spam", "")
+
+    sql = mock_pool.fetchrow.call_args[0][0]
+    assert "FROM comments" in sql
+    assert "ON CONFLICT (reporter_id, target_type, target_id) WHERE status = 'open' DO NOTHING" in sql
+    assert "false AS created" in sql
+    assert mock_pool.fetchrow.call_args[0][1:] == ("user123", "comment", "comment123", "spam", "")
+
+@pytest.mark.asyncio
+async def test_moderate_delete_post():
+    mock_pool = AsyncMock()
+    repo = PostRepository(mock_pool)
+
+    await repo.moderate("mod123", "post", "post123", "delete", note="spam")
+
+    sql = mock_pool.fetchrow.call_args[0][0]
+    assert "DELETE FROM comments WHERE post_id = (SELECT id FROM target)" in sql
+    assert "DELETE FROM posts WHERE id = (SELECT id FROM target)" in sql
+    assert "INSERT INTO moderation_decisions" in sql
+    assert "UPDATE reports SET status = 'resolved'" in sql
+    assert mock_pool.fetchrow.call_args[0][1:] == ("mod123", "post", "post123", "delete", "spam", 0)
+
+@pytest.mark.asyncio
+async def test_moderate_suspend_has_no_effects():
+    mock_pool = AsyncMock()
+    repo = PostRepository(mock_pool)
+
+    await repo.moderate("mod123", "user", "user123", "suspend", duration_hours=24)
+
+    sql = mock_pool.fetchrow.call_args[0][0]
+    assert "effect0" not in sql
+    assert "make_interval(hours => $6::integer)" in sql
+    assert mock_pool.fetchrow.call_args[0][-1] == 24
+
+@pytest.mark.asyncio
+async def test_list_moderation_queue_after():
+    mock_pool = AsyncMock()
+    repo = PostRepository(mock_pool)
+    after = Position(datetime.datetime(2024, 6, 1), "post9")
+
+    await repo.list_moderation_queue(limit=11, after=after, target_type="post")
+
+    sql = mock_pool.fetch.call_args[0][0]
+    assert "WHERE status = 'open'" in sql
+    assert "(cases.first_reported_at, cases.id) > ($2, $3::uuid)" in sql
+    assert mock_pool.fetch.call_args[0][1:] == ("post", datetime.datetime(2024, 6, 1), "post9", 11)
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nanoservices/pkg/health"
+	"github.com/nanoservices/pkg/pubsub"
+)
+
+// eventBroker is the message broker selected by EVENT_BROKER.
+type eventBroker struct {
+	name      string
+	publisher pubsub.EventPublisher
+	// live receives every interaction event, it feeds the live stats hub.
+	live  pubsub.EventSubscriber
+	check health.Check
+}
+
+// newEventBroker connects to kafka (the default), nats, a lightweight broker
+// for local development, or memory, which keeps events in the process.
+func newEventBroker(kind string) (*eventBroker, error) {
+	switch kind {
+	case "", "kafka":
+		brokers := strings.Split(getenv("KAFKA_BROKERS", "kafka:9092"), ",")
+		publisher, err := pubsub.NewKafkaPublisher(pubsub.KafkaConfig{
+			Brokers:      brokers,
+			RequiredAcks: os.Getenv("KAFKA_ACKS"),
+		})
+		if err != nil {
+			return nil, err
+		}
+		host, _ := os.Hostname()
+		live := pubsub.NewKafkaSubscriber(pubsub.KafkaSubscriberConfig{
+			Brokers:    brokers,
+			GroupID:    "gateway-live-" + host,
+			FromLatest: true,
+		})
+		return &eventBroker{name: "kafka", publisher: publisher, live: live, check: kafkaCheck(brokers)}, nil
+	case "nats":
+		conn, err := pubsub.NewNATS(pubsub.NATSConfig{URL: getenv("NATS_URL", "nats://nats:4222"), Name: "gateway"})
+		if err != nil {
+			return nil, err
+		}
+		return &eventBroker{name: "nats", publisher: conn, live: conn, check: conn.Check}, nil
+	case "memory":
+		m := pubsub.NewMemory()
+		return &eventBroker{name: "memory", publisher: m, live: m, check: func(context.Context) error { return nil }}, nil
+	}
+	return nil, fmt.Errorf("unknown EVENT_BROKER %q, expected kafka, nats or memory", kind)
+}
+
+func (b *eventBroker) Close() error {
+	if any(b.live) == any(b.publisher) {
+		return b.publisher.Close()
+	}
+	return errors.Join(b.publisher.Close(), b.live.Close())
+}
+
+func getenv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
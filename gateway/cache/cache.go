@@ -0,0 +1,339 @@
+package cache
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nanoservices/pkg/logging"
+)
+
+type Config struct {
+	TTL                  time.Duration
+	StaleWhileRevalidate time.Duration
+}
+
+type Stats struct {
+	Hits          uint64 `json:"hits"`
+	StaleHits     uint64 `json:"stale_hits"`
+	Misses        uint64 `json:"misses"`
+	Revalidations uint64 `json:"revalidations"`
+	Evictions     uint64 `json:"evictions"`
+	Entries       int    `json:"entries"`
+	Bytes         int64  `json:"bytes"`
+}
+
+type entry struct {
+	key         string
+	contentType string
+	body        []byte
+	etag        string
+	storedAt    time.Time
+	cfg         Config
+}
+
+func (e *entry) size() int64 {
+	return int64(len(e.key) + len(e.contentType) + len(e.body) + len(e.etag))
+}
+
+func (e *entry) age(now time.Time) time.Duration {
+	return now.Sub(e.storedAt)
+}
+
+// Store is an LRU response cache bounded by the total size of cached bodies.
+type Store struct {
+	maxBytes int64
+
+	mu           sync.Mutex
+	size         int64
+	ll           *list.List
+	items        map[string]*list.Element
+	revalidating map[string]struct{}
+
+	hits          atomic.Uint64
+	staleHits     atomic.Uint64
+	misses        atomic.Uint64
+	revalidations atomic.Uint64
+	evictions     atomic.Uint64
+
+	now func() time.Time
+}
+
+func NewStore(maxBytes int64) *Store {
+	return &Store{
+		maxBytes:     maxBytes,
+		ll:           list.New(),
+		items:        make(map[string]*list.Element),
+		revalidating: make(map[string]struct{}),
+		now:          time.Now,
+	}
+}
+
+func (s *Store) Stats() Stats {
+	s.mu.Lock()
+	entries, size := s.ll.Len(), s.size
+	s.mu.Unlock()
+
+	return Stats{
+		Hits:          s.hits.Load(),
+		StaleHits:     s.staleHits.Load(),
+		Misses:        s.misses.Load(),
+		Revalidations: s.revalidations.Load(),
+		Evictions:     s.evictions.Load(),
+		Entries:       entries,
+		Bytes:         size,
+	}
+}
+
+func (s *Store) get(key string) *entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.items[key]
+	if !ok {
+		return nil
+	}
+	e := el.Value.(*entry)
+	if e.age(s.now()) > e.cfg.TTL+e.cfg.StaleWhileRevalidate {
+		s.removeElement(el)
+		return nil
+	}
+	s.ll.MoveToFront(el)
+	return e
+}
+
+func (s *Store) set(e *entry) {
+	if e.size() > s.maxBytes {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.items[e.key]; ok {
+		s.removeElement(el)
+	}
+	s.items[e.key] = s.ll.PushFront(e)
+	s.size += e.size()
+
+	for s.size > s.maxBytes {
+		oldest := s.ll.Back()
+		if oldest == nil {
+			break
+		}
+		s.removeElement(oldest)
+		s.evictions.Add(1)
+	}
+}
+
+func (s *Store) removeElement(el *list.Element) {
+	e := el.Value.(*entry)
+	s.ll.Remove(el)
+	delete(s.items, e.key)
+	s.size -= e.size()
+}
+
+func (s *Store) startRevalidation(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.revalidating[key]; ok {
+		return false
+	}
+	s.revalidating[key] = struct{}{}
+	return true
+}
+
+func (s *Store) finishRevalidation(key string) {
+	s.mu.Lock()
+	delete(s.revalidating, key)
+	s.mu.Unlock()
+}
+
+// Middleware caches successful GET responses of the wrapped route. The cache
+// key is the request path together with its sorted query parameters, so
+// routes must not return user-specific data.
+func (s *Store) Middleware(cfg Config) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if c.Request().Method != http.MethodGet {
+				return next(c)
+			}
+
+			key := cacheKey(c.Request())
+			if e := s.get(key); e != nil {
+				if e.age(s.now()) <= e.cfg.TTL {
+					s.hits.Add(1)
+					return s.serve(c, e, "HIT")
+				}
+
+				s.staleHits.Add(1)
+				if s.startRevalidation(key) {
+					go s.revalidate(detach(c), next, key, cfg)
+				}
+				return s.serve(c, e, "STALE")
+			}
+
+			s.misses.Add(1)
+			return s.fill(c, next, key, cfg)
+		}
+	}
+}
+
+func (s *Store) serve(c echo.Context, e *entry, state string) error {
+	maxAge := e.cfg.TTL - e.age(s.now())
+	if maxAge < 0 {
+		maxAge = 0
+	}
+
+	h := c.Response().Header()
+	h.Set("X-Cache", state)
+	h.Set(echo.HeaderCacheControl, cacheControl(maxAge, e.cfg.StaleWhileRevalidate))
+	h.Set("ETag", e.etag)
+
+	if etagMatches(c.Request().Header.Get("If-None-Match"), e.etag) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	return c.Blob(http.StatusOK, e.contentType, e.body)
+}
+
+func (s *Store) fill(c echo.Context, next echo.HandlerFunc, key string, cfg Config) error {
+	res := c.Response()
+	original := res.Writer
+	rec := newRecorder()
+	res.Writer = rec
+
+	err := next(c)
+	res.Writer = original
+	if err != nil {
+		return err
+	}
+
+	copyHeader(original.Header(), rec.header)
+	if rec.status != http.StatusOK {
+		original.WriteHeader(rec.status)
+		_, err = original.Write(rec.body.Bytes())
+		return err
+	}
+
+	e := s.newEntry(key, rec, cfg)
+	s.set(e)
+
+	h := original.Header()
+	h.Set("X-Cache", "MISS")
+	h.Set(echo.HeaderCacheControl, cacheControl(cfg.TTL, cfg.StaleWhileRevalidate))
+	h.Set("ETag", e.etag)
+	if etagMatches(c.Request().Header.Get("If-None-Match"), e.etag) {
+		h.Del(echo.HeaderContentType)
+		original.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	original.WriteHeader(http.StatusOK)
+	_, err = original.Write(e.body)
+	return err
+}
+
+// detach copies the request state needed to re-run a handler into a new
+// context, since echo reuses c once the current request completes.
+func detach(c echo.Context) echo.Context {
+	req := c.Request().Clone(context.WithoutCancel(c.Request().Context()))
+	req.Header.Del("If-None-Match")
+
+	rc := c.Echo().NewContext(req, newRecorder())
+	rc.SetPath(c.Path())
+	rc.SetParamNames(c.ParamNames()...)
+	rc.SetParamValues(c.ParamValues()...)
+	rc.Set("user_id", c.Get("user_id"))
+	return rc
+}
+
+func (s *Store) revalidate(c echo.Context, next echo.HandlerFunc, key string, cfg Config) {
+	defer s.finishRevalidation(key)
+	s.revalidations.Add(1)
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), 10*time.Second)
+	defer cancel()
+	c.SetRequest(c.Request().WithContext(ctx))
+
+	if err := next(c); err != nil {
+		logging.For("cache").ErrorContext(ctx, "Cache revalidation failed", "key", key, "error", err)
+		return
+	}
+	rec := c.Response().Writer.(*recorder)
+	if rec.status != http.StatusOK {
+		return
+	}
+	s.set(s.newEntry(key, rec, cfg))
+}
+
+func (s *Store) newEntry(key string, rec *recorder, cfg Config) *entry {
+	body := append([]byte(nil), rec.body.Bytes()...)
+	sum := sha1.Sum(body)
+	return &entry{
+		key:         key,
+		contentType: rec.header.Get(echo.HeaderContentType),
+		body:        body,
+		etag:        `"` + hex.EncodeToString(sum[:]) + `"`,
+		storedAt:    s.now(),
+		cfg:         cfg,
+	}
+}
+
+func cacheKey(r *http.Request) string {
+	return r.URL.Path + "?" + r.URL.Query().Encode()
+}
+
+func cacheControl(maxAge, swr time.Duration) string {
+	return fmt.Sprintf("private, max-age=%d, stale-while-revalidate=%d",
+		int(maxAge.Seconds()), int(swr.Seconds()))
+}
+
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func copyHeader(dst, src http.Header) {
+	for k, v := range src {
+		dst[k] = append([]string(nil), v...)
+	}
+}
+
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newRecorder() *recorder {
+	return &recorder{header: make(http.Header), status: http.StatusOK}
+}
+
+func (r *recorder) Header() http.Header {
+	return r.header
+}
+
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	return r.body.Write(b)
+}
@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestServer(store *Store, cfg Config, calls *atomic.Int32) *echo.Echo {
+	e := echo.New()
+	e.GET("/api/stats/top/posts", func(c echo.Context) error {
+		calls.Add(1)
+		return c.JSON(http.StatusOK, map[string]string{"metric": c.QueryParam("metric")})
+	}, store.Middleware(cfg))
+	return e
+}
+
+func doGet(e *echo.Echo, target string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Run("Hit after miss", func(t *testing.T) {
+		var calls atomic.Int32
+		store := NewStore(1 << 20)
+		e := newTestServer(store, Config{TTL: time.Minute}, &calls)
+
+		first := doGet(e, "/api/stats/top/posts?metric=likes", nil)
+		second := doGet(e, "/api/stats/top/posts?metric=likes", nil)
+
+		assert.Equal(t, http.StatusOK, first.Code)
+		assert.Equal(t, "MISS", first.Header().Get("X-Cache"))
+		assert.Equal(t, "HIT", second.Header().Get("X-Cache"))
+		assert.Equal(t, first.Body.String(), second.Body.String())
+		assert.Equal(t, int32(1), calls.Load())
+		assert.Equal(t, uint64(1), store.Stats().Hits)
+		assert.Equal(t, uint64(1), store.Stats().Misses)
+	})
+
+	t.Run("Query params are part of the key", func(t *testing.T) {
+		var calls atomic.Int32
+		store := NewStore(1 << 20)
+		e := newTestServer(store, Config{TTL: time.Minute}, &calls)
+
+		doGet(e, "/api/stats/top/posts?metric=likes&period=7d", nil)
+		doGet(e, "/api/stats/top/posts?period=7d&metric=likes", nil)
+		rec := doGet(e, "/api/stats/top/posts?metric=views&period=7d", nil)
+
+		assert.Equal(t, "MISS", rec.Header().Get("X-Cache"))
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("Conditional request returns 304", func(t *testing.T) {
+		var calls atomic.Int32
+		store := NewStore(1 << 20)
+		e := newTestServer(store, Config{TTL: time.Minute}, &calls)
+
+		first := doGet(e, "/api/stats/top/posts?metric=likes", nil)
+		rec := doGet(e, "/api/stats/top/posts?metric=likes", map[string]string{
+			"If-None-Match": first.Header().Get("ETag"),
+		})
+
+		assert.Equal(t, http.StatusNotModified, rec.Code)
+		assert.Empty(t, rec.Body.String())
+	})
+
+	t.Run("Stale entry is served and revalidated", func(t *testing.T) {
+		var calls atomic.Int32
+		store := NewStore(1 << 20)
+		now := time.Now()
+		store.now = func() time.Time { return now }
+		e := newTestServer(store, Config{TTL: time.Second, StaleWhileRevalidate: time.Minute}, &calls)
+
+		doGet(e, "/api/stats/top/posts?metric=likes", nil)
+		now = now.Add(2 * time.Second)
+		rec := doGet(e, "/api/stats/top/posts?metric=likes", nil)
+
+		assert.Equal(t, "STALE", rec.Header().Get("X-Cache"))
+		assert.Eventually(t, func() bool { return calls.Load() == 2 }, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Expired entry is refetched", func(t *testing.T) {
+		var calls atomic.Int32
+		store := NewStore(1 << 20)
+		now := time.Now()
+		store.now = func() time.Time { return now }
+		e := newTestServer(store, Config{TTL: time.Second, StaleWhileRevalidate: time.Second}, &calls)
+
+		doGet(e, "/api/stats/top/posts?metric=likes", nil)
+		now = now.Add(3 * time.Second)
+		rec := doGet(e, "/api/stats/top/posts?metric=likes", nil)
+
+		assert.Equal(t, "MISS", rec.Header().Get("X-Cache"))
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("Error responses are not cached", func(t *testing.T) {
+		store := NewStore(1 << 20)
+		e := echo.New()
+		var calls atomic.Int32
+		e.GET("/api/stats/top/users", func(c echo.Context) error {
+			calls.Add(1)
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "metric parameter is required"})
+		}, store.Middleware(Config{TTL: time.Minute}))
+
+		doGet(e, "/api/stats/top/users", nil)
+		rec := doGet(e, "/api/stats/top/users", nil)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, int32(2), calls.Load())
+	})
+}
+
+func TestStoreEviction(t *testing.T) {
+	store := NewStore(100)
+	cfg := Config{TTL: time.Minute}
+
+	store.set(&entry{key: "a", body: make([]byte, 40), storedAt: time.Now(), cfg: cfg})
+	store.set(&entry{key: "b", body: make([]byte, 40), storedAt: time.Now(), cfg: cfg})
+	store.get("a")
+	store.set(&entry{key: "c", body: make([]byte, 40), storedAt: time.Now(), cfg: cfg})
+
+	assert.NotNil(t, store.get("a"))
+	assert.Nil(t, store.get("b"))
+	assert.NotNil(t, store.get("c"))
+	assert.Equal(t, uint64(1), store.Stats().Evictions)
+	assert.LessOrEqual(t, store.Stats().Bytes, int64(100))
+}
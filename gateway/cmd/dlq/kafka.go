@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/nanoservices/pkg/pubsub"
+	"github.com/segmentio/kafka-go"
+)
+
+// readTopic reads every message currently in topic, partition by partition.
+// Messages published while it runs are not read.
+func readTopic(ctx context.Context, brokers []string, topic string) ([]pubsub.Message, error) {
+	conn, err := dialAny(ctx, brokers)
+	if err != nil {
+		return nil, err
+	}
+	partitions, err := conn.ReadPartitions(topic)
+	conn.Close()
+	if err != nil {
+		return nil, fmt.Errorf("read partitions of %s: %w", topic, err)
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].ID < partitions[j].ID })
+
+	var msgs []pubsub.Message
+	for _, p := range partitions {
+		read, err := readPartition(ctx, brokers, topic, p.ID)
+		if err != nil {
+			return nil, fmt.Errorf("read %s/%d: %w", topic, p.ID, err)
+		}
+		msgs = append(msgs, read...)
+	}
+	return msgs, nil
+}
+
+func readPartition(ctx context.Context, brokers []string, topic string, partition int) ([]pubsub.Message, error) {
+	leader, err := kafka.DialLeader(ctx, "tcp", brokers[0], topic, partition)
+	if err != nil {
+		return nil, err
+	}
+	first, last, err := leader.ReadOffsets()
+	leader.Close()
+	if err != nil || first >= last {
+		return nil, err
+	}
+
+	reader := kafka.NewReader(kafka.ReaderConfig{Brokers: brokers, Topic: topic, Partition: partition})
+	defer reader.Close()
+	if err := reader.SetOffset(first); err != nil {
+		return nil, err
+	}
+
+	var msgs []pubsub.Message
+	for {
+		msg, err := reader.ReadMessage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		headers := make([]pubsub.Header, len(msg.Headers))
+		for i, h := range msg.Headers {
+			headers[i] = pubsub.Header{Key: h.Key, Value: h.Value}
+		}
+		msgs = append(msgs, pubsub.Message{
+			Topic:     msg.Topic,
+			Key:       msg.Key,
+			Value:     msg.Value,
+			Headers:   headers,
+			Partition: msg.Partition,
+			Offset:    msg.Offset,
+			Time:      msg.Time,
+		})
+		if msg.Offset >= last-1 {
+			return msgs, nil
+		}
+	}
+}
+
+func dialAny(ctx context.Context, brokers []string) (*kafka.Conn, error) {
+	var errs []error
+	for _, broker := range brokers {
+		conn, err := kafka.DialContext(ctx, "tcp", broker)
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
+}
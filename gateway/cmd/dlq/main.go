@@ -0,0 +1,234 @@
+// Command dlq inspects the dead-letter topic of an event topic and replays
+// its messages back to the source topic.
+//
+//	go run ./cmd/dlq inspect -topic post_likes -error "invalid post_id"
+//	go run ./cmd/dlq replay -topic post_likes -since 24h -dry-run
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nanoservices/pkg/pubsub"
+)
+
+const usage = `usage: dlq inspect|replay -topic <topic> [flags]
+
+inspect lists the messages of the dead-letter topic that match the filters,
+replay publishes them to the topic they were consumed from.
+`
+
+const replayBatch = 100
+
+type filter struct {
+	err      string
+	key      string
+	consumer string
+	since    time.Time
+	limit    int
+}
+
+func (f filter) match(msg pubsub.Message, d pubsub.DeadLetter) bool {
+	switch {
+	case f.err != "" && !strings.Contains(d.Err, f.err):
+		return false
+	case f.key != "" && string(msg.Key) != f.key:
+		return false
+	case f.consumer != "" && d.Consumer != f.consumer:
+		return false
+	case !f.since.IsZero() && d.At.Before(f.since):
+		return false
+	}
+	return true
+}
+
+type deadLetter struct {
+	msg pubsub.Message
+	pubsub.DeadLetter
+}
+
+// selectMessages parses the dead-letter messages and keeps the ones matching
+// f. Messages without valid failure headers are reported and skipped.
+func selectMessages(msgs []pubsub.Message, f filter, errOut io.Writer) []deadLetter {
+	var out []deadLetter
+	for _, msg := range msgs {
+		if f.limit > 0 && len(out) == f.limit {
+			break
+		}
+		d, err := pubsub.ParseDeadLetter(msg)
+		if err != nil {
+			fmt.Fprintf(errOut, "skipping %s/%d@%d: %v\n", msg.Topic, msg.Partition, msg.Offset, err)
+			continue
+		}
+		if f.match(msg, d) {
+			out = append(out, deadLetter{msg: msg, DeadLetter: d})
+		}
+	}
+	return out
+}
+
+func inspect(letters []deadLetter, asJSON bool, out io.Writer) error {
+	if asJSON {
+		enc := json.NewEncoder(out)
+		for _, l := range letters {
+			if err := enc.Encode(map[string]any{
+				"partition":          l.msg.Partition,
+				"offset":             l.msg.Offset,
+				"key":                string(l.msg.Key),
+				"value":              json.RawMessage(jsonValue(l.msg.Value)),
+				"error":              l.Err,
+				"attempts":           l.Attempts,
+				"consumer":           l.Consumer,
+				"failed_at":          l.At,
+				"original_topic":     l.OriginalTopic,
+				"original_partition": l.OriginalPartition,
+				"original_offset":    l.OriginalOffset,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "OFFSET\tORIGINAL\tKEY\tATTEMPTS\tFAILED AT\tCONSUMER\tERROR")
+	for _, l := range letters {
+		fmt.Fprintf(w, "%d/%d\t%s/%d@%d\t%s\t%d\t%s\t%s\t%s\n",
+			l.msg.Partition, l.msg.Offset, l.OriginalTopic, l.OriginalPartition, l.OriginalOffset,
+			l.msg.Key, l.Attempts, l.At.Format(time.RFC3339), l.Consumer, l.Err)
+	}
+	return w.Flush()
+}
+
+// jsonValue keeps JSON values as they are and quotes anything else, a
+// message may have been dead-lettered because it is not JSON.
+func jsonValue(value []byte) []byte {
+	if json.Valid(value) {
+		return value
+	}
+	quoted, _ := json.Marshal(string(value))
+	return quoted
+}
+
+// replay publishes the messages to their source topics in the order they
+// were dead-lettered, so messages with the same key keep their order.
+func replay(ctx context.Context, letters []deadLetter, pub pubsub.EventPublisher, dryRun bool, out io.Writer) error {
+	batch := make([]pubsub.Message, 0, replayBatch)
+	flush := func() error {
+		if len(batch) == 0 || dryRun {
+			return nil
+		}
+		err := pub.Publish(ctx, batch...)
+		batch = batch[:0]
+		return err
+	}
+
+	for i, l := range letters {
+		msg, err := pubsub.Replay(l.msg)
+		if err != nil {
+			return err
+		}
+		if dryRun {
+			fmt.Fprintf(out, "would replay %d/%d to %s key=%s\n", l.msg.Partition, l.msg.Offset, msg.Topic, msg.Key)
+		}
+		batch = append(batch, msg)
+		if len(batch) == replayBatch {
+			if err := flush(); err != nil {
+				return fmt.Errorf("replayed %d of %d messages: %w", i+1-replayBatch, len(letters), err)
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return fmt.Errorf("replayed %d of %d messages: %w", len(letters)-len(batch), len(letters), err)
+	}
+
+	if dryRun {
+		fmt.Fprintf(out, "%d messages would be replayed\n", len(letters))
+	} else {
+		fmt.Fprintf(out, "%d messages replayed\n", len(letters))
+	}
+	return nil
+}
+
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid -since %q, expected a duration like 24h or an RFC 3339 time", s)
+	}
+	return t, nil
+}
+
+func main() {
+	if len(os.Args) < 2 || (os.Args[1] != "inspect" && os.Args[1] != "replay") {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	command := os.Args[1]
+
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	defaultBrokers := os.Getenv("KAFKA_BROKERS")
+	if defaultBrokers == "" {
+		defaultBrokers = "localhost:9092"
+	}
+	brokers := flags.String("brokers", defaultBrokers, "comma-separated Kafka brokers")
+	topic := flags.String("topic", "", "source topic or its dead-letter topic")
+	var f filter
+	flags.StringVar(&f.err, "error", "", "only messages whose error contains this text")
+	flags.StringVar(&f.key, "key", "", "only messages with this key")
+	flags.StringVar(&f.consumer, "consumer", "", "only messages dead-lettered by this consumer")
+	since := flags.String("since", "", "only messages dead-lettered after this time or in this last duration, e.g. 24h")
+	flags.IntVar(&f.limit, "limit", 0, "stop after this many matching messages")
+	asJSON := flags.Bool("json", false, "inspect: print one JSON object per message, with its value")
+	dryRun := flags.Bool("dry-run", false, "replay: print what would be replayed without publishing")
+	flags.Parse(os.Args[2:])
+
+	if *topic == "" {
+		fmt.Fprint(os.Stderr, usage)
+		flags.PrintDefaults()
+		os.Exit(2)
+	}
+	var err error
+	if f.since, err = parseSince(*since, time.Now()); err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	brokerList := strings.Split(*brokers, ",")
+	msgs, err := readTopic(ctx, brokerList, pubsub.DeadLetterTopic(*topic))
+	if err != nil {
+		log.Fatal(err)
+	}
+	letters := selectMessages(msgs, f, os.Stderr)
+
+	switch command {
+	case "inspect":
+		err = inspect(letters, *asJSON, os.Stdout)
+	case "replay":
+		var pub *pubsub.KafkaPublisher
+		if pub, err = pubsub.NewKafkaPublisher(pubsub.KafkaConfig{Brokers: brokerList}); err != nil {
+			break
+		}
+		err = errors.Join(replay(ctx, letters, pub, *dryRun, os.Stdout), pub.Close())
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
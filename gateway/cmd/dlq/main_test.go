@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nanoservices/pkg/pubsub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var failedAt = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func deadLetters() []pubsub.Message {
+	fail := func(key, value, err string, offset int64, at time.Time) pubsub.Message {
+		msg := pubsub.NewDeadLetter(
+			pubsub.Message{Topic: "post_likes", Key: []byte(key), Value: []byte(value), Offset: offset},
+			pubsub.Failure{Err: err, Attempts: 1, Consumer: "stats-service-group", At: at},
+		)
+		msg.Offset = offset / 10
+		return msg
+	}
+	return []pubsub.Message{
+		fail("p1", `{"post_id": "p1"}`, "missing user_id", 10, failedAt),
+		{Topic: "post_likes.dlq", Offset: 2, Value: []byte("no headers")},
+		fail("p2", `not json`, "invalid JSON", 30, failedAt.Add(time.Hour)),
+		fail("p1", `{"post_id": "p1", "user_id": ""}`, "missing user_id", 40, failedAt.Add(2*time.Hour)),
+	}
+}
+
+func TestSelectMessages(t *testing.T) {
+	var errOut bytes.Buffer
+	all := selectMessages(deadLetters(), filter{}, &errOut)
+	assert.Len(t, all, 3)
+	assert.Contains(t, errOut.String(), "skipping post_likes.dlq/0@2: missing dlq.original_topic header")
+
+	tests := []struct {
+		name string
+		f    filter
+		want []int64
+	}{
+		{"error", filter{err: "user_id"}, []int64{10, 40}},
+		{"key", filter{key: "p2"}, []int64{30}},
+		{"since", filter{since: failedAt.Add(30 * time.Minute)}, []int64{30, 40}},
+		{"consumer", filter{consumer: "other"}, nil},
+		{"limit", filter{err: "user_id", limit: 1}, []int64{10}},
+	}
+	for _, tt := range tests {
+		var offsets []int64
+		for _, l := range selectMessages(deadLetters(), tt.f, &bytes.Buffer{}) {
+			offsets = append(offsets, l.OriginalOffset)
+		}
+		assert.Equal(t, tt.want, offsets, tt.name)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	letters := selectMessages(deadLetters(), filter{key: "p2"}, &bytes.Buffer{})
+
+	var out bytes.Buffer
+	require.NoError(t, inspect(letters, false, &out))
+	assert.Equal(t, "OFFSET  ORIGINAL         KEY  ATTEMPTS  FAILED AT             CONSUMER             ERROR\n"+
+		"0/3     post_likes/0@30  p2   1         2026-03-01T13:00:00Z  stats-service-group  invalid JSON\n", out.String())
+
+	out.Reset()
+	require.NoError(t, inspect(letters, true, &out))
+	assert.JSONEq(t, `{"partition": 0, "offset": 3, "key": "p2", "value": "not json", "error": "invalid JSON",
+		"attempts": 1, "consumer": "stats-service-group", "failed_at": "2026-03-01T13:00:00Z",
+		"original_topic": "post_likes", "original_partition": 0, "original_offset": 30}`, out.String())
+}
+
+func TestReplay(t *testing.T) {
+	letters := selectMessages(deadLetters(), filter{err: "user_id"}, &bytes.Buffer{})
+	broker := pubsub.NewMemory()
+
+	var out bytes.Buffer
+	require.NoError(t, replay(context.Background(), letters, broker, true, &out))
+	assert.Empty(t, broker.Published("post_likes"))
+	assert.Equal(t, "would replay 0/1 to post_likes key=p1\nwould replay 0/4 to post_likes key=p1\n"+
+		"2 messages would be replayed\n", out.String())
+
+	out.Reset()
+	require.NoError(t, replay(context.Background(), letters, broker, false, &out))
+	published := broker.Published("post_likes")
+	require.Len(t, published, 2)
+	assert.Equal(t, `{"post_id": "p1"}`, string(published[0].Value))
+	assert.Empty(t, published[0].Header(pubsub.HeaderError))
+	assert.Equal(t, "2 messages replayed\n", out.String())
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+
+	since, err := parseSince("24h", now)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(-24*time.Hour), since)
+
+	since, err = parseSince("2026-03-01T00:00:00Z", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), since)
+
+	_, err = parseSince("yesterday", now)
+	assert.Error(t, err)
+}
@@ -0,0 +1,301 @@
+// Command openapigen builds openapi.yaml from the swagger document that
+// protoc-gen-openapiv2 generates for the transcoded routes and the
+// hand-written openapi/base.yaml.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi2"
+	"github.com/getkin/kin-openapi/openapi2conv"
+	"github.com/getkin/kin-openapi/openapi3"
+	"gopkg.in/yaml.v3"
+)
+
+const header = `# Сгенерировано go run ./cmd/openapigen из proto/*.proto и openapi/base.yaml, не редактировать вручную.
+`
+
+const successDescription = "Успешный запрос"
+
+var topLevelOrder = []string{"openapi", "info", "servers", "tags", "paths", "components"}
+
+// responseSchemas replaces the generated response schema of operations whose
+// body the gateway rewrites, see rewriteResponse in transcoding.go.
+var responseSchemas = map[string]string{
+	"PostService_DeletePost": "PostDeleted",
+}
+
+// queryEnumAliases are the extra values queryParser accepts besides the
+// lowercase enum names, see tagMatches in post_filters.go.
+var queryEnumAliases = map[string][]string{
+	"tag_match": {"any", "all"},
+}
+
+func main() {
+	swaggerPath := flag.String("swagger", "generated/api.swagger.json", "swagger document generated by protoc-gen-openapiv2")
+	basePath := flag.String("base", "openapi/base.yaml", "hand-written part of the specification")
+	outPath := flag.String("out", "openapi.yaml", "where to write the merged specification")
+	check := flag.Bool("check", false, "fail if the file at -out is not up to date instead of writing it")
+	flag.Parse()
+
+	swagger, err := os.ReadFile(*swaggerPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	base, err := os.ReadFile(*basePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	spec, err := build(swagger, base)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *check {
+		current, err := os.ReadFile(*outPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !bytes.Equal(current, spec) {
+			log.Fatalf("%s is out of date, run go run ./cmd/openapigen", *outPath)
+		}
+		return
+	}
+	if err := os.WriteFile(*outPath, spec, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// build converts the generated swagger document to OpenAPI 3, adds what the
+// gateway does around the transcoder and merges it into base.
+func build(swagger, base []byte) ([]byte, error) {
+	var doc2 openapi2.T
+	if err := json.Unmarshal(swagger, &doc2); err != nil {
+		return nil, fmt.Errorf("parse swagger: %w", err)
+	}
+	generated, err := openapi2conv.ToV3(&doc2)
+	if err != nil {
+		return nil, fmt.Errorf("convert swagger: %w", err)
+	}
+
+	doc, err := parseBase(base)
+	if err != nil {
+		return nil, fmt.Errorf("parse base: %w", err)
+	}
+
+	if err := merge(doc, generated); err != nil {
+		return nil, err
+	}
+
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	loader := openapi3.NewLoader()
+	loaded, err := loader.LoadFromData(out)
+	if err != nil {
+		return nil, fmt.Errorf("load merged specification: %w", err)
+	}
+	if err := loaded.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("validate merged specification: %w", err)
+	}
+	return toYAML(out)
+}
+
+// parseBase decodes base.yaml without resolving references, they may point
+// at schemas that only exist in the generated part.
+func parseBase(base []byte) (*openapi3.T, error) {
+	var raw any
+	if err := yaml.Unmarshal(base, &raw); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var doc openapi3.T
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+func merge(doc, generated *openapi3.T) error {
+	requestSchemas := map[string]bool{}
+
+	for path, item := range generated.Paths.Map() {
+		target := doc.Paths.Value(path)
+		if target == nil {
+			target = &openapi3.PathItem{}
+			doc.Paths.Set(path, target)
+		}
+		for method, op := range item.Operations() {
+			if target.GetOperation(method) != nil {
+				return fmt.Errorf("%s %s is defined both in proto and in base", method, path)
+			}
+			if op.RequestBody != nil && op.RequestBody.Value != nil {
+				delete(op.RequestBody.Value.Extensions, "x-originalParamName")
+				for _, media := range op.RequestBody.Value.Content {
+					if media.Schema != nil && media.Schema.Ref != "" {
+						requestSchemas[media.Schema.Ref] = true
+					}
+				}
+			}
+			adaptOperation(doc, op)
+			target.SetOperation(method, op)
+		}
+	}
+
+	for name, schema := range generated.Components.Schemas {
+		if _, ok := doc.Components.Schemas[name]; ok {
+			return fmt.Errorf("schema %s is defined both in proto and in base", name)
+		}
+		// The caller is taken from the token, not from the request body.
+		if requestSchemas["#/components/schemas/"+name] {
+			delete(schema.Value.Properties, "user_id")
+		}
+		int64Numbers(schema.Value)
+		doc.Components.Schemas[name] = schema
+	}
+
+	known := map[string]bool{}
+	for _, tag := range doc.Tags {
+		known[tag.Name] = true
+	}
+	for _, tag := range generated.Tags {
+		if !known[tag.Name] {
+			doc.Tags = append(doc.Tags, tag)
+		}
+	}
+	return nil
+}
+
+// adaptOperation describes what the gateway adds to a transcoded call:
+// authentication, the caller taken from the token and problem+json errors.
+func adaptOperation(doc *openapi3.T, op *openapi3.Operation) {
+	params := op.Parameters[:0]
+	for _, p := range op.Parameters {
+		if p.Value.Name == "user_id" {
+			continue
+		}
+		if p.Value.In == openapi3.ParameterInQuery && p.Value.Schema != nil {
+			widenEnum(p.Value.Schema.Value, queryEnumAliases[p.Value.Name])
+		}
+		for name, shared := range doc.Components.Parameters {
+			if shared.Value.Name == p.Value.Name && shared.Value.In == p.Value.In {
+				p = &openapi3.ParameterRef{Ref: "#/components/parameters/" + name}
+			}
+		}
+		params = append(params, p)
+	}
+	op.Parameters = params
+
+	op.Security = openapi3.NewSecurityRequirements().With(openapi3.SecurityRequirement{"BearerAuth": {}})
+
+	if op.Responses.Value("201") != nil {
+		op.Responses.Delete("200")
+	}
+	for _, resp := range op.Responses.Map() {
+		if d := resp.Value.Description; d == nil || *d == "" || *d == "A successful response." {
+			resp.Value.WithDescription(successDescription)
+		}
+	}
+	if name, ok := responseSchemas[op.OperationID]; ok {
+		resp := op.Responses.Value("200")
+		resp.Value.Content = openapi3.NewContentWithJSONSchemaRef(&openapi3.SchemaRef{Ref: "#/components/schemas/" + name})
+	}
+	op.Responses.Set("400", &openapi3.ResponseRef{Ref: "#/components/responses/BadRequest"})
+	op.Responses.Set("401", &openapi3.ResponseRef{Ref: "#/components/responses/Unauthorized"})
+	op.Responses.Set("404", &openapi3.ResponseRef{Ref: "#/components/responses/NotFound"})
+	op.Responses.Set("default", &openapi3.ResponseRef{Ref: "#/components/responses/Problem"})
+}
+
+// int64Numbers describes 64-bit integers as integers: protoc-gen-openapiv2
+// declares them strings as protojson writes them, the gateway writes numbers.
+func int64Numbers(schema *openapi3.Schema) {
+	if schema.Type.Is(openapi3.TypeString) && (schema.Format == "int64" || schema.Format == "uint64") {
+		schema.Type = &openapi3.Types{openapi3.TypeInteger}
+	}
+	for _, prop := range schema.Properties {
+		if prop.Value != nil && prop.Ref == "" {
+			int64Numbers(prop.Value)
+		}
+	}
+	if schema.Items != nil && schema.Items.Value != nil && schema.Items.Ref == "" {
+		int64Numbers(schema.Items.Value)
+	}
+}
+
+// widenEnum adds the lowercase forms of the enum names and aliases, the
+// gateway validates query parameters against the specification.
+func widenEnum(schema *openapi3.Schema, aliases []string) {
+	if len(schema.Enum) == 0 {
+		return
+	}
+	values := schema.Enum
+	for _, v := range schema.Enum {
+		if name, ok := v.(string); ok && strings.ToLower(name) != name {
+			values = append(values, strings.ToLower(name))
+		}
+	}
+	for _, alias := range aliases {
+		values = append(values, alias)
+	}
+	schema.Enum = values
+}
+
+// toYAML keeps the conventional order of the top-level sections, everything
+// below them is sorted by key.
+func toYAML(data []byte) ([]byte, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	root := node.Content[0]
+
+	rank := map[string]int{}
+	for i, key := range topLevelOrder {
+		rank[key] = i
+	}
+	pairs := make([][2]*yaml.Node, 0, len(root.Content)/2)
+	for i := 0; i < len(root.Content); i += 2 {
+		pairs = append(pairs, [2]*yaml.Node{root.Content[i], root.Content[i+1]})
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return rank[pairs[i][0].Value] < rank[pairs[j][0].Value]
+	})
+	root.Content = root.Content[:0]
+	for _, pair := range pairs {
+		root.Content = append(root.Content, pair[0], pair[1])
+	}
+	resetStyle(root)
+
+	var buf bytes.Buffer
+	buf.WriteString(header)
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(root); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// resetStyle drops the flow style and quoting the nodes inherit from JSON.
+func resetStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		resetStyle(c)
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAPIUpToDate(t *testing.T) {
+	swagger, err := os.ReadFile("../../generated/api.swagger.json")
+	require.NoError(t, err)
+	base, err := os.ReadFile("../../openapi/base.yaml")
+	require.NoError(t, err)
+	current, err := os.ReadFile("../../openapi.yaml")
+	require.NoError(t, err)
+
+	spec, err := build(swagger, base)
+	require.NoError(t, err)
+	assert.Equal(t, string(spec), string(current), "openapi.yaml is out of date, run go run ./cmd/openapigen")
+}
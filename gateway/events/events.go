@@ -0,0 +1,93 @@
+// Package events defines the envelope shared by all Kafka messages and the
+// JSON Schemas of their payloads.
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	UserRegistered  = "user.registered"
+	PostViewed      = "post.viewed"
+	PostLiked       = "post.liked"
+	PostUnliked     = "post.unliked"
+	PostCommented   = "post.commented"
+	ReactionAdded   = "reaction.added"
+	ReactionRemoved = "reaction.removed"
+)
+
+// Envelope wraps every event. Version is the version of the payload schema,
+// consumers should check it before decoding the payload.
+type Envelope struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Version    int             `json:"version"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Producer   string          `json:"producer"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// ErrNotEnvelope is returned by Decode for messages written before the
+// envelope was introduced.
+var ErrNotEnvelope = errors.New("message is not an event envelope")
+
+// Producer builds envelopes for one service. Every event is validated
+// against the latest registered schema of its type before it is encoded.
+type Producer struct {
+	name     string
+	registry *Registry
+
+	now   func() time.Time
+	newID func() string
+}
+
+func NewProducer(name string, registry *Registry) *Producer {
+	return &Producer{
+		name:     name,
+		registry: registry,
+		now:      time.Now,
+		newID:    uuid.NewString,
+	}
+}
+
+// Encode returns the JSON of an envelope with payload.
+func (p *Producer) Encode(eventType string, payload any) ([]byte, error) {
+	version := p.registry.Latest(eventType)
+	if version == 0 {
+		return nil, fmt.Errorf("no schema registered for %s", eventType)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("encode %s payload: %w", eventType, err)
+	}
+
+	e := Envelope{
+		ID:         p.newID(),
+		Type:       eventType,
+		Version:    version,
+		OccurredAt: p.now().UTC(),
+		Producer:   p.name,
+		Payload:    data,
+	}
+	if err := p.registry.Validate(&e); err != nil {
+		return nil, err
+	}
+	return json.Marshal(e)
+}
+
+// Decode parses an envelope without validating the payload.
+func Decode(data []byte) (*Envelope, error) {
+	var e Envelope
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	if e.Type == "" || e.Version == 0 || len(e.Payload) == 0 {
+		return nil, ErrNotEnvelope
+	}
+	return &e, nil
+}
@@ -0,0 +1,131 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newProducer(t *testing.T) *Producer {
+	t.Helper()
+	registry, err := LoadRegistry()
+	require.NoError(t, err)
+
+	p := NewProducer("gateway", registry)
+	p.now = func() time.Time { return time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC) }
+	p.newID = func() string { return "e1" }
+	return p
+}
+
+func TestEncode(t *testing.T) {
+	p := newProducer(t)
+
+	data, err := p.Encode(UserRegistered, map[string]string{"user_id": "u1", "username": `bob "the" builder`})
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `{
+		"id": "e1",
+		"type": "user.registered",
+		"version": 1,
+		"occurred_at": "2026-03-01T12:00:00Z",
+		"producer": "gateway",
+		"payload": {"user_id": "u1", "username": "bob \"the\" builder"}
+	}`, string(data))
+
+	e, err := Decode(data)
+	require.NoError(t, err)
+	var payload struct {
+		Username string `json:"username"`
+	}
+	require.NoError(t, json.Unmarshal(e.Payload, &payload))
+	assert.Equal(t, `bob "the" builder`, payload.Username)
+}
+
+func TestEncodeValidatesPayload(t *testing.T) {
+	p := newProducer(t)
+
+	_, err := p.Encode(PostCommented, map[string]string{"post_id": "p1", "user_id": "u1"})
+	assert.ErrorContains(t, err, "invalid post.commented v1 payload")
+
+	_, err = p.Encode(PostViewed, map[string]any{"post_id": 1, "user_id": "u1"})
+	assert.Error(t, err)
+
+	_, err = p.Encode("post.shared", map[string]string{"post_id": "p1"})
+	assert.ErrorContains(t, err, "no schema registered for post.shared")
+}
+
+func TestDecodeLegacyMessage(t *testing.T) {
+	_, err := Decode([]byte(`{"user_id": "u1", "post_id": "p1", "timestamp": "2026-03-01T12:00:00"}`))
+	assert.ErrorIs(t, err, ErrNotEnvelope)
+}
+
+func TestRegistryCompatibility(t *testing.T) {
+	v1 := `{"type": "object", "required": ["post_id"], "properties": {
+		"post_id": {"type": "string"},
+		"source": {"type": "string", "enum": ["feed", "search"]}
+	}}`
+
+	tests := []struct {
+		name string
+		mode Compatibility
+		v2   string
+		err  string
+	}{
+		{"optional property added", Full, `{"type": "object", "required": ["post_id"], "properties": {
+			"post_id": {"type": "string"}, "source": {"type": "string", "enum": ["feed", "search"]}, "device": {"type": "string"}}}`, ""},
+		{"required property added", Backward, `{"type": "object", "required": ["post_id", "device"], "properties": {
+			"post_id": {"type": "string"}, "device": {"type": "string"}}}`, "/: device is required but may be missing"},
+		{"required property dropped", Backward, `{"type": "object", "properties": {"post_id": {"type": "string"}}}`, ""},
+		{"required property dropped", Forward, `{"type": "object", "properties": {"post_id": {"type": "string"}}}`, "/: post_id is required but may be missing"},
+		{"type changed", Backward, `{"type": "object", "required": ["post_id"], "properties": {"post_id": {"type": "integer"}}}`,
+			"/post_id: type changed from string to integer"},
+		{"enum value removed", Backward, `{"type": "object", "required": ["post_id"], "properties": {
+			"post_id": {"type": "string"}, "source": {"type": "string", "enum": ["feed"]}}}`, "/source: value search was removed"},
+		{"property closed", Backward, `{"type": "object", "required": ["post_id"], "additionalProperties": false, "properties": {
+			"post_id": {"type": "string"}}}`, "/: source is no longer allowed"},
+	}
+
+	for _, tt := range tests {
+		r, err := NewRegistry(tt.mode)
+		require.NoError(t, err)
+		require.NoError(t, r.Register("post.viewed", 1, []byte(v1)))
+
+		err = r.Register("post.viewed", 2, []byte(tt.v2))
+		if tt.err == "" {
+			assert.NoError(t, err, tt.name)
+			assert.Equal(t, 2, r.Latest("post.viewed"), tt.name)
+			continue
+		}
+		assert.ErrorContains(t, err, tt.err, tt.name)
+		assert.Equal(t, 1, r.Latest("post.viewed"), tt.name)
+	}
+}
+
+func TestRegistryVersionsInOrder(t *testing.T) {
+	r, err := NewRegistry(Backward)
+	require.NoError(t, err)
+
+	assert.ErrorContains(t, r.Register("post.viewed", 2, []byte(`{"type": "object"}`)), "expected version 1, got 2")
+	assert.Error(t, r.Register("post.viewed", 1, []byte(`{"type": 5}`)))
+}
+
+func TestValidateOlderVersion(t *testing.T) {
+	r, err := NewRegistry(Backward)
+	require.NoError(t, err)
+	require.NoError(t, r.Register("post.viewed", 1, []byte(`{"type": "object", "required": ["post_id"]}`)))
+	require.NoError(t, r.Register("post.viewed", 2, []byte(`{"type": "object", "required": ["post_id"],
+		"properties": {"source": {"type": "string"}}}`)))
+
+	e := &Envelope{ID: "e1", Type: "post.viewed", Version: 1, OccurredAt: time.Now(), Producer: "events_service",
+		Payload: json.RawMessage(`{"post_id": "p1", "source": 1}`)}
+	assert.NoError(t, r.Validate(e))
+
+	e.Version = 2
+	assert.ErrorContains(t, r.Validate(e), "invalid post.viewed v2 payload")
+
+	e.Version = 3
+	assert.ErrorContains(t, r.Validate(e), "no schema registered for post.viewed v3")
+}
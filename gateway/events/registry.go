@@ -0,0 +1,304 @@
+package events
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+//go:embed schemas/*.json
+var schemaFiles embed.FS
+
+const envelopeFile = "schemas/envelope.json"
+
+// Compatibility is the rule a new schema version has to follow relative to
+// every earlier version of the same event type.
+type Compatibility int
+
+const (
+	// Backward lets consumers upgraded to the new version read events
+	// written with the earlier ones: new required properties are rejected.
+	Backward Compatibility = iota
+	// Forward lets consumers still on an earlier version read events written
+	// with the new one: required properties cannot be removed.
+	Forward
+	// Full is Backward and Forward together.
+	Full
+)
+
+// Registry is a local stand-in for a schema registry. It keeps the payload
+// schemas of every event type by version and refuses versions that break
+// its compatibility rule.
+type Registry struct {
+	mode     Compatibility
+	envelope *jsonschema.Schema
+
+	mu       sync.RWMutex
+	subjects map[string][]*schema
+}
+
+type schema struct {
+	raw      map[string]any
+	compiled *jsonschema.Schema
+}
+
+func NewRegistry(mode Compatibility) (*Registry, error) {
+	data, err := schemaFiles.ReadFile(envelopeFile)
+	if err != nil {
+		return nil, err
+	}
+	envelope, err := compile(envelopeFile, data)
+	if err != nil {
+		return nil, err
+	}
+	return &Registry{mode: mode, envelope: envelope.compiled, subjects: make(map[string][]*schema)}, nil
+}
+
+// LoadRegistry returns a registry with the schemas in schemas/, which are
+// named <type>.v<version>.json.
+func LoadRegistry() (*Registry, error) {
+	r, err := NewRegistry(Backward)
+	if err != nil {
+		return nil, err
+	}
+
+	type file struct {
+		name, eventType string
+		version         int
+	}
+	var files []file
+	entries, err := schemaFiles.ReadDir("schemas")
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name := path.Join("schemas", entry.Name())
+		if name == envelopeFile {
+			continue
+		}
+		base := strings.TrimSuffix(entry.Name(), ".json")
+		i := strings.LastIndex(base, ".v")
+		version, err := strconv.Atoi(base[i+2:])
+		if i < 0 || err != nil {
+			return nil, fmt.Errorf("%s: expected <type>.v<version>.json", name)
+		}
+		files = append(files, file{name, base[:i], version})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].version < files[j].version })
+
+	for _, f := range files {
+		data, err := schemaFiles.ReadFile(f.name)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.Register(f.eventType, f.version, data); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Register adds the next version of eventType. Versions start at 1 and
+// cannot be skipped.
+func (r *Registry) Register(eventType string, version int, definition []byte) error {
+	s, err := compile(fmt.Sprintf("%s.v%d.json", eventType, version), definition)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	versions := r.subjects[eventType]
+	if version != len(versions)+1 {
+		return fmt.Errorf("%s: expected version %d, got %d", eventType, len(versions)+1, version)
+	}
+	if err := r.check(eventType, versions, s); err != nil {
+		return err
+	}
+	r.subjects[eventType] = append(versions, s)
+	return nil
+}
+
+// Check reports whether definition could be registered as the next version
+// of eventType.
+func (r *Registry) Check(eventType string, definition []byte) error {
+	s, err := compile(eventType+".next.json", definition)
+	if err != nil {
+		return err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.check(eventType, r.subjects[eventType], s)
+}
+
+func (r *Registry) check(eventType string, versions []*schema, next *schema) error {
+	var problems []string
+	for i, prev := range versions {
+		var found []string
+		if r.mode == Backward || r.mode == Full {
+			found = append(found, incompatibilities(prev.raw, next.raw, "")...)
+		}
+		if r.mode == Forward || r.mode == Full {
+			found = append(found, incompatibilities(next.raw, prev.raw, "")...)
+		}
+		for _, p := range found {
+			problems = append(problems, fmt.Sprintf("v%d: %s", i+1, p))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s: incompatible schema: %s", eventType, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Latest returns the newest version of eventType or 0 if it is unknown.
+func (r *Registry) Latest(eventType string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.subjects[eventType])
+}
+
+// Validate checks the envelope and its payload against the schema of the
+// envelope's type and version.
+func (r *Registry) Validate(e *Envelope) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if err := r.envelope.Validate(doc); err != nil {
+		return fmt.Errorf("invalid event envelope: %w", err)
+	}
+
+	r.mu.RLock()
+	versions := r.subjects[e.Type]
+	r.mu.RUnlock()
+	if e.Version < 1 || e.Version > len(versions) {
+		return fmt.Errorf("no schema registered for %s v%d", e.Type, e.Version)
+	}
+
+	var payload any
+	if err := json.Unmarshal(e.Payload, &payload); err != nil {
+		return err
+	}
+	if err := versions[e.Version-1].compiled.Validate(payload); err != nil {
+		return fmt.Errorf("invalid %s v%d payload: %w", e.Type, e.Version, err)
+	}
+	return nil
+}
+
+func compile(name string, definition []byte) (*schema, error) {
+	var raw map[string]any
+	if err := json.Unmarshal(definition, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	c := jsonschema.NewCompiler()
+	c.Draft = jsonschema.Draft7
+	if err := c.AddResource(name, bytes.NewReader(definition)); err != nil {
+		return nil, err
+	}
+	compiled, err := c.Compile(name)
+	if err != nil {
+		return nil, err
+	}
+	return &schema{raw: raw, compiled: compiled}, nil
+}
+
+// incompatibilities lists why data valid against writer may fail against
+// reader. Only the keywords used by the event schemas are compared.
+func incompatibilities(writer, reader map[string]any, at string) []string {
+	var problems []string
+	if w, ok := writer["type"]; ok {
+		if r, ok := reader["type"]; ok && !reflect.DeepEqual(w, r) {
+			problems = append(problems, fmt.Sprintf("%s: type changed from %v to %v", pointer(at), w, r))
+		}
+	}
+
+	writerRequired := stringSet(writer["required"])
+	for name := range stringSet(reader["required"]) {
+		if !writerRequired[name] {
+			problems = append(problems, fmt.Sprintf("%s: %s is required but may be missing", pointer(at), name))
+		}
+	}
+
+	writerProps, _ := writer["properties"].(map[string]any)
+	readerProps, _ := reader["properties"].(map[string]any)
+	closed := reader["additionalProperties"] == false
+	names := make([]string, 0, len(writerProps))
+	for name := range writerProps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		r, ok := readerProps[name].(map[string]any)
+		if !ok {
+			if closed {
+				problems = append(problems, fmt.Sprintf("%s: %s is no longer allowed", pointer(at), name))
+			}
+			continue
+		}
+		if w, ok := writerProps[name].(map[string]any); ok {
+			problems = append(problems, incompatibilities(w, r, at+"/"+name)...)
+		}
+	}
+
+	if w, ok := writer["items"].(map[string]any); ok {
+		if r, ok := reader["items"].(map[string]any); ok {
+			problems = append(problems, incompatibilities(w, r, at+"/items")...)
+		}
+	}
+
+	if r, ok := reader["enum"].([]any); ok {
+		w, _ := writer["enum"].([]any)
+		if len(w) == 0 {
+			problems = append(problems, fmt.Sprintf("%s: values are now restricted", pointer(at)))
+		}
+		for _, v := range w {
+			if !contains(r, v) {
+				problems = append(problems, fmt.Sprintf("%s: value %v was removed", pointer(at), v))
+			}
+		}
+	}
+	return problems
+}
+
+func pointer(at string) string {
+	if at == "" {
+		return "/"
+	}
+	return at
+}
+
+func stringSet(v any) map[string]bool {
+	set := map[string]bool{}
+	list, _ := v.([]any)
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			set[s] = true
+		}
+	}
+	return set
+}
+
+func contains(list []any, v any) bool {
+	for _, item := range list {
+		if reflect.DeepEqual(item, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+package gql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// defaultListSize is the number of items assumed for list fields whose size
+// is not bounded by a pageSize argument.
+const defaultListSize = 10
+
+// analysis walks an operation before it is executed and computes its depth
+// and complexity. Every field costs one point and the cost of the fields
+// selected below a list is multiplied by the expected number of items, taken
+// from the closest pageSize argument when there is one.
+type analysis struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+}
+
+func checkLimits(schema *graphql.Schema, doc *ast.Document, operationName string,
+	variables map[string]interface{}, maxDepth, maxComplexity int) error {
+	a := &analysis{
+		fragments: make(map[string]*ast.FragmentDefinition),
+		variables: variables,
+	}
+
+	var op *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		switch def := def.(type) {
+		case *ast.FragmentDefinition:
+			a.fragments[def.Name.Value] = def
+		case *ast.OperationDefinition:
+			if operationName == "" || (def.Name != nil && def.Name.Value == operationName) {
+				op = def
+			}
+		}
+	}
+	if op == nil {
+		return fmt.Errorf("unknown operation %q", operationName)
+	}
+
+	var root *graphql.Object
+	switch op.Operation {
+	case ast.OperationTypeQuery:
+		root = schema.QueryType()
+	case ast.OperationTypeMutation:
+		root = schema.MutationType()
+	case ast.OperationTypeSubscription:
+		root = schema.SubscriptionType()
+	}
+	if root == nil {
+		return fmt.Errorf("%s operations are not supported", op.Operation)
+	}
+
+	depth, complexity := a.selectionSet(op.SelectionSet, root, 0)
+	if depth > maxDepth {
+		return fmt.Errorf("query depth %d exceeds the limit of %d", depth, maxDepth)
+	}
+	if complexity > maxComplexity {
+		return fmt.Errorf("query complexity %d exceeds the limit of %d", complexity, maxComplexity)
+	}
+	return nil
+}
+
+func (a *analysis) selectionSet(set *ast.SelectionSet, parent *graphql.Object, listSize int) (depth, complexity int) {
+	if set == nil {
+		return 0, 0
+	}
+
+	for _, sel := range set.Selections {
+		var d, c int
+		switch sel := sel.(type) {
+		case *ast.Field:
+			d, c = a.field(sel, parent, listSize)
+		case *ast.InlineFragment:
+			d, c = a.selectionSet(sel.SelectionSet, parent, listSize)
+		case *ast.FragmentSpread:
+			if frag, ok := a.fragments[sel.Name.Value]; ok {
+				d, c = a.selectionSet(frag.SelectionSet, parent, listSize)
+			}
+		}
+		depth = max(depth, d)
+		complexity += c
+	}
+	return depth, complexity
+}
+
+func (a *analysis) field(f *ast.Field, parent *graphql.Object, listSize int) (depth, complexity int) {
+	if strings.HasPrefix(f.Name.Value, "__") {
+		return 0, 0
+	}
+
+	def, ok := parent.Fields()[f.Name.Value]
+	if !ok {
+		return 1, 1
+	}
+
+	if size, ok := a.pageSize(f); ok {
+		listSize = size
+	}
+
+	multiplier := 1
+	typ := def.Type
+	for unwrapped := false; !unwrapped; {
+		switch t := typ.(type) {
+		case *graphql.NonNull:
+			typ = t.OfType
+		case *graphql.List:
+			multiplier = defaultListSize
+			if listSize > 0 {
+				multiplier = listSize
+			}
+			listSize = 0
+			typ = t.OfType
+		default:
+			unwrapped = true
+		}
+	}
+
+	obj, ok := typ.(*graphql.Object)
+	if !ok {
+		return 1, 1
+	}
+	d, c := a.selectionSet(f.SelectionSet, obj, listSize)
+	return d + 1, 1 + multiplier*c
+}
+
+func (a *analysis) pageSize(f *ast.Field) (int, bool) {
+	for _, arg := range f.Arguments {
+		if arg.Name.Value != "pageSize" {
+			continue
+		}
+		switch v := arg.Value.(type) {
+		case *ast.IntValue:
+			n, err := strconv.Atoi(v.Value)
+			return clampPageSize(n), err == nil
+		case *ast.Variable:
+			switch n := a.variables[v.Name.Value].(type) {
+			case int:
+				return clampPageSize(n), true
+			case float64:
+				return clampPageSize(int(n)), true
+			}
+		}
+	}
+	return 0, false
+}
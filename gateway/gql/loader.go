@@ -0,0 +1,100 @@
+package gql
+
+import (
+	"context"
+	"sync"
+)
+
+const fanOutLimit = 8
+
+type result[V any] struct {
+	value V
+	err   error
+}
+
+type batchFunc[K comparable, V any] func(ctx context.Context, keys []K) map[K]result[V]
+
+// loader collects the keys requested while the executor resolves one level of
+// the query and fetches them with a single batch call once the first value is
+// needed. Results are memoized for the lifetime of the request.
+type loader[K comparable, V any] struct {
+	ctx   context.Context
+	fetch batchFunc[K, V]
+
+	mu      sync.Mutex
+	pending []K
+	queued  map[K]struct{}
+	done    map[K]result[V]
+}
+
+func newLoader[K comparable, V any](ctx context.Context, fetch batchFunc[K, V]) *loader[K, V] {
+	return &loader[K, V]{
+		ctx:    ctx,
+		fetch:  fetch,
+		queued: make(map[K]struct{}),
+		done:   make(map[K]result[V]),
+	}
+}
+
+// load queues key and returns a thunk in the form graphql-go defers until the
+// rest of the current level has been resolved.
+func (l *loader[K, V]) load(key K) func() (interface{}, error) {
+	l.mu.Lock()
+	if _, ok := l.done[key]; !ok {
+		if _, ok := l.queued[key]; !ok {
+			l.queued[key] = struct{}{}
+			l.pending = append(l.pending, key)
+		}
+	}
+	l.mu.Unlock()
+
+	return func() (interface{}, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if _, ok := l.done[key]; !ok {
+			l.dispatch()
+		}
+		r := l.done[key]
+		return r.value, r.err
+	}
+}
+
+func (l *loader[K, V]) dispatch() {
+	keys := l.pending
+	l.pending = nil
+	clear(l.queued)
+
+	results := l.fetch(l.ctx, keys)
+	for _, key := range keys {
+		l.done[key] = results[key]
+	}
+}
+
+// fanOut adapts a single-key upstream call to a batchFunc by issuing the calls
+// concurrently.
+func fanOut[K comparable, V any](get func(ctx context.Context, key K) (V, error)) batchFunc[K, V] {
+	return func(ctx context.Context, keys []K) map[K]result[V] {
+		var (
+			mu      sync.Mutex
+			wg      sync.WaitGroup
+			sem     = make(chan struct{}, fanOutLimit)
+			results = make(map[K]result[V], len(keys))
+		)
+		for _, key := range keys {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				value, err := get(ctx, key)
+				mu.Lock()
+				results[key] = result[V]{value: value, err: err}
+				mu.Unlock()
+			}()
+		}
+		wg.Wait()
+		return results
+	}
+}
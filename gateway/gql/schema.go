@@ -0,0 +1,419 @@
+package gql
+
+import (
+	"context"
+	"errors"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	pb "github.com/nanoservices/gateway/generated"
+	"github.com/nanoservices/gateway/problem"
+	"github.com/nanoservices/gateway/users"
+	"github.com/nanoservices/pkg/logging"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultPageSize = 10
+	maxPageSize     = 100
+	profileBatch    = 100
+)
+
+type commentsKey struct {
+	postID   string
+	page     int
+	pageSize int
+	layout   pb.CommentLayout
+}
+
+// request carries the caller identity and the loaders of a single GraphQL
+// request through the resolvers.
+type request struct {
+	userID        string
+	authorization string
+
+	posts    *loader[string, *pb.PostResponse]
+	stats    *loader[string, *pb.PostStatsResponse]
+	comments *loader[commentsKey, *pb.CommentsResponse]
+	profiles *loader[string, *users.Profile]
+}
+
+type requestKey struct{}
+
+func fromContext(ctx context.Context) *request {
+	return ctx.Value(requestKey{}).(*request)
+}
+
+func (s *Server) newRequest(ctx context.Context, userID, authorization string) context.Context {
+	r := &request{userID: userID, authorization: authorization}
+	ctx = context.WithValue(ctx, requestKey{}, r)
+
+	r.posts = newLoader(ctx, fanOut(func(ctx context.Context, id string) (*pb.PostResponse, error) {
+		post, err := s.cfg.Posts.GetPost(ctx, &pb.GetPostRequest{PostId: id, UserId: userID})
+		if status.Code(err) == codes.NotFound {
+			return nil, nil
+		}
+		return post, upstreamError(ctx, err)
+	}))
+	r.stats = newLoader(ctx, fanOut(func(ctx context.Context, id string) (*pb.PostStatsResponse, error) {
+		stats, err := s.cfg.Stats.GetPostStats(ctx, &pb.PostStatsRequest{PostId: id})
+		return stats, upstreamError(ctx, err)
+	}))
+	r.comments = newLoader(ctx, fanOut(func(ctx context.Context, key commentsKey) (*pb.CommentsResponse, error) {
+		comments, err := s.cfg.Posts.GetComments(ctx, &pb.GetCommentsRequest{
+			PostId:   key.postID,
+			Page:     int32(key.page),
+			PageSize: int32(key.pageSize),
+			UserId:   userID,
+			Layout:   key.layout,
+		})
+		return comments, upstreamError(ctx, err)
+	}))
+	r.profiles = newLoader(ctx, s.fetchProfiles(authorization))
+	return ctx
+}
+
+func (s *Server) fetchProfiles(authorization string) batchFunc[string, *users.Profile] {
+	return func(ctx context.Context, ids []string) map[string]result[*users.Profile] {
+		results := make(map[string]result[*users.Profile], len(ids))
+		for start := 0; start < len(ids); start += profileBatch {
+			chunk := ids[start:min(start+profileBatch, len(ids))]
+
+			profiles, err := s.cfg.Users.Profiles(ctx, authorization, chunk)
+			if err != nil {
+				logging.For("graphql").ErrorContext(ctx, "Failed to fetch profiles", "error", err)
+				err = errors.New("failed to fetch profiles")
+			}
+			for _, id := range chunk {
+				if p, ok := profiles[id]; ok {
+					results[id] = result[*users.Profile]{value: &p}
+				} else {
+					results[id] = result[*users.Profile]{err: err}
+				}
+			}
+		}
+		return results
+	}
+}
+
+// upstreamError reports a failed gRPC call with the title, detail and code
+// of the problem+json body the REST routes return for it.
+func upstreamError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	return problemError{problem.FromGRPC(ctx, err)}
+}
+
+type problemError struct {
+	*problem.Problem
+}
+
+func (e problemError) Error() string {
+	return e.Detail
+}
+
+func (e problemError) Extensions() map[string]interface{} {
+	ext := map[string]interface{}{
+		"code":   e.Code(),
+		"title":  e.Title,
+		"status": e.Status,
+	}
+	if len(e.Errors) > 0 {
+		ext["errors"] = e.Errors
+	}
+	return ext
+}
+
+// asProblemError digs the upstream error out of the wrappers graphql-go puts
+// around it. Errors of deferred resolvers are reformatted before they get a
+// location, so their extensions would otherwise be lost.
+func asProblemError(err error) (problemError, bool) {
+	for err != nil {
+		switch e := err.(type) {
+		case problemError:
+			return e, true
+		case *gqlerrors.Error:
+			err = e.OriginalError
+		case gqlerrors.FormattedError:
+			err = e.OriginalError()
+		default:
+			return problemError{}, false
+		}
+	}
+	return problemError{}, false
+}
+
+func clampPageSize(n int) int {
+	if n < 1 || n > maxPageSize {
+		return defaultPageSize
+	}
+	return n
+}
+
+func pageArgs(args map[string]interface{}) (page, pageSize int) {
+	page, _ = args["page"].(int)
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ = args["pageSize"].(int)
+	return page, clampPageSize(pageSize)
+}
+
+var pageArgsConfig = graphql.FieldConfigArgument{
+	"page":     &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 1},
+	"pageSize": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultPageSize},
+}
+
+func (s *Server) buildSchema() (graphql.Schema, error) {
+	metric := graphql.NewEnum(graphql.EnumConfig{
+		Name: "Metric",
+		Values: graphql.EnumValueConfigMap{
+			"VIEWS":    &graphql.EnumValueConfig{Value: pb.Metric_VIEWS},
+			"LIKES":    &graphql.EnumValueConfig{Value: pb.Metric_LIKES},
+			"COMMENTS": &graphql.EnumValueConfig{Value: pb.Metric_COMMENTS},
+		},
+	})
+
+	commentLayout := graphql.NewEnum(graphql.EnumConfig{
+		Name: "CommentLayout",
+		Values: graphql.EnumValueConfigMap{
+			"FLAT":   &graphql.EnumValueConfig{Value: pb.CommentLayout_FLAT},
+			"TREE":   &graphql.EnumValueConfig{Value: pb.CommentLayout_TREE},
+			"THREAD": &graphql.EnumValueConfig{Value: pb.CommentLayout_THREAD},
+		},
+	})
+
+	profile := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Profile",
+		Fields: graphql.Fields{
+			"userId":    &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"username":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"firstName": &graphql.Field{Type: graphql.String},
+			"lastName":  &graphql.Field{Type: graphql.String},
+			"bio":       &graphql.Field{Type: graphql.String},
+		},
+	})
+
+	author := &graphql.Field{
+		Type: profile,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			var userID string
+			switch src := p.Source.(type) {
+			case *pb.PostResponse:
+				userID = src.UserId
+			case *pb.Comment:
+				userID = src.UserId
+			case *pb.UserItem:
+				userID = src.UserId
+			}
+			// Deleted comments have no author.
+			if userID == "" {
+				return nil, nil
+			}
+			return fromContext(p.Context).profiles.load(userID), nil
+		},
+	}
+
+	stats := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PostStats",
+		Fields: graphql.Fields{
+			"views":    &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"likes":    &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"comments": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		},
+	})
+
+	reactionCount := graphql.NewObject(graphql.ObjectConfig{
+		Name: "ReactionCount",
+		Fields: graphql.Fields{
+			"reaction": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"count":    &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		},
+	})
+	reactions := &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(reactionCount)))}
+
+	comment := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Comment",
+		Fields: graphql.Fields{
+			"id":         &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"content":    &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"userId":     &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"createdAt":  &graphql.Field{Type: graphql.String},
+			"parentId":   &graphql.Field{Type: graphql.ID},
+			"depth":      &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"editedAt":   &graphql.Field{Type: graphql.String},
+			"deleted":    &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+			"reactions":  reactions,
+			"myReaction": &graphql.Field{Type: graphql.String},
+			"author":     author,
+		},
+	})
+	comment.AddFieldConfig("replies", &graphql.Field{
+		Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(comment))),
+	})
+
+	commentPage := graphql.NewObject(graphql.ObjectConfig{
+		Name: "CommentPage",
+		Fields: graphql.Fields{
+			"items": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(comment))),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*pb.CommentsResponse).Comments, nil
+				},
+			},
+			"total": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		},
+	})
+
+	post := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Post",
+		Fields: graphql.Fields{
+			"id":          &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"title":       &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"description": &graphql.Field{Type: graphql.String},
+			"userId":      &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"createdAt":   &graphql.Field{Type: graphql.String},
+			"updatedAt":   &graphql.Field{Type: graphql.String},
+			"isPrivate":   &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+			"tags":        &graphql.Field{Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+			"likeCount":   &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"likedByMe":   &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+			"reactions":   reactions,
+			"myReaction":  &graphql.Field{Type: graphql.String},
+			"author":      author,
+			"stats": &graphql.Field{
+				Type: stats,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return fromContext(p.Context).stats.load(p.Source.(*pb.PostResponse).Id), nil
+				},
+			},
+			"comments": &graphql.Field{
+				Type: commentPage,
+				Args: graphql.FieldConfigArgument{
+					"page":     pageArgsConfig["page"],
+					"pageSize": pageArgsConfig["pageSize"],
+					"layout":   &graphql.ArgumentConfig{Type: commentLayout, DefaultValue: pb.CommentLayout_FLAT},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					page, pageSize := pageArgs(p.Args)
+					layout, _ := p.Args["layout"].(pb.CommentLayout)
+					key := commentsKey{postID: p.Source.(*pb.PostResponse).Id, page: page, pageSize: pageSize, layout: layout}
+					return fromContext(p.Context).comments.load(key), nil
+				},
+			},
+		},
+	})
+
+	postPage := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PostPage",
+		Fields: graphql.Fields{
+			"items": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(post))),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*pb.ListPostsResponse).Posts, nil
+				},
+			},
+			"total": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		},
+	})
+
+	topPost := graphql.NewObject(graphql.ObjectConfig{
+		Name: "TopPost",
+		Fields: graphql.Fields{
+			"postId": &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"title":  &graphql.Field{Type: graphql.String},
+			"count":  &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"post": &graphql.Field{
+				Type: post,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return fromContext(p.Context).posts.load(p.Source.(*pb.PostItem).PostId), nil
+				},
+			},
+		},
+	})
+
+	topUser := graphql.NewObject(graphql.ObjectConfig{
+		Name: "TopUser",
+		Fields: graphql.Fields{
+			"userId":   &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"username": &graphql.Field{Type: graphql.String},
+			"count":    &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"profile":  author,
+		},
+	})
+
+	metricArgs := graphql.FieldConfigArgument{
+		"metric": &graphql.ArgumentConfig{Type: graphql.NewNonNull(metric)},
+	}
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"me": &graphql.Field{
+				Type: profile,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					r := fromContext(p.Context)
+					return r.profiles.load(r.userID), nil
+				},
+			},
+			"profile": &graphql.Field{
+				Type: profile,
+				Args: graphql.FieldConfigArgument{
+					"userId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return fromContext(p.Context).profiles.load(p.Args["userId"].(string)), nil
+				},
+			},
+			"post": &graphql.Field{
+				Type: post,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return fromContext(p.Context).posts.load(p.Args["id"].(string)), nil
+				},
+			},
+			"posts": &graphql.Field{
+				Type: graphql.NewNonNull(postPage),
+				Args: pageArgsConfig,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					r := fromContext(p.Context)
+					page, pageSize := pageArgs(p.Args)
+					res, err := s.cfg.Posts.ListPosts(p.Context, &pb.ListPostsRequest{
+						Page:     int32(page),
+						PageSize: int32(pageSize),
+						UserId:   r.userID,
+					})
+					return res, upstreamError(p.Context, err)
+				},
+			},
+			"topPosts": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(topPost))),
+				Args: metricArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					res, err := s.cfg.Stats.GetTopPosts(p.Context, &pb.TopRequest{Metric: p.Args["metric"].(pb.Metric)})
+					if err != nil {
+						return nil, upstreamError(p.Context, err)
+					}
+					return res.Posts, nil
+				},
+			},
+			"topUsers": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(topUser))),
+				Args: metricArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					res, err := s.cfg.Stats.GetTopUsers(p.Context, &pb.TopRequest{Metric: p.Args["metric"].(pb.Metric)})
+					if err != nil {
+						return nil, upstreamError(p.Context, err)
+					}
+					return res.Users, nil
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query})
+}
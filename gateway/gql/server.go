@@ -0,0 +1,117 @@
+package gql
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/labstack/echo/v4"
+	pb "github.com/nanoservices/gateway/generated"
+	"github.com/nanoservices/gateway/users"
+)
+
+type Config struct {
+	Posts pb.PostServiceClient
+	Stats pb.StatsServiceClient
+	Users *users.Client
+
+	MaxDepth      int
+	MaxComplexity int
+}
+
+// Server executes read-only GraphQL queries over the posts, statistics and
+// users services.
+type Server struct {
+	cfg    Config
+	schema graphql.Schema
+}
+
+func NewServer(cfg Config) (*Server, error) {
+	if cfg.MaxDepth == 0 {
+		cfg.MaxDepth = 10
+	}
+	if cfg.MaxComplexity == 0 {
+		cfg.MaxComplexity = 1000
+	}
+
+	s := &Server{cfg: cfg}
+	schema, err := s.buildSchema()
+	if err != nil {
+		return nil, err
+	}
+	s.schema = schema
+	return s, nil
+}
+
+type params struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Handler serves GraphQL over HTTP. It must run behind JWTAuth: the
+// authenticated user is used for access checks on posts and the caller's
+// token is forwarded to users_service.
+func (s *Server) Handler(c echo.Context) error {
+	var p params
+	switch c.Request().Method {
+	case http.MethodGet:
+		p.Query = c.QueryParam("query")
+		p.OperationName = c.QueryParam("operationName")
+		if vars := c.QueryParam("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &p.Variables); err != nil {
+				return requestError(c, "invalid variables")
+			}
+		}
+	default:
+		if err := json.NewDecoder(c.Request().Body).Decode(&p); err != nil {
+			return requestError(c, "invalid request")
+		}
+	}
+	if p.Query == "" {
+		return requestError(c, "query is required")
+	}
+
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{
+		Body: []byte(p.Query),
+		Name: "GraphQL request",
+	})})
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, &graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+	}
+
+	if v := graphql.ValidateDocument(&s.schema, doc, nil); !v.IsValid {
+		return c.JSON(http.StatusBadRequest, &graphql.Result{Errors: v.Errors})
+	}
+
+	if err := checkLimits(&s.schema, doc, p.OperationName, p.Variables,
+		s.cfg.MaxDepth, s.cfg.MaxComplexity); err != nil {
+		return requestError(c, err.Error())
+	}
+
+	ctx := s.newRequest(c.Request().Context(),
+		c.Get("user_id").(string), c.Request().Header.Get("Authorization"))
+
+	res := graphql.Execute(graphql.ExecuteParams{
+		Schema:        s.schema,
+		AST:           doc,
+		OperationName: p.OperationName,
+		Args:          p.Variables,
+		Context:       ctx,
+	})
+	for i := range res.Errors {
+		if e, ok := asProblemError(res.Errors[i].OriginalError()); ok {
+			res.Errors[i].Extensions = e.Extensions()
+		}
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+func requestError(c echo.Context, message string) error {
+	return c.JSON(http.StatusBadRequest, &graphql.Result{
+		Errors: []gqlerrors.FormattedError{gqlerrors.NewFormattedError(message)},
+	})
+}
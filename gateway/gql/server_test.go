@@ -0,0 +1,267 @@
+package gql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	pb "github.com/nanoservices/gateway/generated"
+	"github.com/nanoservices/gateway/users"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type fakePosts struct {
+	pb.PostServiceClient
+	getPost atomic.Int32
+}
+
+func (f *fakePosts) ListPosts(_ context.Context, req *pb.ListPostsRequest, _ ...grpc.CallOption) (*pb.ListPostsResponse, error) {
+	res := &pb.ListPostsResponse{Total: 3}
+	for i := 0; i < 3; i++ {
+		res.Posts = append(res.Posts, &pb.PostResponse{
+			Id:     fmt.Sprintf("post-%d", i),
+			Title:  fmt.Sprintf("Post %d", i),
+			UserId: fmt.Sprintf("user-%d", i%2),
+		})
+	}
+	return res, nil
+}
+
+func (f *fakePosts) GetPost(_ context.Context, req *pb.GetPostRequest, _ ...grpc.CallOption) (*pb.PostResponse, error) {
+	f.getPost.Add(1)
+	if req.PostId == "missing" {
+		return nil, status.Error(codes.NotFound, "not found")
+	}
+	return &pb.PostResponse{
+		Id: req.PostId, Title: "Title " + req.PostId, UserId: "user-0", LikeCount: 3, LikedByMe: req.UserId == "viewer",
+		Reactions: []*pb.ReactionCount{{Reaction: "👍", Count: 2}, {Reaction: "😂", Count: 1}}, MyReaction: "😂",
+	}, nil
+}
+
+func (f *fakePosts) GetComments(_ context.Context, req *pb.GetCommentsRequest, _ ...grpc.CallOption) (*pb.CommentsResponse, error) {
+	reply := &pb.Comment{Id: "c2", ParentId: "c1", Depth: 1, UserId: "user-1", Content: "reply"}
+	tombstone := &pb.Comment{Id: "c1", Deleted: true}
+	if req.Layout == pb.CommentLayout_TREE {
+		tombstone.Replies = []*pb.Comment{reply}
+		return &pb.CommentsResponse{Comments: []*pb.Comment{tombstone}, Total: 1}, nil
+	}
+	return &pb.CommentsResponse{Comments: []*pb.Comment{reply, tombstone}, Total: 2}, nil
+}
+
+type fakeStats struct {
+	pb.StatsServiceClient
+}
+
+func (f *fakeStats) GetPostStats(_ context.Context, req *pb.PostStatsRequest, _ ...grpc.CallOption) (*pb.PostStatsResponse, error) {
+	switch req.PostId {
+	case "no-stats":
+		return nil, status.Error(codes.NotFound, "stats not found")
+	case "stats-down":
+		return nil, status.Error(codes.Unavailable, "dial tcp: connection refused")
+	}
+	return &pb.PostStatsResponse{Views: 10, Likes: 2, Comments: 1}, nil
+}
+
+func (f *fakeStats) GetTopPosts(_ context.Context, req *pb.TopRequest, _ ...grpc.CallOption) (*pb.TopPostsResponse, error) {
+	return &pb.TopPostsResponse{Posts: []*pb.PostItem{
+		{PostId: "post-1", Count: 5},
+		{PostId: "post-1", Count: 5},
+		{PostId: "missing", Count: 3},
+	}}, nil
+}
+
+type profilesServer struct {
+	mu       sync.Mutex
+	requests []string
+	auth     []string
+}
+
+func (s *profilesServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r.URL.Query().Get("ids"))
+	s.auth = append(s.auth, r.Header.Get("Authorization"))
+	s.mu.Unlock()
+
+	var profiles []users.Profile
+	for _, id := range strings.Split(r.URL.Query().Get("ids"), ",") {
+		profiles = append(profiles, users.Profile{UserID: id, Username: "name-" + id})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"profiles": profiles})
+}
+
+func newTestServer(t *testing.T, cfg Config) (*Server, *profilesServer, *fakePosts) {
+	t.Helper()
+	profiles := &profilesServer{}
+	usersSrv := httptest.NewServer(profiles)
+	t.Cleanup(usersSrv.Close)
+
+	posts := &fakePosts{}
+	cfg.Posts = posts
+	cfg.Stats = &fakeStats{}
+	cfg.Users = users.NewClient(usersSrv.URL, usersSrv.Client())
+
+	s, err := NewServer(cfg)
+	require.NoError(t, err)
+	return s, profiles, posts
+}
+
+func execute(t *testing.T, s *Server, query string) (*httptest.ResponseRecorder, map[string]any) {
+	t.Helper()
+	body, _ := json.Marshal(map[string]string{"query": query})
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body)))
+	req.Header.Set("Authorization", "Bearer token")
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.Set("user_id", "viewer")
+
+	require.NoError(t, s.Handler(c))
+	var res map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	return rec, res
+}
+
+func TestBatchesProfiles(t *testing.T) {
+	s, profiles, _ := newTestServer(t, Config{})
+
+	rec, res := execute(t, s, `{
+		me { username }
+		posts(pageSize: 3) {
+			total
+			items { id author { username } stats { views } }
+		}
+	}`)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Nil(t, res["errors"])
+	items := res["data"].(map[string]any)["posts"].(map[string]any)["items"].([]any)
+	require.Len(t, items, 3)
+	assert.Equal(t, "name-user-1", items[1].(map[string]any)["author"].(map[string]any)["username"])
+	assert.Equal(t, float64(10), items[2].(map[string]any)["stats"].(map[string]any)["views"])
+
+	require.Len(t, profiles.requests, 1)
+	assert.ElementsMatch(t, []string{"viewer", "user-0", "user-1"}, strings.Split(profiles.requests[0], ","))
+	assert.Equal(t, "Bearer token", profiles.auth[0])
+}
+
+func TestDeduplicatesPosts(t *testing.T) {
+	s, _, posts := newTestServer(t, Config{})
+
+	rec, res := execute(t, s, `{ topPosts(metric: VIEWS) { count post { title } } }`)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	top := res["data"].(map[string]any)["topPosts"].([]any)
+	require.Len(t, top, 3)
+	assert.Equal(t, "Title post-1", top[0].(map[string]any)["post"].(map[string]any)["title"])
+	assert.Nil(t, top[2].(map[string]any)["post"])
+	assert.Equal(t, int32(2), posts.getPost.Load())
+}
+
+func TestPostLikes(t *testing.T) {
+	s, _, _ := newTestServer(t, Config{})
+
+	_, res := execute(t, s, `{ post(id: "post-1") { likeCount likedByMe } }`)
+
+	assert.Equal(t, map[string]any{"likeCount": float64(3), "likedByMe": true}, res["data"].(map[string]any)["post"])
+}
+
+func TestPostReactions(t *testing.T) {
+	s, _, _ := newTestServer(t, Config{})
+
+	_, res := execute(t, s, `{ post(id: "post-1") { reactions { reaction count } myReaction } }`)
+
+	assert.Equal(t, map[string]any{
+		"reactions": []any{
+			map[string]any{"reaction": "👍", "count": float64(2)},
+			map[string]any{"reaction": "😂", "count": float64(1)},
+		},
+		"myReaction": "😂",
+	}, res["data"].(map[string]any)["post"])
+}
+
+func TestCommentTree(t *testing.T) {
+	s, _, _ := newTestServer(t, Config{})
+
+	_, res := execute(t, s, `{ post(id: "post-1") { comments(layout: TREE) { items { id deleted author { username } replies { id parentId depth author { username } } } } } }`)
+
+	require.Nil(t, res["errors"])
+	items := res["data"].(map[string]any)["post"].(map[string]any)["comments"].(map[string]any)["items"].([]any)
+	assert.Equal(t, []any{map[string]any{
+		"id":      "c1",
+		"deleted": true,
+		"author":  nil,
+		"replies": []any{map[string]any{
+			"id":       "c2",
+			"parentId": "c1",
+			"depth":    float64(1),
+			"author":   map[string]any{"username": "name-user-1"},
+		}},
+	}}, items)
+}
+
+func TestLimits(t *testing.T) {
+	s, _, _ := newTestServer(t, Config{MaxDepth: 3, MaxComplexity: 50})
+
+	t.Run("Depth", func(t *testing.T) {
+		rec, res := execute(t, s, `{ posts { items { comments { items { author { username } } } } } }`)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, fmt.Sprint(res["errors"]), "depth")
+	})
+
+	t.Run("Complexity", func(t *testing.T) {
+		rec, res := execute(t, s, `{ posts(pageSize: 100) { items { id title } } }`)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, fmt.Sprint(res["errors"]), "complexity")
+	})
+
+	t.Run("Within limits", func(t *testing.T) {
+		rec, _ := execute(t, s, `{ posts(pageSize: 5) { items { id title } } }`)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+}
+
+func TestValidationError(t *testing.T) {
+	s, _, _ := newTestServer(t, Config{})
+
+	rec, res := execute(t, s, `{ posts { unknown } }`)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.NotEmpty(t, res["errors"])
+}
+
+func TestUpstreamErrors(t *testing.T) {
+	s, _, _ := newTestServer(t, Config{})
+
+	for id, want := range map[string]map[string]any{
+		"no-stats": {
+			"message":    "stats not found",
+			"extensions": map[string]any{"code": "NOT_FOUND", "title": "Not found", "status": float64(404)},
+		},
+		"stats-down": {
+			"message":    "the request could not be completed, try again later",
+			"extensions": map[string]any{"code": "UNAVAILABLE", "title": "Service unavailable", "status": float64(503)},
+		},
+	} {
+		_, res := execute(t, s, `{ post(id: "`+id+`") { stats { views } } }`)
+
+		errs := res["errors"].([]any)
+		require.Len(t, errs, 1)
+		got := errs[0].(map[string]any)
+		assert.Equal(t, want["message"], got["message"], id)
+		assert.Equal(t, want["extensions"], got["extensions"], id)
+	}
+}
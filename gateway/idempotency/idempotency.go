@@ -0,0 +1,247 @@
+package idempotency
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nanoservices/gateway/problem"
+)
+
+const (
+	HeaderKey      = "Idempotency-Key"
+	HeaderReplayed = "Idempotent-Replayed"
+
+	maxKeyLength = 255
+	maxBodySize  = 1 << 20
+
+	defaultMaxEntries = 100_000
+	defaultMaxBytes   = 256 << 20
+)
+
+type entry struct {
+	key         string
+	fingerprint [32]byte
+	done        bool
+	status      int
+	header      http.Header
+	body        []byte
+	expiresAt   time.Time
+}
+
+// Store keeps the responses of idempotent requests in memory. It holds at
+// most maxEntries keys and maxBytes of response bodies, evicting the least
+// recently used entries beyond that.
+type Store struct {
+	ttl        time.Duration
+	maxEntries int
+	maxBytes   int
+
+	mu        sync.Mutex
+	entries   map[string]*list.Element
+	lru       *list.List
+	bytes     int
+	lastSweep time.Time
+
+	now func() time.Time
+}
+
+func NewStore(ttl time.Duration) *Store {
+	return &Store{
+		ttl:        ttl,
+		maxEntries: defaultMaxEntries,
+		maxBytes:   defaultMaxBytes,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+		now:        time.Now,
+	}
+}
+
+// begin reserves key for a new request and returns the reserved entry. When
+// the key is already known a copy of the existing entry is returned instead.
+func (s *Store) begin(key string, fingerprint [32]byte) (existing, reserved *entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastSweep) > time.Minute {
+		for _, el := range s.entries {
+			if e := el.Value.(*entry); e.done && now.After(e.expiresAt) {
+				s.remove(el)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	if el, ok := s.entries[key]; ok {
+		if e := el.Value.(*entry); !e.done || now.Before(e.expiresAt) {
+			s.lru.MoveToFront(el)
+			copied := *e
+			return &copied, nil
+		}
+		s.remove(el)
+	}
+	reserved = &entry{key: key, fingerprint: fingerprint}
+	s.entries[key] = s.lru.PushFront(reserved)
+	s.evict()
+	return nil, reserved
+}
+
+func (s *Store) finish(e *entry, status int, header http.Header, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The entry may have been evicted while the request was running.
+	if el, ok := s.entries[e.key]; !ok || el.Value != e {
+		return
+	}
+	e.done = true
+	e.status = status
+	e.header = header
+	e.body = body
+	e.expiresAt = s.now().Add(s.ttl)
+	s.bytes += len(body)
+	s.evict()
+}
+
+func (s *Store) release(e *entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[e.key]; ok && el.Value == e {
+		s.remove(el)
+	}
+}
+
+func (s *Store) evict() {
+	for s.lru.Len() > s.maxEntries || s.bytes > s.maxBytes {
+		s.remove(s.lru.Back())
+	}
+}
+
+func (s *Store) remove(el *list.Element) {
+	e := s.lru.Remove(el).(*entry)
+	delete(s.entries, e.key)
+	s.bytes -= len(e.body)
+}
+
+// Middleware makes the wrapped route idempotent for requests carrying an
+// Idempotency-Key header. The first response for a key, user and path is
+// replayed on retries with the same body; a retry with a different body is
+// rejected with 422 and a retry while the first request is still running with
+// 409. Server errors are not stored so the client can retry them.
+func (s *Store) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get(HeaderKey)
+			if key == "" {
+				return next(c)
+			}
+			if len(key) > maxKeyLength {
+				return problem.Write(c, problem.New(http.StatusBadRequest, "Idempotency-Key is too long"))
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(c.Response(), c.Request().Body, maxBodySize))
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					return problem.Write(c, problem.New(http.StatusRequestEntityTooLarge, "request body is too large"))
+				}
+				return problem.Write(c, problem.New(http.StatusBadRequest, "invalid request"))
+			}
+			c.Request().Body = io.NopCloser(bytes.NewReader(body))
+
+			storeKey := caller(c) + "\x00" + c.Request().Method + " " + c.Request().URL.Path + "\x00" + key
+			fingerprint := sha256.Sum256(body)
+
+			existing, reserved := s.begin(storeKey, fingerprint)
+			if existing != nil {
+				switch {
+				case existing.fingerprint != fingerprint:
+					return problem.Write(c, problem.New(http.StatusUnprocessableEntity,
+						"Idempotency-Key was already used with a different request body"))
+				case !existing.done:
+					return problem.Write(c, problem.New(http.StatusConflict,
+						"a request with this Idempotency-Key is still in progress"))
+				}
+				return replay(c, existing)
+			}
+
+			stored := false
+			defer func() {
+				if !stored {
+					s.release(reserved)
+				}
+			}()
+
+			res := c.Response()
+			rec := &recorder{ResponseWriter: res.Writer}
+			res.Writer = rec
+
+			err = next(c)
+			res.Writer = rec.ResponseWriter
+
+			if err != nil || res.Status >= http.StatusInternalServerError || rec.overflow {
+				return err
+			}
+			s.finish(reserved, res.Status, storedHeader(res.Header()), rec.body.Bytes())
+			stored = true
+			return nil
+		}
+	}
+}
+
+// caller scopes keys to the authenticated user, or to the client address on
+// routes without authentication such as /api/register.
+func caller(c echo.Context) string {
+	if userID, _ := c.Get("user_id").(string); userID != "" {
+		return "user:" + userID
+	}
+	return "ip:" + c.RealIP()
+}
+
+func replay(c echo.Context, e *entry) error {
+	h := c.Response().Header()
+	for k, v := range e.header {
+		h[k] = v
+	}
+	h.Set(HeaderReplayed, "true")
+	c.Response().WriteHeader(e.status)
+	_, err := c.Response().Write(e.body)
+	return err
+}
+
+func storedHeader(h http.Header) http.Header {
+	stored := make(http.Header)
+	for _, k := range []string{echo.HeaderContentType, echo.HeaderLocation} {
+		if v := h.Values(k); len(v) > 0 {
+			stored[k] = append([]string(nil), v...)
+		}
+	}
+	return stored
+}
+
+// recorder passes the response through while keeping a copy of the body.
+type recorder struct {
+	http.ResponseWriter
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if !r.overflow {
+		if r.body.Len()+len(b) > maxBodySize {
+			r.overflow = true
+			r.body.Reset()
+		} else {
+			r.body.Write(b)
+		}
+	}
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,188 @@
+package idempotency
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+type testServer struct {
+	e     *echo.Echo
+	store *Store
+	calls atomic.Int32
+}
+
+func newTestServer(handler func(c echo.Context) error) *testServer {
+	ts := &testServer{e: echo.New(), store: NewStore(time.Hour)}
+	ts.e.POST("/api/posts/comment/:id", func(c echo.Context) error {
+		ts.calls.Add(1)
+		return handler(c)
+	}, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("user_id", c.Request().Header.Get("X-User"))
+			return next(c)
+		}
+	}, ts.store.Middleware())
+	return ts
+}
+
+func (ts *testServer) post(path, user, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("X-User", user)
+	if key != "" {
+		req.Header.Set(HeaderKey, key)
+	}
+	rec := httptest.NewRecorder()
+	ts.e.ServeHTTP(rec, req)
+	return rec
+}
+
+func created(c echo.Context) error {
+	body, _ := io.ReadAll(c.Request().Body)
+	return c.JSON(http.StatusCreated, map[string]string{"comment_id": c.Param("id") + "-" + string(body)})
+}
+
+func TestReplaysFirstResponse(t *testing.T) {
+	ts := newTestServer(created)
+
+	first := ts.post("/api/posts/comment/1", "alice", "k1", `{"content":"hi"}`)
+	second := ts.post("/api/posts/comment/1", "alice", "k1", `{"content":"hi"}`)
+
+	assert.Equal(t, http.StatusCreated, first.Code)
+	assert.Equal(t, http.StatusCreated, second.Code)
+	assert.Equal(t, first.Body.String(), second.Body.String())
+	assert.Equal(t, "true", second.Header().Get(HeaderReplayed))
+	assert.Equal(t, echo.MIMEApplicationJSON, second.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, int32(1), ts.calls.Load())
+}
+
+func TestKeyScope(t *testing.T) {
+	ts := newTestServer(created)
+
+	ts.post("/api/posts/comment/1", "alice", "k1", `{}`)
+	ts.post("/api/posts/comment/1", "bob", "k1", `{}`)
+	ts.post("/api/posts/comment/2", "alice", "k1", `{}`)
+	ts.post("/api/posts/comment/1", "alice", "", `{}`)
+	ts.post("/api/posts/comment/1", "alice", "", `{}`)
+
+	assert.Equal(t, int32(5), ts.calls.Load())
+}
+
+func TestRejectsDifferentBody(t *testing.T) {
+	ts := newTestServer(created)
+
+	ts.post("/api/posts/comment/1", "alice", "k1", `{"content":"hi"}`)
+	rec := ts.post("/api/posts/comment/1", "alice", "k1", `{"content":"bye"}`)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Equal(t, int32(1), ts.calls.Load())
+}
+
+func TestConcurrentDuplicate(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	ts := newTestServer(func(c echo.Context) error {
+		close(started)
+		<-release
+		return created(c)
+	})
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- ts.post("/api/posts/comment/1", "alice", "k1", `{}`) }()
+	<-started
+
+	rec := ts.post("/api/posts/comment/1", "alice", "k1", `{}`)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	close(release)
+	assert.Equal(t, http.StatusCreated, (<-done).Code)
+}
+
+func TestServerErrorsAreNotStored(t *testing.T) {
+	fail := true
+	ts := newTestServer(func(c echo.Context) error {
+		if fail {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		}
+		return created(c)
+	})
+
+	assert.Equal(t, http.StatusInternalServerError, ts.post("/api/posts/comment/1", "alice", "k1", `{}`).Code)
+	fail = false
+	assert.Equal(t, http.StatusCreated, ts.post("/api/posts/comment/1", "alice", "k1", `{}`).Code)
+	assert.Equal(t, int32(2), ts.calls.Load())
+}
+
+func TestExpiredKeyRunsAgain(t *testing.T) {
+	ts := newTestServer(created)
+	now := time.Now()
+	ts.store.now = func() time.Time { return now }
+
+	ts.post("/api/posts/comment/1", "alice", "k1", `{}`)
+	now = now.Add(2 * time.Hour)
+	rec := ts.post("/api/posts/comment/1", "alice", "k1", `{}`)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Empty(t, rec.Header().Get(HeaderReplayed))
+	assert.Equal(t, int32(2), ts.calls.Load())
+}
+
+func TestAnonymousKeysScopedByClient(t *testing.T) {
+	ts := newTestServer(created)
+	register := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/posts/comment/1", strings.NewReader(`{}`))
+		req.Header.Set(HeaderKey, "k1")
+		req.Header.Set(echo.HeaderXRealIP, ip)
+		rec := httptest.NewRecorder()
+		ts.e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	register("198.51.100.1")
+	rec := register("198.51.100.2")
+	assert.Empty(t, rec.Header().Get(HeaderReplayed))
+	rec = register("198.51.100.1")
+	assert.Equal(t, "true", rec.Header().Get(HeaderReplayed))
+	assert.Equal(t, int32(2), ts.calls.Load())
+}
+
+func TestEvictsLeastRecentlyUsed(t *testing.T) {
+	ts := newTestServer(created)
+	ts.store.maxEntries = 2
+
+	ts.post("/api/posts/comment/1", "alice", "k1", `{}`)
+	ts.post("/api/posts/comment/1", "alice", "k2", `{}`)
+	ts.post("/api/posts/comment/1", "alice", "k1", `{}`)
+	ts.post("/api/posts/comment/1", "alice", "k3", `{}`)
+
+	assert.Equal(t, "true", ts.post("/api/posts/comment/1", "alice", "k1", `{}`).Header().Get(HeaderReplayed))
+	assert.Empty(t, ts.post("/api/posts/comment/1", "alice", "k2", `{}`).Header().Get(HeaderReplayed))
+	assert.Equal(t, int32(4), ts.calls.Load())
+}
+
+func TestEvictsBeyondMaxBytes(t *testing.T) {
+	ts := newTestServer(created)
+	ts.store.maxBytes = 60
+
+	ts.post("/api/posts/comment/1", "alice", "k1", `{"content":"first"}`)
+	ts.post("/api/posts/comment/1", "alice", "k2", `{"content":"second"}`)
+
+	assert.Empty(t, ts.post("/api/posts/comment/1", "alice", "k1", `{"content":"first"}`).Header().Get(HeaderReplayed))
+	assert.LessOrEqual(t, ts.store.bytes, 60)
+}
+
+func TestRejectsLargeBody(t *testing.T) {
+	ts := newTestServer(created)
+
+	rec := ts.post("/api/posts/comment/1", "alice", "k1", strings.Repeat("a", maxBodySize+1))
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Equal(t, int32(0), ts.calls.Load())
+}
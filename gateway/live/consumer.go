@@ -0,0 +1,63 @@
+package live
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/nanoservices/gateway/events"
+	"github.com/nanoservices/pkg/logging"
+	"github.com/nanoservices/pkg/pubsub"
+)
+
+var topics = map[string]Kind{
+	"post_views":    View,
+	"post_likes":    Like,
+	"post_comments": Comment,
+}
+
+// Consume feeds the hub from the interaction topics until ctx is canceled.
+// Every gateway instance needs a subscriber that sees all events, starting
+// from the newest one because the counters are seeded from the statistics
+// service.
+func Consume(ctx context.Context, sub pubsub.EventSubscriber, hub *Hub) error {
+	names := make([]string, 0, len(topics))
+	for topic := range topics {
+		names = append(names, topic)
+	}
+
+	logger := logging.For("kafka")
+	return sub.Subscribe(ctx, names, func(ctx context.Context, msg pubsub.Message) error {
+		postID, kind := interaction(msg.Topic, msg.Value)
+		if postID == "" {
+			logger.WarnContext(ctx, "Skipping malformed interaction event", "topic", msg.Topic, "offset", msg.Offset)
+			return nil
+		}
+		hub.Apply(postID, kind)
+		return nil
+	})
+}
+
+// interaction reads the post and the kind of an interaction event. Events
+// written before the envelope was introduced carry the fields at the top
+// level. Unlikes share the likes topic to stay ordered with the likes.
+func interaction(topic string, value []byte) (string, Kind) {
+	payload := value
+	kind := topics[topic]
+	if e, err := events.Decode(value); err == nil {
+		payload = e.Payload
+		if e.Type == events.PostUnliked {
+			kind = Unlike
+		}
+	} else if !errors.Is(err, events.ErrNotEnvelope) {
+		return "", kind
+	}
+
+	var event struct {
+		PostID string `json:"post_id"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return "", kind
+	}
+	return event.PostID, kind
+}
@@ -0,0 +1,207 @@
+package live
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/nanoservices/gateway/problem"
+	"github.com/nanoservices/pkg/logging"
+)
+
+type Config struct {
+	// Authorize checks that the user may read the stats of the post.
+	Authorize func(ctx context.Context, postID, userID string) error
+	// Reject writes the response for an error returned by Authorize.
+	Reject func(c echo.Context, err error) error
+
+	Heartbeat    time.Duration
+	WriteTimeout time.Duration
+}
+
+type Server struct {
+	hub      *Hub
+	cfg      Config
+	upgrader websocket.Upgrader
+
+	// ctx is cancelled by Close to end the open streams, which the HTTP
+	// server's graceful shutdown would otherwise wait for.
+	ctx   context.Context
+	close context.CancelFunc
+
+	connections func(transport string, delta float64)
+}
+
+func NewServer(hub *Hub, cfg Config) *Server {
+	if cfg.Heartbeat == 0 {
+		cfg.Heartbeat = 15 * time.Second
+	}
+	if cfg.WriteTimeout == 0 {
+		cfg.WriteTimeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Server{
+		hub:   hub,
+		cfg:   cfg,
+		ctx:   ctx,
+		close: cancel,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  512,
+			WriteBufferSize: 1024,
+			CheckOrigin:     func(*http.Request) bool { return true },
+		},
+		connections: func(string, float64) {},
+	}
+}
+
+// OnConnection registers a callback that tracks the number of open streams
+// per transport.
+func (s *Server) OnConnection(f func(transport string, delta float64)) {
+	s.connections = f
+}
+
+// Close ends all open streams. It must be called before the HTTP server is
+// shut down.
+func (s *Server) Close() {
+	s.close()
+}
+
+// Handler streams the stats of the post :id. WebSocket upgrade requests get a
+// WebSocket, every other request a Server-Sent Events stream. The stream is
+// closed when the caller's token expires.
+func (s *Server) Handler(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+	postID := c.Param("id")
+
+	ctx, cancel := context.WithCancel(c.Request().Context())
+	defer cancel()
+	defer context.AfterFunc(s.ctx, cancel)()
+	if exp, ok := c.Get("token_expires_at").(time.Time); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, exp)
+		defer cancel()
+	}
+
+	if err := s.cfg.Authorize(ctx, postID, userID); err != nil {
+		return s.cfg.Reject(c, err)
+	}
+
+	sub, err := s.hub.Subscribe(ctx, postID)
+	if err != nil {
+		logging.For("live").ErrorContext(ctx, "Failed to load post stats", "post_id", postID, "error", err)
+		return problem.Write(c, problem.New(http.StatusBadGateway, "failed to load stats"))
+	}
+	defer s.hub.Unsubscribe(sub)
+
+	if websocket.IsWebSocketUpgrade(c.Request()) {
+		return s.serveWebSocket(ctx, c, sub)
+	}
+	return s.serveSSE(ctx, c, sub)
+}
+
+func (s *Server) serveSSE(ctx context.Context, c echo.Context, sub *Subscriber) error {
+	s.connections("sse", 1)
+	defer s.connections("sse", -1)
+
+	rc := http.NewResponseController(c.Response().Writer)
+	h := c.Response().Header()
+	h.Set(echo.HeaderContentType, "text/event-stream")
+	h.Set(echo.HeaderCacheControl, "no-cache")
+	h.Set("Connection", "keep-alive")
+	h.Set("X-Accel-Buffering", "no")
+	c.Response().WriteHeader(http.StatusOK)
+
+	write := func(payload string) error {
+		rc.SetWriteDeadline(time.Now().Add(s.cfg.WriteTimeout))
+		if _, err := c.Response().Write([]byte(payload)); err != nil {
+			return err
+		}
+		c.Response().Flush()
+		return nil
+	}
+
+	heartbeat := time.NewTicker(s.cfg.Heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				write("event: expired\ndata: {}\n\n")
+			}
+			return nil
+		case <-heartbeat.C:
+			if err := write(": ping\n\n"); err != nil {
+				return nil
+			}
+		case stats := <-sub.Updates():
+			data, _ := json.Marshal(stats)
+			if err := write(fmt.Sprintf("event: stats\ndata: %s\n\n", data)); err != nil {
+				return nil
+			}
+		}
+	}
+}
+
+func (s *Server) serveWebSocket(ctx context.Context, c echo.Context, sub *Subscriber) error {
+	conn, err := s.upgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+
+	s.connections("websocket", 1)
+	defer s.connections("websocket", -1)
+
+	// Clients only send control frames; the reader keeps the pong handler
+	// running and notices when the peer goes away.
+	closed := make(chan struct{})
+	conn.SetReadLimit(512)
+	conn.SetReadDeadline(time.Now().Add(2 * s.cfg.Heartbeat))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * s.cfg.Heartbeat))
+	})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(s.cfg.Heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return nil
+		case <-ctx.Done():
+			code, reason := websocket.ClosePolicyViolation, "server closing"
+			switch {
+			case s.ctx.Err() != nil:
+				code, reason = websocket.CloseGoingAway, "server shutting down"
+			case ctx.Err() == context.DeadlineExceeded:
+				reason = "token expired"
+			}
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(code, reason),
+				time.Now().Add(s.cfg.WriteTimeout))
+			return nil
+		case <-heartbeat.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(s.cfg.WriteTimeout)); err != nil {
+				return nil
+			}
+		case stats := <-sub.Updates():
+			conn.SetWriteDeadline(time.Now().Add(s.cfg.WriteTimeout))
+			if err := conn.WriteJSON(stats); err != nil {
+				return nil
+			}
+		}
+	}
+}
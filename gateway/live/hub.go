@@ -0,0 +1,145 @@
+package live
+
+import (
+	"context"
+	"sync"
+)
+
+type Stats struct {
+	PostID   string `json:"post_id"`
+	Views    uint64 `json:"views"`
+	Likes    uint64 `json:"likes"`
+	Comments uint64 `json:"comments"`
+}
+
+type Kind int
+
+const (
+	View Kind = iota
+	Like
+	Comment
+	// Unlike takes back a like.
+	Unlike
+)
+
+// Subscriber receives the stats of one post. Only the latest snapshot is
+// kept, so a slow reader skips intermediate updates instead of blocking the
+// hub.
+type Subscriber struct {
+	postID  string
+	updates chan Stats
+}
+
+func (s *Subscriber) Updates() <-chan Stats {
+	return s.updates
+}
+
+type post struct {
+	stats Stats
+	subs  map[*Subscriber]struct{}
+}
+
+// Hub keeps the counters of posts that have at least one subscriber. The
+// counters are seeded from the statistics service when the first client
+// subscribes and then advanced by interaction events.
+type Hub struct {
+	load func(ctx context.Context, postID string) (Stats, error)
+
+	mu    sync.Mutex
+	posts map[string]*post
+
+	coalesced func()
+}
+
+func NewHub(load func(ctx context.Context, postID string) (Stats, error)) *Hub {
+	return &Hub{
+		load:      load,
+		posts:     make(map[string]*post),
+		coalesced: func() {},
+	}
+}
+
+// OnCoalesced registers a callback invoked whenever an update replaces one
+// that a subscriber has not read yet.
+func (h *Hub) OnCoalesced(f func()) {
+	h.coalesced = f
+}
+
+func (h *Hub) Subscribe(ctx context.Context, postID string) (*Subscriber, error) {
+	snapshot, err := h.load(ctx, postID)
+	if err != nil {
+		return nil, err
+	}
+	snapshot.PostID = postID
+
+	sub := &Subscriber{postID: postID, updates: make(chan Stats, 1)}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	p, ok := h.posts[postID]
+	if !ok {
+		p = &post{stats: snapshot, subs: make(map[*Subscriber]struct{})}
+		h.posts[postID] = p
+	}
+	p.subs[sub] = struct{}{}
+	sub.updates <- p.stats
+	return sub, nil
+}
+
+func (h *Hub) Unsubscribe(sub *Subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	p, ok := h.posts[sub.postID]
+	if !ok {
+		return
+	}
+	delete(p.subs, sub)
+	if len(p.subs) == 0 {
+		delete(h.posts, sub.postID)
+	}
+}
+
+// Apply records an interaction and notifies the subscribers of the post.
+// Events for posts nobody watches are ignored.
+func (h *Hub) Apply(postID string, kind Kind) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	p, ok := h.posts[postID]
+	if !ok {
+		return
+	}
+	switch kind {
+	case View:
+		p.stats.Views++
+	case Like:
+		p.stats.Likes++
+	case Comment:
+		p.stats.Comments++
+	case Unlike:
+		if p.stats.Likes > 0 {
+			p.stats.Likes--
+		}
+	}
+
+	for sub := range p.subs {
+		select {
+		case sub.updates <- p.stats:
+		default:
+			select {
+			case <-sub.updates:
+				h.coalesced()
+			default:
+			}
+			sub.updates <- p.stats
+		}
+	}
+}
+
+func (h *Hub) Watched() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.posts)
+}
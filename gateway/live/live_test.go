@@ -0,0 +1,257 @@
+package live
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/nanoservices/pkg/pubsub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func staticLoader(stats Stats) func(context.Context, string) (Stats, error) {
+	return func(context.Context, string) (Stats, error) { return stats, nil }
+}
+
+func TestHubCoalescesUpdates(t *testing.T) {
+	hub := NewHub(staticLoader(Stats{Views: 10}))
+	coalesced := 0
+	hub.OnCoalesced(func() { coalesced++ })
+
+	sub, err := hub.Subscribe(context.Background(), "p1")
+	require.NoError(t, err)
+
+	hub.Apply("p1", View)
+	hub.Apply("p1", Like)
+	hub.Apply("p1", Comment)
+	hub.Apply("other", View)
+
+	got := <-sub.Updates()
+	assert.Equal(t, Stats{PostID: "p1", Views: 11, Likes: 1, Comments: 1}, got)
+	assert.Equal(t, 3, coalesced)
+
+	select {
+	case s := <-sub.Updates():
+		t.Fatalf("unexpected update %+v", s)
+	default:
+	}
+
+	hub.Unsubscribe(sub)
+	assert.Equal(t, 0, hub.Watched())
+}
+
+func TestHubSharesCountersBetweenSubscribers(t *testing.T) {
+	loads := 0
+	hub := NewHub(func(context.Context, string) (Stats, error) {
+		loads++
+		return Stats{Views: uint64(loads)}, nil
+	})
+
+	first, _ := hub.Subscribe(context.Background(), "p1")
+	<-first.Updates()
+	hub.Apply("p1", View)
+
+	second, _ := hub.Subscribe(context.Background(), "p1")
+	assert.Equal(t, uint64(2), (<-second.Updates()).Views)
+	assert.Equal(t, uint64(2), (<-first.Updates()).Views)
+}
+
+func newTestServer(t *testing.T, hub *Hub, authorize func(context.Context, string, string) error) (*httptest.Server, *Server) {
+	t.Helper()
+	s := NewServer(hub, Config{
+		Authorize: authorize,
+		Reject: func(c echo.Context, err error) error {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+		},
+		Heartbeat: 50 * time.Millisecond,
+	})
+
+	e := echo.New()
+	e.GET("/api/stats/posts/:id/live", s.Handler, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("user_id", "viewer")
+			return next(c)
+		}
+	})
+	srv := httptest.NewServer(e)
+	t.Cleanup(srv.Close)
+	return srv, s
+}
+
+func allowAll(context.Context, string, string) error { return nil }
+
+func TestSSE(t *testing.T) {
+	hub := NewHub(staticLoader(Stats{Views: 3}))
+	srv, _ := newTestServer(t, hub, allowAll)
+
+	resp, err := http.Get(srv.URL + "/api/stats/posts/p1/live")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	lines := bufio.NewScanner(resp.Body)
+	next := func(prefix string) string {
+		for lines.Scan() {
+			if strings.HasPrefix(lines.Text(), prefix) {
+				return lines.Text()
+			}
+		}
+		t.Fatalf("stream ended before %q", prefix)
+		return ""
+	}
+
+	assert.Equal(t, `data: {"post_id":"p1","views":3,"likes":0,"comments":0}`, next("data:"))
+	hub.Apply("p1", Like)
+	assert.Equal(t, `data: {"post_id":"p1","views":3,"likes":1,"comments":0}`, next("data:"))
+	assert.Equal(t, ": ping", next(":"))
+}
+
+func TestCloseEndsStreams(t *testing.T) {
+	hub := NewHub(staticLoader(Stats{Views: 3}))
+	srv, s := newTestServer(t, hub, allowAll)
+
+	resp, err := http.Get(srv.URL + "/api/stats/posts/p1/live")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	lines := bufio.NewScanner(resp.Body)
+	require.True(t, lines.Scan())
+
+	s.Close()
+
+	ended := make(chan struct{})
+	go func() {
+		for lines.Scan() {
+		}
+		close(ended)
+	}()
+	select {
+	case <-ended:
+	case <-time.After(time.Second):
+		t.Fatal("stream still open after Close")
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	hub := NewHub(staticLoader(Stats{Comments: 1}))
+	srv, _ := newTestServer(t, hub, allowAll)
+
+	pinged := make(chan struct{}, 1)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/api/stats/posts/p1/live", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetPingHandler(func(string) error {
+		select {
+		case pinged <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+
+	var stats Stats
+	require.NoError(t, conn.ReadJSON(&stats))
+	assert.Equal(t, uint64(1), stats.Comments)
+
+	hub.Apply("p1", Comment)
+	require.NoError(t, conn.ReadJSON(&stats))
+	assert.Equal(t, uint64(2), stats.Comments)
+
+	go conn.ReadMessage()
+	select {
+	case <-pinged:
+	case <-time.After(time.Second):
+		t.Fatal("no heartbeat")
+	}
+}
+
+func TestRejectsUnauthorizedPost(t *testing.T) {
+	hub := NewHub(staticLoader(Stats{}))
+	srv, _ := newTestServer(t, hub, func(context.Context, string, string) error {
+		return errors.New("access denied")
+	})
+
+	resp, err := http.Get(srv.URL + "/api/stats/posts/private/live")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, 0, hub.Watched())
+}
+
+func TestInteraction(t *testing.T) {
+	tests := []struct {
+		topic, value string
+		postID       string
+		kind         Kind
+	}{
+		{"post_likes", `{"id": "e1", "type": "post.liked", "version": 1, "occurred_at": "2026-03-01T12:00:00Z",
+			"producer": "events_service", "payload": {"post_id": "p1", "user_id": "u1"}}`, "p1", Like},
+		{"post_likes", `{"id": "e2", "type": "post.unliked", "version": 1, "occurred_at": "2026-03-01T12:00:00Z",
+			"producer": "events_service", "payload": {"post_id": "p1", "user_id": "u1"}}`, "p1", Unlike},
+		{"post_views", `{"post_id": "p2", "user_id": "u1", "timestamp": "2026-03-01T12:00:00"}`, "p2", View},
+		{"post_views", `{"user_id": "u1"}`, "", View},
+		{"post_views", `not json`, "", View},
+	}
+	for _, tt := range tests {
+		postID, kind := interaction(tt.topic, []byte(tt.value))
+		assert.Equal(t, tt.postID, postID, tt.value)
+		if tt.postID != "" {
+			assert.Equal(t, tt.kind, kind, tt.value)
+		}
+	}
+}
+
+func TestUnlikeDoesNotGoBelowZero(t *testing.T) {
+	hub := NewHub(staticLoader(Stats{Likes: 1}))
+	sub, err := hub.Subscribe(context.Background(), "p1")
+	require.NoError(t, err)
+
+	hub.Apply("p1", Unlike)
+	hub.Apply("p1", Unlike)
+
+	assert.Equal(t, Stats{PostID: "p1"}, <-sub.Updates())
+}
+
+func TestConsumeAppliesEvents(t *testing.T) {
+	hub := NewHub(staticLoader(Stats{}))
+	sub, err := hub.Subscribe(context.Background(), "p1")
+	require.NoError(t, err)
+
+	broker := pubsub.NewMemory()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- Consume(ctx, broker, hub) }()
+
+	publish := func(topic, value string) {
+		require.NoError(t, broker.Publish(context.Background(), pubsub.Message{Topic: topic, Value: []byte(value)}))
+	}
+	// The first publish may race with the subscription.
+	require.Eventually(t, func() bool {
+		publish("post_views", `{"post_id": "p1"}`)
+		select {
+		case got := <-sub.Updates():
+			return got.Views > 0
+		case <-time.After(10 * time.Millisecond):
+			return false
+		}
+	}, time.Second, time.Millisecond)
+
+	publish("post_likes", `not json`)
+	publish("post_likes", `{"post_id": "p1"}`)
+	for got := range sub.Updates() {
+		if got.Likes > 0 {
+			assert.Equal(t, uint64(1), got.Likes)
+			break
+		}
+	}
+
+	cancel()
+	assert.NoError(t, <-done)
+}
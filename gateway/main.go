@@ -3,148 +3,340 @@ package main
 import (
 	"bytes"
 	"context"
-	"encoding/json"
+	_ "embed"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/nanoservices/gateway/cache"
+	"github.com/nanoservices/gateway/events"
+	"github.com/nanoservices/gateway/gql"
+	"github.com/nanoservices/gateway/idempotency"
+	"github.com/nanoservices/gateway/live"
+	"github.com/nanoservices/gateway/metrics"
 	authMiddleware "github.com/nanoservices/gateway/middleware"
-	"github.com/segmentio/kafka-go"
+	"github.com/nanoservices/gateway/problem"
+	"github.com/nanoservices/gateway/spool"
+	"github.com/nanoservices/gateway/users"
+	"github.com/nanoservices/gateway/validation"
+	"github.com/nanoservices/pkg/logging"
+	"github.com/nanoservices/pkg/tracing"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
 
-var kafkaWriter *kafka.Writer
+//go:embed openapi.yaml
+var openAPISpec []byte
 
-func initKafka() {
-	kafkaWriter = kafka.NewWriter(kafka.WriterConfig{
-		Brokers: []string{"kafka:9092"},
-		Topic:   "user_registrations",
-	})
+var httpClient = &http.Client{
+	Transport: otelhttp.NewTransport(metrics.Transport("users_service", http.DefaultTransport)),
 }
 
 func main() {
-	initKafka()
-	defer kafkaWriter.Close()
-	e := echo.New()
-	e.Use(middleware.Logger())
-	e.Use(middleware.Recover())
+	if err := logging.Setup("gateway", os.Getenv("LOG_LEVEL")); err != nil {
+		slog.Error("Invalid LOG_LEVEL", "error", err)
+		os.Exit(1)
+	}
 
-	userServiceURL := os.Getenv("USER_SERVICE_URL")
+	shutdownTracing, err := tracing.Init(context.Background(), "gateway")
+	if err != nil {
+		slog.Error("Failed to init tracing", "error", err)
+		os.Exit(1)
+	}
+	defer shutdownTracing(context.Background())
 
-	e.POST("/api/register", func(c echo.Context) error {
-		body, statusCode, err := proxyRequest(c, userServiceURL+"/api/register")
-		if err != nil {
-			return c.String(http.StatusInternalServerError, "Internal server error")
-		}
+	registry, err := events.LoadRegistry()
+	if err != nil {
+		slog.Error("Failed to load event schemas", "error", err)
+		os.Exit(1)
+	}
+	eventProducer := events.NewProducer("gateway", registry)
 
-		var resp map[string]interface{}
-		if err := json.Unmarshal(body, &resp); err != nil {
-			log.Printf("Failed to parse response: %v", err)
-			return c.String(http.StatusInternalServerError, "Invalid response format")
-		}
+	broker, err := newEventBroker(os.Getenv("EVENT_BROKER"))
+	if err != nil {
+		slog.Error("Failed to connect to the event broker", "error", err)
+		os.Exit(1)
+	}
+	defer broker.Close()
 
-		userID, ok := resp["id"].(string)
-		if !ok {
-			log.Printf("Missing 'id' in response: %v", resp)
-			return c.String(http.StatusInternalServerError, "User ID not found")
-		}
+	spoolDir := os.Getenv("KAFKA_SPOOL_DIR")
+	if spoolDir == "" {
+		spoolDir = "kafka-spool"
+	}
+	eventSpool, err := spool.Open(spool.Config{Dir: spoolDir}, metrics.Publisher(broker.publisher))
+	if err != nil {
+		slog.Error("Failed to open event spool", "dir", spoolDir, "error", err)
+		os.Exit(1)
+	}
+	metrics.RegisterSpool(eventSpool.Stats)
+	spoolCtx, stopSpool := context.WithCancel(context.Background())
+	go eventSpool.Run(spoolCtx)
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	e.HTTPErrorHandler = problem.HTTPErrorHandler
+	if e.IPExtractor, err = newIPExtractor(os.Getenv("TRUSTED_PROXIES")); err != nil {
+		slog.Error("Invalid TRUSTED_PROXIES", "error", err)
+		os.Exit(1)
+	}
+	e.Use(authMiddleware.RequestID())
+	e.Use(authMiddleware.AccessLog())
+	e.Use(middleware.Recover())
+	e.Use(tracing.Middleware())
+	e.Use(metrics.Middleware())
 
-		msg := fmt.Sprintf(`{"user_id": "%s", "timestamp": "%s"}`,
-			userID, time.Now().Format(time.RFC3339))
-		if err := kafkaWriter.WriteMessages(context.Background(),
-			kafka.Message{Value: []byte(msg)}); err != nil {
-			log.Printf("Failed to send Kafka message: %v", err)
-		}
+	validator, err := newValidator(os.Getenv("OPENAPI_VALIDATION"))
+	if err != nil {
+		slog.Error("Failed to set up OpenAPI validation", "error", err)
+		os.Exit(1)
+	}
+	if validator != nil {
+		e.Use(validator.Middleware())
+	}
 
-		return c.String(statusCode, string(body))
-	})
+	e.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
+
+	userServiceURL := os.Getenv("USER_SERVICE_URL")
+	idempotent := idempotency.NewStore(24 * time.Hour).Middleware()
+
+	e.POST("/api/register", registerHandler(userServiceURL, eventProducer, eventSpool), idempotent)
 
 	e.POST("/api/login", func(c echo.Context) error {
-		body, statusCode, _ := proxyRequest(c, userServiceURL+"/api/login")
-		return c.String(statusCode, string(body))
+		body, statusCode, err := proxyRequest(c, userServiceURL+"/api/login")
+		if err != nil {
+			return usersUnavailable(c, err)
+		}
+		return c.JSONBlob(statusCode, body)
 	})
 
 	e.GET("/api/profile", func(c echo.Context) error {
-		body, statusCode, _ := proxyRequest(c, userServiceURL+"/api/profile")
-		return c.String(statusCode, string(body))
+		body, statusCode, err := proxyRequest(c, userServiceURL+"/api/profile")
+		if err != nil {
+			return usersUnavailable(c, err)
+		}
+		return c.JSONBlob(statusCode, body)
 	})
 
 	e.POST("/api/profile", func(c echo.Context) error {
-		body, statusCode, _ := proxyRequest(c, userServiceURL+"/api/profile")
-		return c.String(statusCode, string(body))
+		body, statusCode, err := proxyRequest(c, userServiceURL+"/api/profile")
+		if err != nil {
+			return usersUnavailable(c, err)
+		}
+		return c.JSONBlob(statusCode, body)
 	})
 	initGRPC()
 	initStatsGRPC()
+	initNotificationsGRPC()
+	usersClient = users.NewClient(userServiceURL, httpClient)
+
+	liveHub := live.NewHub(loadLiveStats)
+	liveHub.OnCoalesced(metrics.LiveCoalesced)
+	liveServer := live.NewServer(liveHub, live.Config{
+		Authorize: authorizeLiveStats,
+		Reject:    handleGRPCError,
+	})
+	liveServer.OnConnection(metrics.LiveConnections)
+
+	consumerCtx, stopConsumer := context.WithCancel(context.Background())
+	defer stopConsumer()
+	go func() {
+		if err := live.Consume(consumerCtx, broker.live, liveHub); err != nil {
+			logging.For(broker.name).Error("Live stats consumer stopped", "error", err)
+		}
+	}()
+
+	checker := newHealthChecker(userServiceURL, broker)
+	e.GET("/healthz", checker.Liveness)
+	e.GET("/readyz", checker.Readiness)
 
 	apiGroup := e.Group("")
 	apiGroup.Use(authMiddleware.JWTAuth(os.Getenv("JWT_SECRET")))
 
-	apiGroup.POST("/api/posts", CreatePost)
+	transcoder, err := newTranscoder(postConn, statsConn, notificationsConn)
+	if err != nil {
+		slog.Error("Failed to register transcoded routes", "error", err)
+		os.Exit(1)
+	}
+	transcoded := transcode(transcoder)
+
+	apiGroup.POST("/api/posts", transcoded, idempotent)
+
+	apiGroup.GET("/api/posts/search", transcoded)
+	apiGroup.GET("/api/posts/:id", transcoded)
+	apiGroup.GET("/api/posts/:id/full", GetPostFull)
+
+	apiGroup.PUT("/api/posts/:id", transcoded)
 
-	apiGroup.GET("/api/posts/:id", GetPost)
+	apiGroup.DELETE("/api/posts/:id", transcoded)
 
-	apiGroup.PUT("/api/posts/:id", UpdatePost)
+	apiGroup.GET("/api/posts_list", transcoded)
+	apiGroup.POST("/api/posts/view/:id", transcoded)
+	apiGroup.POST("/api/posts/like/:id", transcoded)
+	apiGroup.DELETE("/api/posts/like/:id", transcoded)
+	apiGroup.POST("/api/posts/comment/:id", transcoded, idempotent)
+	apiGroup.GET("/api/posts/comments/:id", transcoded)
+	apiGroup.PUT("/api/posts/:id/comments/:comment_id", transcoded)
+	apiGroup.DELETE("/api/posts/:id/comments/:comment_id", transcoded)
+	apiGroup.PUT("/api/posts/:id/reactions", transcoded)
+	apiGroup.DELETE("/api/posts/:id/reactions", transcoded)
+	apiGroup.PUT("/api/posts/:id/comments/:comment_id/reactions", transcoded)
+	apiGroup.DELETE("/api/posts/:id/comments/:comment_id/reactions", transcoded)
+	apiGroup.GET("/api/reactions", transcoded)
+	apiGroup.POST("/api/posts/:id/bookmark", transcoded)
+	apiGroup.DELETE("/api/posts/:id/bookmark", transcoded)
+	apiGroup.GET("/api/me/bookmarks", transcoded)
+	apiGroup.POST("/api/me/bookmarks/collections", transcoded)
+	apiGroup.GET("/api/me/bookmarks/collections", transcoded)
+	apiGroup.DELETE("/api/me/bookmarks/collections/:collection_id", transcoded)
+	apiGroup.POST("/api/reports", transcoded)
 
-	apiGroup.DELETE("/api/posts/:id", DeletePost)
+	moderator := authMiddleware.RequireRole("moderator")
+	apiGroup.GET("/api/moderation/queue", transcoded, moderator)
+	apiGroup.POST("/api/moderation/decisions", transcoded, moderator)
+	apiGroup.GET("/api/moderation/decisions", transcoded, moderator)
 
-	apiGroup.GET("/api/posts_list", ListPosts)
-	apiGroup.POST("/api/posts/view/:id", ViewPost)
-	apiGroup.POST("/api/posts/like/:id", LikePost)
-	apiGroup.POST("/api/posts/comment/:id", CommentPost)
-	apiGroup.GET("/api/posts/comments/:id", GetComments)
+	apiGroup.GET("/api/notifications", transcoded)
+	apiGroup.GET("/api/notifications/unread_count", transcoded)
+	apiGroup.POST("/api/notifications/read", transcoded)
+	apiGroup.GET("/api/notifications/settings", transcoded)
+	apiGroup.PUT("/api/notifications/settings", transcoded)
 
-	apiGroup.GET("/api/stats/posts/:id", GetPostStats)
-	apiGroup.GET("/api/stats/posts/:id/views/trend", GetViewsTrend)
-	apiGroup.GET("/api/stats/posts/:id/likes/trend", GetLikesTrend)
-	apiGroup.GET("/api/stats/posts/:id/comments/trend", GetCommentsTrend)
-	apiGroup.GET("/api/stats/top/posts", GetTopPosts)
-	apiGroup.GET("/api/stats/top/users", GetTopUsers)
+	statsCache := cache.NewStore(32 << 20)
+	metrics.RegisterCache("stats", statsCache.Stats)
+
+	trendCache := statsCache.Middleware(cache.Config{TTL: 30 * time.Second, StaleWhileRevalidate: 2 * time.Minute})
+	topCache := statsCache.Middleware(cache.Config{TTL: time.Minute, StaleWhileRevalidate: 5 * time.Minute})
+
+	apiGroup.GET("/api/stats/posts/:id", transcoded)
+	e.GET("/api/stats/posts/:id/live", liveServer.Handler,
+		authMiddleware.JWTAuthWithQueryToken(os.Getenv("JWT_SECRET"), "access_token"))
+	apiGroup.GET("/api/stats/posts/:id/views/trend", transcoded, trendCache)
+	apiGroup.GET("/api/stats/posts/:id/likes/trend", transcoded, trendCache)
+	apiGroup.GET("/api/stats/posts/:id/comments/trend", transcoded, trendCache)
+	apiGroup.GET("/api/stats/posts/:id/reactions/trend", transcoded, trendCache)
+	apiGroup.GET("/api/stats/top/posts", transcoded, topCache)
+	apiGroup.GET("/api/stats/top/users", transcoded, topCache)
+
+	graphqlServer, err := gql.NewServer(gql.Config{
+		Posts: postClient,
+		Stats: statsClient,
+		Users: usersClient,
+	})
+	if err != nil {
+		slog.Error("Failed to build GraphQL schema", "error", err)
+		os.Exit(1)
+	}
+	apiGroup.GET("/graphql", graphqlServer.Handler)
+	apiGroup.POST("/graphql", graphqlServer.Handler)
 
 	s := &http.Server{
 		Addr: ":8080",
 	}
 
 	go func() {
+		slog.Info("Starting server", "addr", s.Addr)
 		if err := e.StartServer(s); err != nil {
-			e.Logger.Info("Shutting down the server")
+			slog.Info("Shutting down the server", "reason", err)
 		}
 	}()
 
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
+	checker.Shutdown()
+	liveServer.Close()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	if err := e.Shutdown(ctx); err != nil {
-		e.Logger.Fatal("HTTP server shutdown error:", err)
+		slog.Error("HTTP server shutdown error", "error", err)
+	}
+
+	// The spool gets its own deadline, a slow shutdown must not cost the
+	// events that are still on disk.
+	stopSpool()
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	if err := eventSpool.Flush(flushCtx); err != nil {
+		slog.Warn("Spooled events are kept for the next start",
+			"messages", eventSpool.Stats().Messages, "error", err)
 	}
+	eventSpool.Close()
 
 	select {
 	case <-ctx.Done():
-		log.Printf("timeout of 5 seconds.\n")
+		slog.Info("timeout of 5 seconds.")
+	}
+}
+
+// newValidator reads OPENAPI_VALIDATION: requests (the default) rejects
+// requests that do not match openapi.yaml, all also logs responses that do
+// not match it and is meant for development, off disables validation.
+func newValidator(mode string) (*validation.Validator, error) {
+	switch mode {
+	case "off":
+		return nil, nil
+	case "", "requests":
+		return validation.New(openAPISpec, validation.Config{})
+	case "all":
+		return validation.New(openAPISpec, validation.Config{Responses: true})
+	}
+	return nil, fmt.Errorf("unknown OPENAPI_VALIDATION %q, expected requests, all or off", mode)
+}
+
+// newIPExtractor reads TRUSTED_PROXIES, a comma separated list of CIDRs of
+// the proxies in front of the gateway. X-Forwarded-For is only believed when
+// it was added by one of them, without the list the client address is the
+// peer of the connection. The address scopes idempotency keys of anonymous
+// callers, so it must not be taken from headers the client controls.
+func newIPExtractor(trusted string) (echo.IPExtractor, error) {
+	var options []echo.TrustOption
+	for _, cidr := range strings.Split(trusted, ",") {
+		if cidr = strings.TrimSpace(cidr); cidr == "" {
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, echo.TrustIPRange(ipNet))
+	}
+	if len(options) == 0 {
+		return echo.ExtractIPDirect(), nil
 	}
+	// Loopback, link-local and private ranges are only trusted when listed.
+	options = append(options, echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false))
+	return echo.ExtractIPFromXFFHeader(options...), nil
+}
+
+func usersUnavailable(c echo.Context, err error) error {
+	logging.For("proxy").ErrorContext(c.Request().Context(), "Users service request failed", "error", err)
+	return problem.Write(c, problem.New(http.StatusBadGateway, "users service is unavailable"))
 }
 
 func proxyRequest(c echo.Context, targetURL string) ([]byte, int, error) {
-	client := &http.Client{}
 	reqBody, _ := io.ReadAll(c.Request().Body)
-	req, _ := http.NewRequest(
+	req, _ := http.NewRequestWithContext(
+		c.Request().Context(),
 		c.Request().Method,
 		targetURL,
 		bytes.NewBuffer(reqBody),
 	)
 	req.Header = c.Request().Header.Clone()
+	req.Header.Set(logging.RequestIDHeader, logging.RequestID(c.Request().Context()))
 
-	resp, err := client.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return nil, 0, fmt.Errorf("proxy error: %w", err)
 	}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewIPExtractor(t *testing.T) {
+	request := func(remoteAddr, forwardedFor string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/api/register", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set(echo.HeaderXForwardedFor, forwardedFor)
+		req.Header.Set(echo.HeaderXRealIP, forwardedFor)
+		return req
+	}
+
+	t.Run("No trusted proxies", func(t *testing.T) {
+		extract, err := newIPExtractor("")
+		require.NoError(t, err)
+
+		assert.Equal(t, "10.0.0.5", extract(request("10.0.0.5:4321", "203.0.113.7")))
+	})
+
+	t.Run("Trusted proxy", func(t *testing.T) {
+		extract, err := newIPExtractor("10.0.0.0/24, 192.168.1.0/24")
+		require.NoError(t, err)
+
+		assert.Equal(t, "203.0.113.7", extract(request("10.0.0.5:4321", "203.0.113.7")))
+		assert.Equal(t, "172.16.0.9", extract(request("172.16.0.9:4321", "203.0.113.7")))
+	})
+
+	t.Run("Invalid CIDR", func(t *testing.T) {
+		_, err := newIPExtractor("10.0.0.0/33")
+		assert.Error(t, err)
+	})
+}
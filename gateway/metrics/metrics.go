@@ -0,0 +1,238 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nanoservices/gateway/cache"
+	"github.com/nanoservices/gateway/spool"
+	"github.com/nanoservices/pkg/pubsub"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+const namespace = "gateway"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests handled by the gateway.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests handled by the gateway.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	upstreamRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_requests_total",
+		Help:      "Requests sent by the gateway to upstream services.",
+	}, []string{"service", "method", "code"})
+
+	upstreamDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upstream_request_duration_seconds",
+		Help:      "Latency of requests sent by the gateway to upstream services.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"service", "method"})
+
+	kafkaPublished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "kafka_publish_total",
+		Help:      "Kafka publish attempts by topic and result.",
+	}, []string{"topic", "result"})
+
+	liveConnections = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "live",
+		Name:      "connections",
+		Help:      "Open live stats streams by transport.",
+	}, []string{"transport"})
+
+	liveCoalesced = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "live",
+		Name:      "coalesced_updates_total",
+		Help:      "Live stats updates replaced before a slow client read them.",
+	})
+)
+
+// Middleware records request rate, errors and duration per route.
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+
+			err := next(c)
+			if err != nil {
+				c.Error(err)
+			}
+
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			method := c.Request().Method
+			httpRequests.WithLabelValues(method, route, strconv.Itoa(c.Response().Status)).Inc()
+			httpDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+			return nil
+		}
+	}
+}
+
+// UnaryClientInterceptor records rate, errors and duration of the RPCs made
+// to service.
+func UnaryClientInterceptor(service string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any,
+		cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+
+		upstreamRequests.WithLabelValues(service, method, status.Code(err).String()).Inc()
+		upstreamDuration.WithLabelValues(service, method).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+// Transport records rate, errors and duration of HTTP requests proxied to
+// service. The method label is the HTTP method and path of the request.
+func Transport(service string, next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		start := time.Now()
+		method := req.Method + " " + req.URL.Path
+
+		resp, err := next.RoundTrip(req)
+		code := "error"
+		if err == nil {
+			code = strconv.Itoa(resp.StatusCode)
+		}
+		upstreamRequests.WithLabelValues(service, method, code).Inc()
+		upstreamDuration.WithLabelValues(service, method).Observe(time.Since(start).Seconds())
+		return resp, err
+	})
+}
+
+func KafkaPublished(topic string, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	kafkaPublished.WithLabelValues(topic, result).Inc()
+}
+
+func LiveConnections(transport string, delta float64) {
+	liveConnections.WithLabelValues(transport).Add(delta)
+}
+
+func LiveCoalesced() {
+	liveCoalesced.Inc()
+}
+
+// RegisterCache exports the counters of a response cache under the given
+// cache name.
+func RegisterCache(name string, stats func() cache.Stats) {
+	labels := prometheus.Labels{"cache": name}
+	counter := func(metric, help string, value func(cache.Stats) uint64) {
+		promauto.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   "cache",
+			Name:        metric,
+			Help:        help,
+			ConstLabels: labels,
+		}, func() float64 { return float64(value(stats())) })
+	}
+	gauge := func(metric, help string, value func(cache.Stats) float64) {
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   "cache",
+			Name:        metric,
+			Help:        help,
+			ConstLabels: labels,
+		}, func() float64 { return value(stats()) })
+	}
+
+	counter("hits_total", "Responses served fresh from the cache.", func(s cache.Stats) uint64 { return s.Hits })
+	counter("stale_hits_total", "Stale responses served while revalidating.", func(s cache.Stats) uint64 { return s.StaleHits })
+	counter("misses_total", "Requests that were not found in the cache.", func(s cache.Stats) uint64 { return s.Misses })
+	counter("revalidations_total", "Background revalidations of stale entries.", func(s cache.Stats) uint64 { return s.Revalidations })
+	counter("evictions_total", "Entries evicted to stay within the size limit.", func(s cache.Stats) uint64 { return s.Evictions })
+	gauge("entries", "Entries currently stored in the cache.", func(s cache.Stats) float64 { return float64(s.Entries) })
+	gauge("bytes", "Bytes currently stored in the cache.", func(s cache.Stats) float64 { return float64(s.Bytes) })
+}
+
+// RegisterSpool exports the depth and the counters of the Kafka spool.
+func RegisterSpool(stats func() spool.Stats) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "kafka_spool",
+		Name:      "messages",
+		Help:      "Messages waiting in the spool to be sent to Kafka.",
+	}, func() float64 { return float64(stats().Messages) })
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "kafka_spool",
+		Name:      "bytes",
+		Help:      "Size of the messages waiting in the spool.",
+	}, func() float64 { return float64(stats().Bytes) })
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "kafka_spool",
+		Name:      "spooled_total",
+		Help:      "Messages written to the spool because Kafka was unavailable.",
+	}, func() float64 { return float64(stats().Spooled) })
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "kafka_spool",
+		Name:      "drained_total",
+		Help:      "Spooled messages delivered to Kafka.",
+	}, func() float64 { return float64(stats().Drained) })
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "kafka_spool",
+		Name:      "dropped_total",
+		Help:      "Messages lost because the spool was full or could not be written.",
+	}, func() float64 { return float64(stats().Dropped) })
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "kafka_spool",
+		Name:      "dead_lettered_total",
+		Help:      "Spooled messages moved to the dead-letter topic after Kafka kept rejecting them.",
+	}, func() float64 { return float64(stats().DeadLettered) })
+}
+
+// Publisher records every publish of p in kafka_publish_total, once per
+// topic of the published messages.
+func Publisher(p pubsub.EventPublisher) pubsub.EventPublisher {
+	return publisher{p}
+}
+
+type publisher struct {
+	pubsub.EventPublisher
+}
+
+func (p publisher) Publish(ctx context.Context, msgs ...pubsub.Message) error {
+	err := p.EventPublisher.Publish(ctx, msgs...)
+	seen := make(map[string]bool, 1)
+	for _, m := range msgs {
+		if !seen[m.Topic] {
+			seen[m.Topic] = true
+			KafkaPublished(m.Topic, err)
+		}
+	}
+	return err
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/url"
+
+	"github.com/labstack/echo/v4"
+	echoMiddleware "github.com/labstack/echo/v4/middleware"
+	"github.com/nanoservices/pkg/logging"
+)
+
+// AccessLog writes one structured record per request to the "http" logger.
+func AccessLog() echo.MiddlewareFunc {
+	logger := logging.For("http")
+
+	return echoMiddleware.RequestLoggerWithConfig(echoMiddleware.RequestLoggerConfig{
+		LogMethod:    true,
+		LogURI:       true,
+		LogRoutePath: true,
+		LogStatus:    true,
+		LogLatency:   true,
+		LogRemoteIP:  true,
+		LogError:     true,
+		HandleError:  true,
+		LogValuesFunc: func(c echo.Context, v echoMiddleware.RequestLoggerValues) error {
+			level := slog.LevelInfo
+			switch {
+			case v.Status >= 500:
+				level = slog.LevelError
+			case v.Status >= 400:
+				level = slog.LevelWarn
+			}
+
+			attrs := []slog.Attr{
+				slog.String("method", v.Method),
+				slog.String("uri", redactURI(v.URI)),
+				slog.String("route", v.RoutePath),
+				slog.Int("status", v.Status),
+				slog.Duration("latency", v.Latency),
+				slog.String("remote_ip", v.RemoteIP),
+			}
+			if userID, ok := c.Get("user_id").(string); ok {
+				attrs = append(attrs, slog.String("user_id", userID))
+			}
+			if v.Error != nil {
+				attrs = append(attrs, slog.String("error", v.Error.Error()))
+			}
+
+			logger.LogAttrs(c.Request().Context(), level, "request", attrs...)
+			return nil
+		},
+	})
+}
+
+// redactURI hides tokens passed in the query string, see JWTAuthWithQueryToken.
+func redactURI(uri string) string {
+	u, err := url.ParseRequestURI(uri)
+	if err != nil || u.RawQuery == "" {
+		return uri
+	}
+	q := u.Query()
+	if !q.Has("access_token") {
+		return uri
+	}
+	q.Set("access_token", "REDACTED")
+	u.RawQuery = q.Encode()
+	return u.String()
+}
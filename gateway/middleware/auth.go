@@ -1,23 +1,41 @@
 package middleware
 
 import (
+	"net/http"
 	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
+	"github.com/nanoservices/gateway/problem"
 )
 
 func JWTAuth(secret string) echo.MiddlewareFunc {
+	return jwtAuth(secret, "")
+}
+
+// JWTAuthWithQueryToken also accepts the token in the query parameter param
+// for clients that cannot set headers, such as EventSource and browser
+// WebSockets.
+func JWTAuthWithQueryToken(secret, param string) echo.MiddlewareFunc {
+	return jwtAuth(secret, param)
+}
+
+func jwtAuth(secret, queryParam string) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			authHeader := c.Request().Header.Get("Authorization")
+			if authHeader == "" && queryParam != "" {
+				if token := c.QueryParam(queryParam); token != "" {
+					authHeader = "Bearer " + token
+				}
+			}
 			if authHeader == "" {
-				return c.JSON(401, map[string]string{"error": "missing token"})
+				return unauthorized(c, "missing token")
 			}
 
 			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 			if tokenString == "" {
-				return c.JSON(401, map[string]string{"error": "invalid token format"})
+				return unauthorized(c, "invalid token format")
 			}
 
 			token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
@@ -25,17 +43,41 @@ func JWTAuth(secret string) echo.MiddlewareFunc {
 			})
 
 			if err != nil || !token.Valid {
-				return c.JSON(401, map[string]string{"error": "invalid token"})
+				return unauthorized(c, "invalid token")
 			}
 
 			claims := token.Claims.(jwt.MapClaims)
 			userID, ok := claims["user_id"].(string)
 			if !ok {
-				return c.JSON(401, map[string]string{"error": "invalid token claims"})
+				return unauthorized(c, "invalid token claims")
 			}
 
 			c.Set("user_id", userID)
+			if role, ok := claims["role"].(string); ok {
+				c.Set("role", role)
+			}
+			if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+				c.Set("token_expires_at", exp.Time)
+			}
 			return next(c)
 		}
 	}
 }
+
+// RequireRole lets through only the callers whose token carries role. It
+// must run after JWTAuth.
+func RequireRole(role string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if got, _ := c.Get("role").(string); got != role {
+				return problem.Write(c, problem.New(http.StatusForbidden, "requires role "+role))
+			}
+			return next(c)
+		}
+	}
+}
+
+func unauthorized(c echo.Context, detail string) error {
+	c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+	return problem.Write(c, problem.New(http.StatusUnauthorized, detail))
+}
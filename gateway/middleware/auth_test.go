@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveWithToken(t *testing.T, claims jwt.MapClaims) *httptest.ResponseRecorder {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/moderation/queue", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+
+	handler := JWTAuth("secret")(RequireRole("moderator")(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}))
+	require.NoError(t, handler(c))
+	return rec
+}
+
+func TestRequireRole(t *testing.T) {
+	rec := serveWithToken(t, jwt.MapClaims{"user_id": "u1", "role": "moderator"})
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestRequireRoleForbidden(t *testing.T) {
+	for _, claims := range []jwt.MapClaims{
+		{"user_id": "u1", "role": "user"},
+		{"user_id": "u1"},
+	} {
+		rec := serveWithToken(t, claims)
+
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+const (
+	defaultCursorLimit = 10
+	maxCursorLimit     = 100
+)
+
+// nextPageLink builds an RFC 8288 Link header pointing at the page after the
+// one requested with u. The other query parameters, e.g. filters, are kept.
+func nextPageLink(u *url.URL, nextCursor string) string {
+	q := u.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit < 1 || limit > maxCursorLimit {
+		limit = defaultCursorLimit
+	}
+
+	q.Del("page")
+	q.Del("page_size")
+	q.Set("cursor", nextCursor)
+	q.Set("limit", strconv.Itoa(limit))
+
+	next := url.URL{Path: u.Path, RawQuery: q.Encode()}
+	return fmt.Sprintf(`<%s>; rel="next"`, next.String())
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextPageLink(t *testing.T) {
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"/api/posts/comments/p1?cursor=old&page=3", `</api/posts/comments/p1?cursor=next.sig&limit=10>; rel="next"`},
+		{"/api/posts_list?limit=25&sort=oldest", `</api/posts_list?cursor=next.sig&limit=25&sort=oldest>; rel="next"`},
+		{"/api/posts_list?limit=500", `</api/posts_list?cursor=next.sig&limit=10>; rel="next"`},
+	}
+
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.target)
+		assert.Equal(t, tt.want, nextPageLink(u, "next.sig"), tt.target)
+	}
+}
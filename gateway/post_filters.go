@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	pb "github.com/nanoservices/gateway/generated"
+)
+
+const maxTagFilters = 20
+
+var (
+	postSorts = map[string]pb.PostSort{
+		"newest":     pb.PostSort_NEWEST,
+		"oldest":     pb.PostSort_OLDEST,
+		"most_liked": pb.PostSort_MOST_LIKED,
+	}
+	tagMatches = map[string]pb.TagMatch{
+		"any":      pb.TagMatch_ANY_TAG,
+		"all":      pb.TagMatch_ALL_TAGS,
+		"any_tag":  pb.TagMatch_ANY_TAG,
+		"all_tags": pb.TagMatch_ALL_TAGS,
+	}
+
+	// postFilterParams are the query parameters handled by parsePostFilters.
+	postFilterParams = []string{"author_id", "tag", "tags", "tag_match", "created_from", "created_to", "sort"}
+)
+
+// parsePostFilters copies the filter and sort query parameters of a post
+// listing into req. Enum values are matched case-insensitively so both
+// sort=most_liked and sort=MOST_LIKED work.
+func parsePostFilters(q url.Values, req *pb.ListPostsRequest) error {
+	if v := q.Get("author_id"); v != "" {
+		if _, err := uuid.Parse(v); err != nil {
+			return fmt.Errorf("invalid author_id %q", v)
+		}
+		req.AuthorId = v
+	}
+
+	tags, err := queryTags(q)
+	if err != nil {
+		return err
+	}
+	req.Tags = tags
+
+	if v := q.Get("tag_match"); v != "" {
+		match, ok := tagMatches[strings.ToLower(v)]
+		if !ok {
+			return fmt.Errorf("unknown tag_match %q, expected any or all", v)
+		}
+		req.TagMatch = match
+	}
+
+	from, err := queryTime(q, "created_from")
+	if err != nil {
+		return err
+	}
+	to, err := queryTime(q, "created_to")
+	if err != nil {
+		return err
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return fmt.Errorf("created_from must be before created_to")
+	}
+	req.CreatedFrom = formatQueryTime(from)
+	req.CreatedTo = formatQueryTime(to)
+
+	if v := q.Get("sort"); v != "" {
+		sort, ok := postSorts[strings.ToLower(v)]
+		if !ok {
+			return fmt.Errorf("unknown sort %q, expected newest, oldest or most_liked", v)
+		}
+		req.Sort = sort
+	}
+	return nil
+}
+
+// queryTags reads tags given as repeated (?tags=a&tags=b) or comma separated
+// (?tag=a,b) parameters.
+func queryTags(q url.Values) ([]string, error) {
+	var tags []string
+	for _, v := range append(q["tag"], q["tags"]...) {
+		for _, tag := range strings.Split(v, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	if len(tags) > maxTagFilters {
+		return nil, fmt.Errorf("at most %d tags are allowed", maxTagFilters)
+	}
+	return tags, nil
+}
+
+func queryTime(q url.Values, name string) (time.Time, error) {
+	v := q.Get(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
+	}
+	return t, nil
+}
+
+// formatQueryTime uses a fixed number of fractional digits, the Post service
+// parses timestamps with Python's datetime.fromisoformat.
+func formatQueryTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format("2006-01-02T15:04:05.000000Z07:00")
+}
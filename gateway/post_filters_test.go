@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+
+	pb "github.com/nanoservices/gateway/generated"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePostFilters(t *testing.T) {
+	q, _ := url.ParseQuery("author_id=6f1c2b9e-7d4a-4b6e-9c1d-2a8f5e6b7c90&tag=go,grpc&tag=kafka" +
+		"&tag_match=all&created_from=2024-01-01T03:00:00%2B03:00&created_to=2024-02-01T00:00:00Z&sort=most_liked")
+
+	req := &pb.ListPostsRequest{}
+	require.NoError(t, parsePostFilters(q, req))
+
+	assert.Equal(t, "6f1c2b9e-7d4a-4b6e-9c1d-2a8f5e6b7c90", req.AuthorId)
+	assert.Equal(t, []string{"go", "grpc", "kafka"}, req.Tags)
+	assert.Equal(t, pb.TagMatch_ALL_TAGS, req.TagMatch)
+	assert.Equal(t, "2024-01-01T00:00:00.000000Z", req.CreatedFrom)
+	assert.Equal(t, "2024-02-01T00:00:00.000000Z", req.CreatedTo)
+	assert.Equal(t, pb.PostSort_MOST_LIKED, req.Sort)
+}
+
+func TestParsePostFiltersDefaults(t *testing.T) {
+	req := &pb.ListPostsRequest{}
+	require.NoError(t, parsePostFilters(url.Values{}, req))
+
+	assert.Equal(t, &pb.ListPostsRequest{}, req)
+}
+
+func TestParsePostFiltersRejectsUnknownValues(t *testing.T) {
+	for _, query := range []string{
+		"sort=popular",
+		"tag_match=some",
+		"author_id=alice",
+		"created_from=2024-01-01",
+		"created_from=2024-02-01T00:00:00Z&created_to=2024-01-01T00:00:00Z",
+	} {
+		q, _ := url.ParseQuery(query)
+		assert.Error(t, parsePostFilters(q, &pb.ListPostsRequest{}), query)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	pb "github.com/nanoservices/gateway/generated"
+	"github.com/nanoservices/gateway/users"
+	"github.com/nanoservices/pkg/logging"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	postFullTimeout = 3 * time.Second
+	usersClient     *users.Client
+)
+
+// postFullResponse holds the upstream messages already rendered with
+// marshalJSON, so they look the same as on the transcoded routes.
+type postFullResponse struct {
+	Post     json.RawMessage `json:"post"`
+	Author   *users.Profile  `json:"author"`
+	Stats    json.RawMessage `json:"stats"`
+	Comments json.RawMessage `json:"comments"`
+	Partial  bool            `json:"partial"`
+	Missing  []string        `json:"missing,omitempty"`
+}
+
+func marshalPart(m proto.Message) (json.RawMessage, error) {
+	if m == nil || !m.ProtoReflect().IsValid() {
+		return json.RawMessage("null"), nil
+	}
+	return marshalJSON(m)
+}
+
+// GetPostFull returns a post together with its author, stats and the first
+// page of comments. All upstream calls share one deadline; only a failure to
+// load the post itself fails the request, other parts are reported in
+// missing and left null.
+func GetPostFull(c echo.Context) error {
+	userID := c.Get("user_id").(string)
+	postID := c.Param("id")
+
+	pageSize, _ := strconv.Atoi(c.QueryParam("page_size"))
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), postFullTimeout)
+	defer cancel()
+	logger := logging.For("grpc")
+
+	var (
+		wg       sync.WaitGroup
+		res      postFullResponse
+		post     *pb.PostResponse
+		stats    *pb.PostStatsResponse
+		comments *pb.CommentsResponse
+		postErr  error
+		statsErr error
+		commErr  error
+		authErr  error
+	)
+
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		post, postErr = postClient.GetPost(ctx, &pb.GetPostRequest{PostId: postID, UserId: userID})
+		if postErr != nil {
+			cancel()
+			return
+		}
+		author, err := usersClient.Profiles(ctx, c.Request().Header.Get("Authorization"), []string{post.UserId})
+		if p, ok := author[post.UserId]; ok {
+			res.Author = &p
+		} else {
+			authErr = err
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		stats, statsErr = statsClient.GetPostStats(ctx, &pb.PostStatsRequest{PostId: postID})
+	}()
+	go func() {
+		defer wg.Done()
+		comments, commErr = postClient.GetComments(ctx, &pb.GetCommentsRequest{
+			PostId:   postID,
+			Page:     1,
+			PageSize: int32(pageSize),
+			UserId:   userID,
+		})
+	}()
+	wg.Wait()
+
+	if postErr != nil {
+		return handleGRPCError(c, postErr)
+	}
+
+	missing := func(part string, err error) {
+		logger.WarnContext(ctx, "Partial post response", "post_id", postID, "part", part, "error", err)
+		res.Missing = append(res.Missing, part)
+	}
+	if res.Author == nil {
+		missing("author", authErr)
+	}
+	if statsErr != nil {
+		missing("stats", statsErr)
+	}
+	if commErr != nil {
+		missing("comments", commErr)
+	}
+	res.Partial = len(res.Missing) > 0
+
+	var err error
+	if res.Post, err = marshalPart(post); err != nil {
+		return err
+	}
+	if res.Stats, err = marshalPart(stats); err != nil {
+		return err
+	}
+	if res.Comments, err = marshalPart(comments); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	pb "github.com/nanoservices/gateway/generated"
+	"github.com/nanoservices/gateway/users"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+type fakePostClient struct {
+	pb.PostServiceClient
+	postErr     error
+	commentsErr error
+}
+
+func (f *fakePostClient) GetPost(ctx context.Context, req *pb.GetPostRequest, _ ...grpc.CallOption) (*pb.PostResponse, error) {
+	if f.postErr != nil {
+		return nil, f.postErr
+	}
+	return &pb.PostResponse{Id: req.PostId, Title: "Hello", UserId: "author-1"}, nil
+}
+
+func (f *fakePostClient) GetComments(ctx context.Context, req *pb.GetCommentsRequest, _ ...grpc.CallOption) (*pb.CommentsResponse, error) {
+	if f.commentsErr != nil {
+		return nil, f.commentsErr
+	}
+	return &pb.CommentsResponse{Comments: []*pb.Comment{{Id: "c1", Content: "Nice"}}, Total: 1}, nil
+}
+
+type fakeStatsClient struct {
+	pb.StatsServiceClient
+	delay time.Duration
+}
+
+func (f *fakeStatsClient) GetPostStats(ctx context.Context, req *pb.PostStatsRequest, _ ...grpc.CallOption) (*pb.PostStatsResponse, error) {
+	select {
+	case <-time.After(f.delay):
+		return &pb.PostStatsResponse{Views: 7}, nil
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+func setupPostFull(t *testing.T, posts *fakePostClient, stats *fakeStatsClient) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"profiles":[{"user_id":"author-1","username":"alice"}]}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	oldPosts, oldStats, oldUsers := postClient, statsClient, usersClient
+	postClient, statsClient, usersClient = posts, stats, users.NewClient(srv.URL, srv.Client())
+	t.Cleanup(func() { postClient, statsClient, usersClient = oldPosts, oldStats, oldUsers })
+}
+
+// postFull is the decoded body of GET /api/posts/:id/full.
+type postFull struct {
+	Post     *pb.PostResponse
+	Author   *users.Profile
+	Stats    *pb.PostStatsResponse
+	Comments *pb.CommentsResponse
+	Partial  bool
+	Missing  []string
+}
+
+func decodePart[M proto.Message](t *testing.T, raw json.RawMessage, m M) M {
+	t.Helper()
+	if string(raw) == "null" {
+		var zero M
+		return zero
+	}
+	require.NoError(t, protojson.Unmarshal(raw, m))
+	return m
+}
+
+func getPostFull(t *testing.T) (*httptest.ResponseRecorder, postFull) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/posts/p1/full", nil)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues("p1")
+	c.Set("user_id", "viewer")
+
+	require.NoError(t, GetPostFull(c))
+	var res postFull
+	if rec.Code == http.StatusOK {
+		var raw postFullResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &raw))
+		res = postFull{
+			Post:     decodePart(t, raw.Post, &pb.PostResponse{}),
+			Author:   raw.Author,
+			Stats:    decodePart(t, raw.Stats, &pb.PostStatsResponse{}),
+			Comments: decodePart(t, raw.Comments, &pb.CommentsResponse{}),
+			Partial:  raw.Partial,
+			Missing:  raw.Missing,
+		}
+	}
+	return rec, res
+}
+
+func TestGetPostFull(t *testing.T) {
+	t.Run("All parts", func(t *testing.T) {
+		setupPostFull(t, &fakePostClient{}, &fakeStatsClient{})
+
+		rec, res := getPostFull(t)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.False(t, res.Partial)
+		assert.Equal(t, "Hello", res.Post.Title)
+		assert.Equal(t, "alice", res.Author.Username)
+		assert.Equal(t, uint64(7), res.Stats.Views)
+		assert.Len(t, res.Comments.Comments, 1)
+	})
+
+	t.Run("Same JSON as the transcoded routes", func(t *testing.T) {
+		setupPostFull(t, &fakePostClient{}, &fakeStatsClient{})
+
+		rec, _ := getPostFull(t)
+
+		var body struct{ Post, Stats map[string]any }
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		assert.Equal(t, float64(7), body.Stats["views"])
+		assert.Equal(t, false, body.Post["liked_by_me"])
+		assert.Equal(t, false, body.Post["is_private"])
+	})
+
+	t.Run("Comments fail", func(t *testing.T) {
+		setupPostFull(t, &fakePostClient{commentsErr: status.Error(codes.Unavailable, "down")}, &fakeStatsClient{})
+
+		rec, res := getPostFull(t)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.True(t, res.Partial)
+		assert.Equal(t, []string{"comments"}, res.Missing)
+		assert.Nil(t, res.Comments)
+		assert.NotNil(t, res.Stats)
+	})
+
+	t.Run("Stats exceed the deadline", func(t *testing.T) {
+		setupPostFull(t, &fakePostClient{}, &fakeStatsClient{delay: time.Minute})
+		oldTimeout := postFullTimeout
+		postFullTimeout = 100 * time.Millisecond
+		t.Cleanup(func() { postFullTimeout = oldTimeout })
+
+		start := time.Now()
+		rec, res := getPostFull(t)
+
+		assert.Less(t, time.Since(start), postFullTimeout+time.Second)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, []string{"stats"}, res.Missing)
+		assert.NotNil(t, res.Post)
+	})
+
+	t.Run("Post not found", func(t *testing.T) {
+		setupPostFull(t, &fakePostClient{postErr: status.Error(codes.NotFound, "missing")}, &fakeStatsClient{})
+
+		rec, _ := getPostFull(t)
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
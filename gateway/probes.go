@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nanoservices/pkg/health"
+	"github.com/segmentio/kafka-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+func newHealthChecker(userServiceURL string, broker *eventBroker) *health.Checker {
+	checker := health.NewChecker(2 * time.Second)
+	checker.Add("users_service", httpCheck(userServiceURL+"/readyz"))
+	checker.Add("events_service", grpcCheck(postConn))
+	checker.Add("stats_service", grpcCheck(statsConn))
+	checker.AddOptional("notifications_service", grpcCheck(notificationsConn))
+	checker.Add(broker.name, broker.check)
+	return checker
+}
+
+func httpCheck(url string) health.Check {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+func grpcCheck(conn *grpc.ClientConn) health.Check {
+	return func(ctx context.Context) error {
+		for {
+			state := conn.GetState()
+			switch state {
+			case connectivity.Ready:
+				return nil
+			case connectivity.Idle:
+				conn.Connect()
+			case connectivity.Shutdown:
+				return errors.New("connection is shut down")
+			}
+			if !conn.WaitForStateChange(ctx, state) {
+				return fmt.Errorf("connection is %s", state)
+			}
+		}
+	}
+}
+
+func kafkaCheck(brokers []string) health.Check {
+	return func(ctx context.Context) error {
+		var lastErr error
+		for _, broker := range brokers {
+			conn, err := kafka.DialContext(ctx, "tcp", broker)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			_, err = conn.Brokers()
+			conn.Close()
+			if err == nil {
+				return nil
+			}
+			lastErr = err
+		}
+		return lastErr
+	}
+}
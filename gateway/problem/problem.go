@@ -0,0 +1,179 @@
+// Package problem writes gateway errors as RFC 9457 (formerly RFC 7807)
+// application/problem+json documents.
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nanoservices/pkg/logging"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const ContentType = "application/problem+json"
+
+// typePrefix is resolved against the API origin, the types are listed in the
+// gateway README.
+const typePrefix = "/problems/"
+
+// StatusClientClosedRequest is used when the client went away before the
+// upstream call finished.
+const StatusClientClosedRequest = 499
+
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError is a single invalid field of the request.
+type FieldError struct {
+	Field  string `json:"field"`
+	Detail string `json:"detail"`
+}
+
+type kind struct {
+	status int
+	slug   string
+	title  string
+	// internal hides the upstream message, it may contain SQL or stack traces.
+	internal bool
+}
+
+var grpcKinds = map[codes.Code]kind{
+	codes.Canceled:           {StatusClientClosedRequest, "canceled", "Request canceled", false},
+	codes.Unknown:            {http.StatusInternalServerError, "internal", "Internal error", true},
+	codes.InvalidArgument:    {http.StatusBadRequest, "invalid-argument", "Invalid argument", false},
+	codes.DeadlineExceeded:   {http.StatusGatewayTimeout, "deadline-exceeded", "Upstream timeout", true},
+	codes.NotFound:           {http.StatusNotFound, "not-found", "Not found", false},
+	codes.AlreadyExists:      {http.StatusConflict, "already-exists", "Already exists", false},
+	codes.PermissionDenied:   {http.StatusForbidden, "permission-denied", "Permission denied", false},
+	codes.ResourceExhausted:  {http.StatusTooManyRequests, "resource-exhausted", "Resource exhausted", false},
+	codes.FailedPrecondition: {http.StatusBadRequest, "failed-precondition", "Failed precondition", false},
+	codes.Aborted:            {http.StatusConflict, "aborted", "Aborted", false},
+	codes.OutOfRange:         {http.StatusBadRequest, "out-of-range", "Out of range", false},
+	codes.Unimplemented:      {http.StatusNotImplemented, "unimplemented", "Not implemented", true},
+	codes.Internal:           {http.StatusInternalServerError, "internal", "Internal error", true},
+	codes.Unavailable:        {http.StatusServiceUnavailable, "unavailable", "Service unavailable", true},
+	codes.DataLoss:           {http.StatusInternalServerError, "internal", "Internal error", true},
+	codes.Unauthenticated:    {http.StatusUnauthorized, "unauthenticated", "Unauthenticated", false},
+}
+
+var internalKind = grpcKinds[codes.Internal]
+
+// New returns a problem for an error detected by the gateway itself. Its
+// type is derived from the status code, e.g. /problems/bad-request.
+func New(status int, detail string) *Problem {
+	title := http.StatusText(status)
+	return &Problem{
+		Type:   typePrefix + strings.ReplaceAll(strings.ToLower(title), " ", "-"),
+		Title:  title,
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// FromGRPC maps an error returned by an upstream gRPC call. Messages of
+// server-side failures are logged and replaced with a generic detail, and
+// google.rpc.BadRequest field violations become field errors.
+func FromGRPC(ctx context.Context, err error) *Problem {
+	st, ok := status.FromError(err)
+	if !ok {
+		if errors.Is(err, context.Canceled) {
+			st = status.New(codes.Canceled, err.Error())
+		} else {
+			st = status.New(codes.Unknown, err.Error())
+		}
+	}
+
+	k, ok := grpcKinds[st.Code()]
+	if !ok {
+		k = internalKind
+	}
+	p := &Problem{Type: typePrefix + k.slug, Title: k.title, Status: k.status}
+
+	if k.internal {
+		logging.For("grpc").ErrorContext(ctx, "Upstream call failed", "code", st.Code().String(), "error", st.Message())
+		p.Detail = "the request could not be completed, try again later"
+		return p
+	}
+
+	p.Detail = st.Message()
+	for _, d := range st.Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok {
+			for _, v := range br.GetFieldViolations() {
+				p.Errors = append(p.Errors, FieldError{Field: v.GetField(), Detail: v.GetDescription()})
+			}
+		}
+	}
+	return p
+}
+
+// Code returns the last segment of the problem type in upper snake case,
+// e.g. NOT_FOUND, for clients that do not speak problem+json.
+func (p *Problem) Code() string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimPrefix(p.Type, typePrefix), "-", "_"))
+}
+
+// Write sends p with the request path as instance and the request ID.
+func Write(c echo.Context, p *Problem) error {
+	fill(c.Request(), p)
+	return c.Blob(p.Status, ContentType, marshal(p))
+}
+
+// WriteHTTP is Write for plain net/http handlers.
+func WriteHTTP(w http.ResponseWriter, r *http.Request, p *Problem) {
+	fill(r, p)
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(p.Status)
+	w.Write(marshal(p))
+}
+
+// HTTPErrorHandler replaces echo's default error handler so that unknown
+// routes, disallowed methods and panics are reported the same way.
+func HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	code, detail := http.StatusInternalServerError, ""
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		code = he.Code
+		if msg, ok := he.Message.(string); ok && msg != http.StatusText(code) {
+			detail = msg
+		}
+	} else {
+		logging.For("http").ErrorContext(c.Request().Context(), "Request failed", "error", err)
+	}
+
+	if c.Request().Method == http.MethodHead {
+		c.NoContent(code)
+		return
+	}
+	Write(c, New(code, detail))
+}
+
+func fill(r *http.Request, p *Problem) {
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+	if p.RequestID == "" {
+		p.RequestID = logging.RequestID(r.Context())
+	}
+}
+
+func marshal(p *Problem) []byte {
+	body, _ := json.Marshal(p)
+	return body
+}
@@ -0,0 +1,114 @@
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nanoservices/pkg/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestFromGRPC(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		typ    string
+		detail string
+	}{
+		{status.Error(codes.NotFound, "Post not found"), http.StatusNotFound, "/problems/not-found", "Post not found"},
+		{status.Error(codes.AlreadyExists, "already liked"), http.StatusConflict, "/problems/already-exists", "already liked"},
+		{status.Error(codes.Unauthenticated, "token expired"), http.StatusUnauthorized, "/problems/unauthenticated", "token expired"},
+		{status.Error(codes.ResourceExhausted, "slow down"), http.StatusTooManyRequests, "/problems/resource-exhausted", "slow down"},
+		{status.Error(codes.FailedPrecondition, "post is archived"), http.StatusBadRequest, "/problems/failed-precondition", "post is archived"},
+		{status.Error(codes.Canceled, "context canceled"), StatusClientClosedRequest, "/problems/canceled", "context canceled"},
+		{context.Canceled, StatusClientClosedRequest, "/problems/canceled", "context canceled"},
+	}
+
+	for _, tt := range tests {
+		p := FromGRPC(context.Background(), tt.err)
+		assert.Equal(t, tt.status, p.Status, tt.err.Error())
+		assert.Equal(t, tt.typ, p.Type, tt.err.Error())
+		assert.Equal(t, tt.detail, p.Detail, tt.err.Error())
+	}
+}
+
+func TestFromGRPCHidesServerErrors(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		typ    string
+	}{
+		{status.Error(codes.Internal, `relation "posts" does not exist`), http.StatusInternalServerError, "/problems/internal"},
+		{status.Error(codes.Unavailable, "connection refused"), http.StatusServiceUnavailable, "/problems/unavailable"},
+		{status.Error(codes.DeadlineExceeded, "context deadline exceeded"), http.StatusGatewayTimeout, "/problems/deadline-exceeded"},
+		{errors.New("dial tcp 10.0.0.7:50051"), http.StatusInternalServerError, "/problems/internal"},
+	}
+
+	for _, tt := range tests {
+		p := FromGRPC(context.Background(), tt.err)
+		assert.Equal(t, tt.status, p.Status, tt.err.Error())
+		assert.Equal(t, tt.typ, p.Type, tt.err.Error())
+		assert.NotContains(t, p.Detail, tt.err.Error())
+	}
+}
+
+func TestFromGRPCFieldViolations(t *testing.T) {
+	st, err := status.New(codes.InvalidArgument, "author_id must be a UUID").WithDetails(&errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{
+			{Field: "author_id", Description: "author_id must be a UUID"},
+		},
+	})
+	require.NoError(t, err)
+
+	p := FromGRPC(context.Background(), st.Err())
+
+	assert.Equal(t, http.StatusBadRequest, p.Status)
+	assert.Equal(t, []FieldError{{Field: "author_id", Detail: "author_id must be a UUID"}}, p.Errors)
+}
+
+func TestWrite(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/posts/p1?x=1", nil)
+	req = req.WithContext(logging.WithRequestID(req.Context(), "req-1"))
+	rec := httptest.NewRecorder()
+
+	require.NoError(t, Write(echo.New().NewContext(req, rec), New(http.StatusConflict, "still running")))
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Equal(t, ContentType, rec.Header().Get(echo.HeaderContentType))
+	assert.JSONEq(t, `{
+		"type": "/problems/conflict",
+		"title": "Conflict",
+		"status": 409,
+		"detail": "still running",
+		"instance": "/api/posts/p1",
+		"request_id": "req-1"
+	}`, rec.Body.String())
+}
+
+func TestHTTPErrorHandler(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = HTTPErrorHandler
+	e.GET("/boom", func(c echo.Context) error { return errors.New("secret") })
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, ContentType, rec.Header().Get(echo.HeaderContentType))
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/boom", nil))
+	var p Problem
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+	assert.Equal(t, http.StatusInternalServerError, p.Status)
+	assert.Equal(t, "/problems/internal-server-error", p.Type)
+	assert.Empty(t, p.Detail)
+}
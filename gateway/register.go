@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nanoservices/gateway/events"
+	"github.com/nanoservices/gateway/problem"
+	"github.com/nanoservices/pkg/logging"
+	"github.com/nanoservices/pkg/pubsub"
+	"github.com/nanoservices/pkg/tracing"
+	"go.opentelemetry.io/otel/codes"
+)
+
+const registrationsTopic = "user_registrations"
+
+// registerHandler proxies a registration to the users service and publishes
+// user.registered once the user is created. A failed publish is logged, the
+// user is registered either way.
+func registerHandler(userServiceURL string, producer *events.Producer, publisher pubsub.EventPublisher) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		reqBody, _ := io.ReadAll(c.Request().Body)
+		c.Request().Body = io.NopCloser(bytes.NewReader(reqBody))
+		var registration struct {
+			Username string `json:"username"`
+		}
+		decodeErr := json.Unmarshal(reqBody, &registration)
+
+		body, statusCode, err := proxyRequest(c, userServiceURL+"/api/register")
+		if err != nil {
+			return usersUnavailable(c, err)
+		}
+		if statusCode != http.StatusCreated {
+			return c.JSONBlob(statusCode, body)
+		}
+
+		ctx := c.Request().Context()
+		var resp map[string]interface{}
+		if err := json.Unmarshal(body, &resp); err != nil {
+			logging.For("proxy").ErrorContext(ctx, "Failed to parse response", "error", err)
+			return problem.Write(c, problem.New(http.StatusBadGateway, "invalid response from the users service"))
+		}
+
+		userID, ok := resp["id"].(string)
+		if !ok {
+			logging.For("proxy").ErrorContext(ctx, "Missing 'id' in response", "response", resp)
+			return problem.Write(c, problem.New(http.StatusBadGateway, "invalid response from the users service"))
+		}
+
+		if decodeErr != nil || registration.Username == "" {
+			logging.For("kafka").ErrorContext(ctx, "Registration without a username, user.registered is not published",
+				"user_id", userID, "error", decodeErr)
+			return c.JSONBlob(statusCode, body)
+		}
+
+		value, err := producer.Encode(events.UserRegistered, map[string]string{
+			"user_id":  userID,
+			"username": registration.Username,
+		})
+		if err != nil {
+			logging.For("kafka").ErrorContext(ctx, "Failed to encode registration event", "error", err)
+			return c.JSONBlob(statusCode, body)
+		}
+		msg := pubsub.Message{
+			Topic:   registrationsTopic,
+			Key:     []byte(userID),
+			Value:   value,
+			Headers: []pubsub.Header{{Key: logging.RequestIDHeader, Value: []byte(logging.RequestID(ctx))}},
+		}
+		ctx, span := tracing.StartProducerSpan(ctx, &msg)
+		err = publisher.Publish(context.WithoutCancel(ctx), msg)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "publish failed")
+			logging.For("kafka").ErrorContext(ctx, "Failed to publish or spool event",
+				"topic", msg.Topic, "error", err)
+		}
+		span.End()
+
+		return c.JSONBlob(statusCode, body)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nanoservices/gateway/events"
+	"github.com/nanoservices/pkg/logging"
+	"github.com/nanoservices/pkg/pubsub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const registration = `{"username": "alice", "password": "secret"}`
+
+func serveRegister(t *testing.T, request string, status int, response string) (*pubsub.Memory, *httptest.ResponseRecorder) {
+	t.Helper()
+	users := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/register", r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(users.Close)
+
+	registry, err := events.LoadRegistry()
+	require.NoError(t, err)
+	broker := pubsub.NewMemory()
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/api/register", strings.NewReader(request))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req = req.WithContext(logging.WithRequestID(req.Context(), "r1"))
+	rec := httptest.NewRecorder()
+
+	handler := registerHandler(users.URL, events.NewProducer("gateway", registry), broker)
+	require.NoError(t, handler(e.NewContext(req, rec)))
+	return broker, rec
+}
+
+func TestRegisterPublishesEvent(t *testing.T) {
+	broker, rec := serveRegister(t, registration, http.StatusCreated, `{"id": "u1"}`)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.JSONEq(t, `{"id": "u1"}`, rec.Body.String())
+
+	msgs := broker.Published(registrationsTopic)
+	require.Len(t, msgs, 1)
+	assert.Equal(t, "u1", string(msgs[0].Key))
+	assert.Equal(t, "r1", msgs[0].Header(logging.RequestIDHeader))
+
+	e, err := events.Decode(msgs[0].Value)
+	require.NoError(t, err)
+	assert.Equal(t, events.UserRegistered, e.Type)
+	assert.JSONEq(t, `{"user_id": "u1", "username": "alice"}`, string(e.Payload))
+}
+
+func TestRegisterFailureNotPublished(t *testing.T) {
+	broker, rec := serveRegister(t, registration, http.StatusConflict, `{"error": "username is taken"}`)
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Empty(t, broker.Published(registrationsTopic))
+}
+
+func TestRegisterUndecodableBodyNotPublished(t *testing.T) {
+	broker, rec := serveRegister(t, `{"username": 42}`, http.StatusCreated, `{"id": "u1"}`)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.JSONEq(t, `{"id": "u1"}`, rec.Body.String())
+	assert.Empty(t, broker.Published(registrationsTopic))
+}
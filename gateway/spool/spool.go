@@ -0,0 +1,477 @@
+// Package spool keeps events that could not be published in a write-ahead
+// log on disk and sends them once the broker is back.
+package spool
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/nanoservices/pkg/logging"
+	"github.com/nanoservices/pkg/pubsub"
+)
+
+const (
+	logFile    = "spool.log"
+	offsetFile = "spool.offset"
+
+	// recordHeader is the length and the CRC-32 of the record body.
+	recordHeader = 8
+	batchSize    = 100
+	// compactAfter is how many bytes of sent records may accumulate at the
+	// head of the log before it is rewritten.
+	compactAfter = 1 << 20
+	// deadLetterConsumer is the dlq.consumer header of the records the
+	// spool gives up on.
+	deadLetterConsumer = "gateway-spool"
+)
+
+// ErrFull is returned by Publish when the message neither reached the
+// broker nor fits into the spool.
+var ErrFull = errors.New("spool is full")
+
+type Config struct {
+	Dir string
+	// MaxBytes limits the size of the messages waiting in the spool.
+	MaxBytes   int64
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// MaxAttempts is how many times the oldest record may fail on its own
+	// before it is moved to the dead-letter topic of its topic.
+	MaxAttempts int
+}
+
+type Stats struct {
+	Messages     int
+	Bytes        int64
+	Spooled      uint64
+	Drained      uint64
+	Dropped      uint64
+	DeadLettered uint64
+}
+
+type record struct {
+	Topic   string          `json:"topic,omitempty"`
+	Key     []byte          `json:"key,omitempty"`
+	Value   []byte          `json:"value"`
+	Headers []pubsub.Header `json:"headers,omitempty"`
+}
+
+type entry struct {
+	msg  pubsub.Message
+	size int64
+}
+
+// file is the part of *os.File the log is accessed through.
+type file interface {
+	io.ReaderAt
+	io.WriteSeeker
+	Truncate(size int64) error
+	Sync() error
+	Stat() (os.FileInfo, error)
+	Close() error
+}
+
+// Spool publishes messages directly while the broker accepts them. A message
+// that fails, or whose key still has messages waiting, is appended to the
+// log, so messages with the same key are delivered in order. Delivery is at
+// least once: a crash between the broker's ack and the offset update sends
+// the last batch again.
+type Spool struct {
+	cfg Config
+	pub pubsub.EventPublisher
+
+	mu      sync.Mutex
+	log     file
+	offset  *os.File
+	head    int64
+	queue   []entry
+	bytes   int64
+	pending map[string]int
+	stats   Stats
+
+	drainMu sync.Mutex
+	// attempts counts the failed sends of the oldest record, guarded by
+	// drainMu.
+	attempts int
+	notify   chan struct{}
+}
+
+// Open loads the messages left in cfg.Dir by a previous run.
+func Open(cfg Config, pub pubsub.EventPublisher) (*Spool, error) {
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = 64 << 20
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = 500 * time.Millisecond
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 30 * time.Second
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 10
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	s := &Spool{cfg: cfg, pub: pub, pending: make(map[string]int), notify: make(chan struct{}, 1)}
+	var err error
+	if s.offset, err = os.OpenFile(filepath.Join(cfg.Dir, offsetFile), os.O_RDWR|os.O_CREATE, 0o644); err != nil {
+		return nil, err
+	}
+	if s.log, err = os.OpenFile(filepath.Join(cfg.Dir, logFile), os.O_RDWR|os.O_CREATE, 0o644); err != nil {
+		s.offset.Close()
+		return nil, err
+	}
+	if err := s.load(); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("load spool: %w", err)
+	}
+	return s, nil
+}
+
+// load reads the records after the saved offset. A record cut short by a
+// crash is dropped together with everything after it.
+func (s *Spool) load() error {
+	var buf [8]byte
+	if n, err := s.offset.ReadAt(buf[:], 0); err == nil && n == 8 {
+		s.head = int64(binary.BigEndian.Uint64(buf[:]))
+	}
+	info, err := s.log.Stat()
+	if err != nil {
+		return err
+	}
+	if s.head > info.Size() {
+		s.head = 0
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(s.log, s.head, info.Size()-s.head))
+	end := s.head
+	for {
+		msg, size, err := readRecord(r)
+		if err != nil {
+			if err != io.EOF {
+				logging.For("spool").Warn("Dropping truncated spool record", "offset", end, "error", err)
+			}
+			break
+		}
+		s.push(entry{msg: msg, size: size})
+		end += size
+	}
+	if err := s.log.Truncate(end); err != nil {
+		return err
+	}
+	_, err = s.log.Seek(end, io.SeekStart)
+	return err
+}
+
+// Publish sends msgs or, if that is not possible right now, spools them. It
+// only returns an error when a message is lost.
+func (s *Spool) Publish(ctx context.Context, msgs ...pubsub.Message) error {
+	var errs []error
+	for _, msg := range msgs {
+		if err := s.publish(ctx, msg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// publish holds the lock across the direct send, otherwise the message
+// could overtake a message with the same key that is being spooled.
+func (s *Spool) publish(ctx context.Context, msg pubsub.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pending[string(msg.Key)] == 0 {
+		err := s.pub.Publish(ctx, msg)
+		if err == nil {
+			return nil
+		}
+		logging.For("spool").WarnContext(ctx, "Publish failed, spooling the message", "topic", msg.Topic, "error", err)
+	}
+	return s.append(msg)
+}
+
+// append writes msg to the log, s.mu must be held.
+func (s *Spool) append(msg pubsub.Message) error {
+	data, err := encodeRecord(msg)
+	if err != nil {
+		return err
+	}
+	size := int64(len(data))
+
+	if s.bytes+size > s.cfg.MaxBytes {
+		s.stats.Dropped++
+		return ErrFull
+	}
+	end, err := s.log.Seek(0, io.SeekCurrent)
+	if err != nil {
+		s.stats.Dropped++
+		return err
+	}
+	if _, err = s.log.Write(data); err == nil {
+		err = s.log.Sync()
+	}
+	if err != nil {
+		s.stats.Dropped++
+		return errors.Join(err, s.rollback(end))
+	}
+	s.push(entry{msg: msg, size: size})
+	s.stats.Spooled++
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// rollback cuts a partly written record off the log, otherwise the offsets
+// of the queued records would no longer match the file and the next load
+// would drop everything after it.
+func (s *Spool) rollback(end int64) error {
+	if err := s.log.Truncate(end); err != nil {
+		return fmt.Errorf("roll back spool log: %w", err)
+	}
+	if _, err := s.log.Seek(end, io.SeekStart); err != nil {
+		return fmt.Errorf("roll back spool log: %w", err)
+	}
+	return nil
+}
+
+func (s *Spool) push(e entry) {
+	s.queue = append(s.queue, e)
+	s.bytes += e.size
+	s.pending[string(e.msg.Key)]++
+}
+
+// Run drains the spool until ctx is canceled, backing off while the broker
+// keeps failing.
+func (s *Spool) Run(ctx context.Context) {
+	logger := logging.For("spool")
+	backoff := s.cfg.MinBackoff
+	for {
+		n, err := s.drainBatch(ctx)
+		var wait <-chan time.Time
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			logger.WarnContext(ctx, "Failed to drain spool", "error", err, "retry_in", backoff.String())
+			wait = time.After(backoff)
+			backoff = min(backoff*2, s.cfg.MaxBackoff)
+		case n > 0:
+			backoff = s.cfg.MinBackoff
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-wait:
+		case <-s.notify:
+		}
+	}
+}
+
+// Flush tries to send everything that is spooled, it is called on
+// shutdown. What is left stays on disk for the next start.
+func (s *Spool) Flush(ctx context.Context) error {
+	for {
+		n, err := s.drainBatch(ctx)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+	}
+}
+
+// drainBatch sends the oldest spooled messages and returns how many were
+// sent. When a batch fails the oldest record is retried alone, so a record
+// the broker keeps rejecting is moved to the dead-letter topic after
+// MaxAttempts instead of blocking the records behind it.
+func (s *Spool) drainBatch(ctx context.Context) (int, error) {
+	s.drainMu.Lock()
+	defer s.drainMu.Unlock()
+
+	s.mu.Lock()
+	batch := make([]pubsub.Message, 0, min(len(s.queue), batchSize))
+	for _, e := range s.queue[:cap(batch)] {
+		batch = append(batch, e.msg)
+	}
+	s.mu.Unlock()
+	if len(batch) == 0 {
+		return 0, nil
+	}
+
+	err := s.pub.Publish(ctx, batch...)
+	if err != nil && len(batch) > 1 {
+		batch = batch[:1]
+		err = s.pub.Publish(ctx, batch...)
+	}
+	deadLettered := false
+	if err != nil {
+		if ctx.Err() != nil {
+			return 0, err
+		}
+		s.attempts++
+		if s.attempts < s.cfg.MaxAttempts {
+			return 0, err
+		}
+		dead := pubsub.NewDeadLetter(batch[0], pubsub.Failure{
+			Err: err.Error(), Attempts: s.attempts, Consumer: deadLetterConsumer, At: time.Now(),
+		})
+		if dlqErr := s.pub.Publish(ctx, dead); dlqErr != nil {
+			return 0, errors.Join(err, dlqErr)
+		}
+		logging.For("spool").ErrorContext(ctx, "Moved a spooled message to the dead-letter topic",
+			"topic", batch[0].Topic, "attempts", s.attempts, "error", err)
+		deadLettered = true
+	}
+	s.attempts = 0
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.queue[:len(batch)] {
+		s.head += e.size
+		s.bytes -= e.size
+		if key := string(e.msg.Key); s.pending[key] > 1 {
+			s.pending[key]--
+		} else {
+			delete(s.pending, key)
+		}
+	}
+	s.queue = s.queue[len(batch):]
+	if deadLettered {
+		s.stats.DeadLettered++
+	} else {
+		s.stats.Drained += uint64(len(batch))
+	}
+
+	if err := s.commit(); err != nil {
+		return len(batch), err
+	}
+	return len(batch), nil
+}
+
+// commit saves the offset of the first unsent record. An empty log is
+// truncated, a log with a long sent prefix is rewritten without it.
+func (s *Spool) commit() error {
+	switch {
+	case len(s.queue) == 0:
+		if err := s.log.Truncate(0); err != nil {
+			return err
+		}
+		if _, err := s.log.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		s.head = 0
+	case s.head > compactAfter && s.head > s.bytes:
+		if err := s.compact(); err != nil {
+			return err
+		}
+	}
+
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(s.head))
+	if _, err := s.offset.WriteAt(buf[:], 0); err != nil {
+		return err
+	}
+	return s.offset.Sync()
+}
+
+func (s *Spool) compact() error {
+	path := filepath.Join(s.cfg.Dir, logFile)
+	tmp, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, io.NewSectionReader(s.log, s.head, s.bytes)); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	// The offset is reset before the rename: after a crash in between the
+	// old log is read from the start and the sent prefix is delivered again.
+	var buf [8]byte
+	if _, err := s.offset.WriteAt(buf[:], 0); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		tmp.Close()
+		return err
+	}
+	s.log.Close()
+	s.log = tmp
+	s.head = 0
+	return nil
+}
+
+func (s *Spool) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.stats
+	st.Messages = len(s.queue)
+	st.Bytes = s.bytes
+	return st
+}
+
+// Close closes the spool files, the wrapped publisher is left open.
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return errors.Join(s.log.Close(), s.offset.Close())
+}
+
+func encodeRecord(msg pubsub.Message) ([]byte, error) {
+	body, err := json.Marshal(record{Topic: msg.Topic, Key: msg.Key, Value: msg.Value, Headers: msg.Headers})
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, recordHeader+len(body))
+	binary.BigEndian.PutUint32(data[0:4], uint32(len(body)))
+	binary.BigEndian.PutUint32(data[4:8], crc32.ChecksumIEEE(body))
+	copy(data[recordHeader:], body)
+	return data, nil
+}
+
+func readRecord(r io.Reader) (pubsub.Message, int64, error) {
+	var header [recordHeader]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return pubsub.Message{}, 0, errors.New("truncated header")
+		}
+		return pubsub.Message{}, 0, err
+	}
+	body := make([]byte, binary.BigEndian.Uint32(header[0:4]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return pubsub.Message{}, 0, errors.New("truncated body")
+	}
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(header[4:8]) {
+		return pubsub.Message{}, 0, errors.New("checksum mismatch")
+	}
+
+	var rec record
+	if err := json.Unmarshal(body, &rec); err != nil {
+		return pubsub.Message{}, 0, err
+	}
+	msg := pubsub.Message{Topic: rec.Topic, Key: rec.Key, Value: rec.Value, Headers: rec.Headers}
+	return msg, int64(recordHeader + len(body)), nil
+}
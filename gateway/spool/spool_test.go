@@ -0,0 +1,336 @@
+package spool
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/nanoservices/pkg/pubsub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeWriter fails while down is set, rejects batches containing the
+// value reject outside dead-letter topics and records what it sent.
+type fakeWriter struct {
+	mu     sync.Mutex
+	down   bool
+	reject string
+	sent   []string
+	topics []string
+}
+
+func (w *fakeWriter) Publish(_ context.Context, msgs ...pubsub.Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.down {
+		return errors.New("broker unavailable")
+	}
+	for _, m := range msgs {
+		if w.reject != "" && string(m.Value) == w.reject && !strings.HasSuffix(m.Topic, pubsub.DeadLetterSuffix) {
+			return errors.New("message too large")
+		}
+	}
+	for _, m := range msgs {
+		w.sent = append(w.sent, string(m.Value))
+		w.topics = append(w.topics, m.Topic)
+	}
+	return nil
+}
+
+func (w *fakeWriter) Close() error {
+	return nil
+}
+
+func (w *fakeWriter) setDown(down bool) {
+	w.mu.Lock()
+	w.down = down
+	w.mu.Unlock()
+}
+
+func (w *fakeWriter) messages() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string(nil), w.sent...)
+}
+
+func message(key, value string) pubsub.Message {
+	return pubsub.Message{Key: []byte(key), Value: []byte(value), Headers: []pubsub.Header{{Key: "X-Request-ID", Value: []byte("r1")}}}
+}
+
+func TestPublishDirectly(t *testing.T) {
+	w := &fakeWriter{}
+	s, err := Open(Config{Dir: t.TempDir()}, w)
+	require.NoError(t, err)
+	defer s.Close()
+
+	require.NoError(t, s.Publish(context.Background(), message("u1", "a")))
+
+	assert.Equal(t, []string{"a"}, w.messages())
+	assert.Equal(t, 0, s.Stats().Messages)
+}
+
+func TestSpoolPreservesOrderPerKey(t *testing.T) {
+	w := &fakeWriter{down: true}
+	s, err := Open(Config{Dir: t.TempDir()}, w)
+	require.NoError(t, err)
+	defer s.Close()
+	ctx := context.Background()
+
+	require.NoError(t, s.Publish(ctx, message("u1", "a")))
+	w.setDown(false)
+	// u1 still has a spooled message, u2 does not.
+	require.NoError(t, s.Publish(ctx, message("u1", "b")))
+	require.NoError(t, s.Publish(ctx, message("u2", "c")))
+
+	assert.Equal(t, []string{"c"}, w.messages())
+	st := s.Stats()
+	assert.Equal(t, 2, st.Messages)
+	assert.Equal(t, uint64(2), st.Spooled)
+
+	require.NoError(t, s.Flush(ctx))
+	assert.Equal(t, []string{"c", "a", "b"}, w.messages())
+	assert.Equal(t, 0, s.Stats().Messages)
+	assert.Equal(t, int64(0), s.Stats().Bytes)
+
+	info, err := os.Stat(filepath.Join(s.cfg.Dir, logFile))
+	require.NoError(t, err)
+	assert.Zero(t, info.Size())
+}
+
+func TestReopenKeepsUnsentMessages(t *testing.T) {
+	dir := t.TempDir()
+	w := &fakeWriter{down: true}
+	s, err := Open(Config{Dir: dir}, w)
+	require.NoError(t, err)
+	ctx := context.Background()
+	for _, v := range []string{"a", "b", "c"} {
+		require.NoError(t, s.Publish(ctx, message("u1", v)))
+	}
+	require.NoError(t, s.Close())
+
+	w.setDown(false)
+	s, err = Open(Config{Dir: dir}, w)
+	require.NoError(t, err)
+	defer s.Close()
+	assert.Equal(t, 3, s.Stats().Messages)
+
+	require.NoError(t, s.Flush(ctx))
+	assert.Equal(t, []string{"a", "b", "c"}, w.messages())
+}
+
+func TestReopenAfterPartialDrain(t *testing.T) {
+	dir := t.TempDir()
+	w := &fakeWriter{down: true}
+	s, err := Open(Config{Dir: dir}, w)
+	require.NoError(t, err)
+	ctx := context.Background()
+	for i := 0; i < batchSize+5; i++ {
+		require.NoError(t, s.Publish(ctx, message("u1", "m")))
+	}
+
+	w.setDown(false)
+	n, err := s.drainBatch(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, batchSize, n)
+	require.NoError(t, s.Close())
+
+	s, err = Open(Config{Dir: dir}, w)
+	require.NoError(t, err)
+	defer s.Close()
+	assert.Equal(t, 5, s.Stats().Messages)
+}
+
+func TestTruncatedRecordDropped(t *testing.T) {
+	dir := t.TempDir()
+	w := &fakeWriter{down: true}
+	s, err := Open(Config{Dir: dir}, w)
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, s.Publish(ctx, message("u1", "a")))
+	require.NoError(t, s.Publish(ctx, message("u1", "b")))
+	require.NoError(t, s.Close())
+
+	path := filepath.Join(dir, logFile)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(path, info.Size()-3))
+
+	s, err = Open(Config{Dir: dir}, w)
+	require.NoError(t, err)
+	defer s.Close()
+	assert.Equal(t, 1, s.Stats().Messages)
+
+	w.setDown(false)
+	require.NoError(t, s.Publish(ctx, message("u1", "c")))
+	require.NoError(t, s.Flush(ctx))
+	assert.Equal(t, []string{"a", "c"}, w.messages())
+}
+
+func TestSpoolFull(t *testing.T) {
+	w := &fakeWriter{down: true}
+	s, err := Open(Config{Dir: t.TempDir(), MaxBytes: 200}, w)
+	require.NoError(t, err)
+	defer s.Close()
+	ctx := context.Background()
+
+	require.NoError(t, s.Publish(ctx, message("u1", "a")))
+	err = s.Publish(ctx, message("u2", string(make([]byte, 200))))
+
+	assert.ErrorIs(t, err, ErrFull)
+	assert.Equal(t, 1, s.Stats().Messages)
+	assert.Equal(t, uint64(1), s.Stats().Dropped)
+}
+
+// fullDisk writes half of the next record and then fails like a full disk.
+type fullDisk struct {
+	*os.File
+	full bool
+}
+
+func (f *fullDisk) Write(b []byte) (int, error) {
+	if !f.full {
+		return f.File.Write(b)
+	}
+	f.full = false
+	n, _ := f.File.Write(b[:len(b)/2])
+	return n, syscall.ENOSPC
+}
+
+func TestFailedWriteRolledBack(t *testing.T) {
+	dir := t.TempDir()
+	w := &fakeWriter{down: true}
+	s, err := Open(Config{Dir: dir}, w)
+	require.NoError(t, err)
+	ctx := context.Background()
+	disk := &fullDisk{File: s.log.(*os.File)}
+	s.log = disk
+
+	require.NoError(t, s.Publish(ctx, message("u1", "a")))
+	disk.full = true
+	assert.ErrorIs(t, s.Publish(ctx, message("u1", "b")), syscall.ENOSPC)
+	require.NoError(t, s.Publish(ctx, message("u1", "c")))
+	assert.Equal(t, 2, s.Stats().Messages)
+	assert.Equal(t, uint64(1), s.Stats().Dropped)
+
+	info, err := os.Stat(filepath.Join(dir, logFile))
+	require.NoError(t, err)
+	assert.Equal(t, s.Stats().Bytes, info.Size())
+	require.NoError(t, s.Close())
+
+	// Remains of the failed record would make load drop "c".
+	w.setDown(false)
+	s, err = Open(Config{Dir: dir}, w)
+	require.NoError(t, err)
+	defer s.Close()
+	require.NoError(t, s.Flush(ctx))
+	assert.Equal(t, []string{"a", "c"}, w.messages())
+}
+
+func TestRunDrainsWithBackoff(t *testing.T) {
+	w := &fakeWriter{down: true}
+	s, err := Open(Config{Dir: t.TempDir(), MinBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}, w)
+	require.NoError(t, err)
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+
+	require.NoError(t, s.Publish(ctx, message("u1", "a")))
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, w.messages())
+
+	w.setDown(false)
+	assert.Eventually(t, func() bool { return s.Stats().Messages == 0 }, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"a"}, w.messages())
+
+	cancel()
+	<-done
+}
+
+func TestCompaction(t *testing.T) {
+	dir := t.TempDir()
+	w := &fakeWriter{down: true}
+	s, err := Open(Config{Dir: dir}, w)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	value := string(make([]byte, 12<<10))
+	for i := 0; i < batchSize+50; i++ {
+		require.NoError(t, s.Publish(ctx, message("u1", value)))
+	}
+	w.setDown(false)
+	_, err = s.drainBatch(ctx)
+	require.NoError(t, err)
+
+	st := s.Stats()
+	assert.Equal(t, 50, st.Messages)
+	info, err := os.Stat(filepath.Join(dir, logFile))
+	require.NoError(t, err)
+	assert.Equal(t, st.Bytes, info.Size())
+
+	require.NoError(t, s.Close())
+	s, err = Open(Config{Dir: dir}, w)
+	require.NoError(t, err)
+	defer s.Close()
+	assert.Equal(t, 50, s.Stats().Messages)
+}
+
+func TestRejectedRecordMovedToDeadLetters(t *testing.T) {
+	w := &fakeWriter{down: true, reject: "bad"}
+	s, err := Open(Config{Dir: t.TempDir(), MaxAttempts: 3}, w)
+	require.NoError(t, err)
+	defer s.Close()
+	ctx := context.Background()
+
+	bad := message("u1", "bad")
+	bad.Topic = "user_registrations"
+	require.NoError(t, s.Publish(ctx, bad, message("u1", "a"), message("u2", "b")))
+	w.setDown(false)
+
+	for i := 0; i < 2; i++ {
+		n, err := s.drainBatch(ctx)
+		assert.Zero(t, n)
+		assert.ErrorContains(t, err, "message too large")
+	}
+	assert.Empty(t, w.messages())
+
+	require.NoError(t, s.Flush(ctx))
+	assert.Equal(t, []string{"bad", "a", "b"}, w.messages())
+	assert.Equal(t, "user_registrations.dlq", w.topics[0])
+	st := s.Stats()
+	assert.Equal(t, 0, st.Messages)
+	assert.Equal(t, uint64(1), st.DeadLettered)
+	assert.Equal(t, uint64(2), st.Drained)
+}
+
+func TestBrokerDownDoesNotDeadLetter(t *testing.T) {
+	w := &fakeWriter{down: true}
+	s, err := Open(Config{Dir: t.TempDir(), MaxAttempts: 1}, w)
+	require.NoError(t, err)
+	defer s.Close()
+	ctx := context.Background()
+
+	require.NoError(t, s.Publish(ctx, message("u1", "a")))
+	for i := 0; i < 3; i++ {
+		_, err := s.drainBatch(ctx)
+		assert.Error(t, err)
+	}
+	assert.Equal(t, 1, s.Stats().Messages)
+
+	w.setDown(false)
+	require.NoError(t, s.Flush(ctx))
+	assert.Equal(t, []string{"a"}, w.messages())
+	assert.Zero(t, s.Stats().DeadLettered)
+}
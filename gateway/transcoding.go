@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/utilities"
+	"github.com/labstack/echo/v4"
+	pb "github.com/nanoservices/gateway/generated"
+	"github.com/nanoservices/gateway/problem"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+type (
+	callerKey     struct{}
+	requestURLKey struct{}
+)
+
+var createdMethods = map[string]bool{
+	pb.PostService_CreatePost_FullMethodName:               true,
+	pb.PostService_CommentPost_FullMethodName:              true,
+	pb.PostService_CreateBookmarkCollection_FullMethodName: true,
+	pb.PostService_CreateReport_FullMethodName:             true,
+	pb.PostService_CreateModerationDecision_FullMethodName: true,
+}
+
+// protoJSON is how messages are rendered in REST responses: proto field
+// names and zero values included. See marshalJSON for 64-bit integers.
+var protoJSON = protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}
+
+// newTranscoder maps the REST routes declared with google.api.http in
+// posts.proto, statistics.proto and notifications.proto onto the Post,
+// Statistics and Notification services.
+func newTranscoder(posts, stats, notifications grpc.ClientConnInterface) (*runtime.ServeMux, error) {
+	mux := runtime.NewServeMux(
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, restMarshaler{&runtime.JSONPb{
+			MarshalOptions:   protoJSON,
+			UnmarshalOptions: protojson.UnmarshalOptions{DiscardUnknown: true},
+		}}),
+		runtime.SetQueryParameterParser(queryParser{}),
+		runtime.WithErrorHandler(transcodingError),
+		runtime.WithForwardResponseOption(forwardResponse),
+		runtime.WithForwardResponseRewriter(rewriteResponse),
+	)
+
+	ctx := context.Background()
+	if err := pb.RegisterPostServiceHandlerClient(ctx, mux, pb.NewPostServiceClient(callerConn{posts})); err != nil {
+		return nil, err
+	}
+	if err := pb.RegisterStatsServiceHandlerClient(ctx, mux, pb.NewStatsServiceClient(callerConn{stats})); err != nil {
+		return nil, err
+	}
+	if err := pb.RegisterNotificationServiceHandlerClient(ctx, mux, pb.NewNotificationServiceClient(callerConn{notifications})); err != nil {
+		return nil, err
+	}
+	return mux, nil
+}
+
+// transcode hands the request over to the transcoder. Routing stays in echo so
+// that the auth, cache and idempotency middleware of each route still apply.
+func transcode(mux http.Handler) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, _ := c.Get("user_id").(string)
+		ctx := context.WithValue(c.Request().Context(), callerKey{}, userID)
+		ctx = context.WithValue(ctx, requestURLKey{}, c.Request().URL)
+		mux.ServeHTTP(c.Response(), c.Request().WithContext(ctx))
+		return nil
+	}
+}
+
+// callerConn overwrites user_id in every request with the authenticated
+// caller, so it can't be supplied through the path, query or body.
+type callerConn struct {
+	grpc.ClientConnInterface
+}
+
+func (c callerConn) Invoke(ctx context.Context, method string, args, reply any, opts ...grpc.CallOption) error {
+	if m, ok := args.(proto.Message); ok {
+		msg := m.ProtoReflect()
+		if fd := msg.Descriptor().Fields().ByName("user_id"); fd != nil {
+			userID, _ := ctx.Value(callerKey{}).(string)
+			msg.Set(fd, protoreflect.ValueOfString(userID))
+		}
+	}
+	return c.ClientConnInterface.Invoke(ctx, method, args, reply, opts...)
+}
+
+// queryParser keeps accepting the query strings of the hand-written handlers
+// the transcoder replaced, next to the canonical proto field names.
+type queryParser struct {
+	runtime.DefaultQueryParser
+}
+
+func (p queryParser) Parse(msg proto.Message, values url.Values, filter *utilities.DoubleArray) error {
+	values = cloneValues(values)
+
+	switch req := msg.(type) {
+	case *pb.ListPostsRequest:
+		if err := parsePostFilters(values, req); err != nil {
+			return err
+		}
+		for _, k := range postFilterParams {
+			values.Del(k)
+		}
+	case *pb.SearchPostsRequest:
+		tags, err := queryTags(values)
+		if err != nil {
+			return err
+		}
+		req.Tags = tags
+		if !values.Has("query") {
+			values.Set("query", values.Get("q"))
+		}
+		req.Query = strings.TrimSpace(values.Get("query"))
+		if req.Query == "" {
+			return errors.New("q is required")
+		}
+		for _, k := range []string{"q", "query", "tag", "tags"} {
+			values.Del(k)
+		}
+	case *pb.GetCommentsRequest:
+		if v := values.Get("layout"); v != "" {
+			layout, ok := pb.CommentLayout_value[strings.ToUpper(v)]
+			if !ok {
+				return errors.New("Invalid layout. Use: flat/tree/thread")
+			}
+			req.Layout = pb.CommentLayout(layout)
+			values.Del("layout")
+		}
+	case *pb.TopRequest:
+		v := values.Get("metric")
+		if v == "" {
+			return errors.New("metric parameter is required")
+		}
+		metric, ok := pb.Metric_value[strings.ToUpper(v)]
+		if !ok {
+			return errors.New("Invalid metric. Use: views/likes/comments")
+		}
+		req.Metric = pb.Metric(metric)
+		values.Del("metric")
+	}
+	return p.DefaultQueryParser.Parse(msg, values, filter)
+}
+
+func cloneValues(values url.Values) url.Values {
+	cloned := make(url.Values, len(values))
+	for k, v := range values {
+		cloned[k] = append([]string(nil), v...)
+	}
+	return cloned
+}
+
+// forwardResponse restores what the hand-written handlers did on top of the
+// body: 201 for created resources and a Link header for cursor pages.
+func forwardResponse(ctx context.Context, w http.ResponseWriter, resp proto.Message) error {
+	if page, ok := resp.(interface{ GetNextCursor() string }); ok && page.GetNextCursor() != "" {
+		if u, ok := ctx.Value(requestURLKey{}).(*url.URL); ok {
+			w.Header().Set("Link", nextPageLink(u, page.GetNextCursor()))
+		}
+	}
+	if method, ok := runtime.RPCMethod(ctx); ok && createdMethods[method] {
+		w.WriteHeader(http.StatusCreated)
+	}
+	return nil
+}
+
+// rewriteResponse keeps the body DELETE /api/posts/{post_id} returned before
+// the route was transcoded.
+func rewriteResponse(_ context.Context, resp proto.Message) (any, error) {
+	if _, ok := resp.(*pb.DeletePostResponse); ok {
+		return map[string]string{"message": "post deleted"}, nil
+	}
+	return resp, nil
+}
+
+// restMarshaler renders messages and the lists selected by response_body
+// with marshalJSON.
+type restMarshaler struct {
+	*runtime.JSONPb
+}
+
+var protoMessageType = reflect.TypeOf((*proto.Message)(nil)).Elem()
+
+func (m restMarshaler) Marshal(v any) ([]byte, error) {
+	if msg, ok := v.(proto.Message); ok {
+		return marshalJSON(msg)
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice || !rv.Type().Elem().Implements(protoMessageType) {
+		return m.JSONPb.Marshal(v)
+	}
+	items := make([][]byte, rv.Len())
+	for i := range items {
+		b, err := marshalJSON(rv.Index(i).Interface().(proto.Message))
+		if err != nil {
+			return nil, err
+		}
+		items[i] = b
+	}
+	return append(append([]byte("["), bytes.Join(items, []byte(","))...), ']'), nil
+}
+
+// marshalJSON renders m with protoJSON, except that 64-bit integers are
+// written as numbers instead of strings: the counters of the statistics
+// routes have always been numbers.
+func marshalJSON(m proto.Message) ([]byte, error) {
+	b, err := protoJSON.Marshal(m)
+	desc := m.ProtoReflect().Descriptor()
+	if err != nil || !hasInt64(desc, map[protoreflect.FullName]bool{}) {
+		return b, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	int64Numbers(v, desc)
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+func is64Bit(fd protoreflect.FieldDescriptor) bool {
+	switch fd.Kind() {
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return true
+	}
+	return false
+}
+
+// nested returns the message of fd unless it has a JSON form of its own,
+// like the well-known types.
+func nested(fd protoreflect.FieldDescriptor) protoreflect.MessageDescriptor {
+	if fd.IsMap() {
+		fd = fd.MapValue()
+	}
+	if md := fd.Message(); md != nil && md.FullName().Parent() != "google.protobuf" {
+		return md
+	}
+	return nil
+}
+
+func hasInt64(md protoreflect.MessageDescriptor, seen map[protoreflect.FullName]bool) bool {
+	if seen[md.FullName()] {
+		return false
+	}
+	seen[md.FullName()] = true
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if fd.IsMap() && is64Bit(fd.MapValue()) || !fd.IsMap() && is64Bit(fd) {
+			return true
+		}
+		if sub := nested(fd); sub != nil && hasInt64(sub, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// int64Numbers turns the 64-bit integers of v, the decoded JSON of a message
+// of type md, into numbers.
+func int64Numbers(v any, md protoreflect.MessageDescriptor) {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return
+	}
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		name := string(fd.Name())
+		if _, ok := obj[name]; !ok {
+			continue
+		}
+		switch val := obj[name].(type) {
+		case []any:
+			for j := range val {
+				val[j] = fieldNumber(val[j], fd)
+			}
+		case map[string]any:
+			if fd.IsMap() {
+				for k := range val {
+					val[k] = fieldNumber(val[k], fd.MapValue())
+				}
+			} else {
+				obj[name] = fieldNumber(val, fd)
+			}
+		default:
+			obj[name] = fieldNumber(val, fd)
+		}
+	}
+}
+
+func fieldNumber(v any, fd protoreflect.FieldDescriptor) any {
+	if s, ok := v.(string); ok && is64Bit(fd) {
+		return json.Number(s)
+	}
+	if md := nested(fd); md != nil {
+		int64Numbers(v, md)
+	}
+	return v
+}
+
+func transcodingError(ctx context.Context, _ *runtime.ServeMux, _ runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	var httpErr *runtime.HTTPStatusError
+	if errors.As(err, &httpErr) {
+		problem.WriteHTTP(w, r, problem.New(httpErr.HTTPStatus, ""))
+		return
+	}
+	problem.WriteHTTP(w, r, problem.FromGRPC(ctx, err))
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	pb "github.com/nanoservices/gateway/generated"
+	"github.com/nanoservices/gateway/problem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeConn records the last request and answers with a canned reply.
+type fakeConn struct {
+	method string
+	req    proto.Message
+	reply  proto.Message
+	err    error
+}
+
+func (f *fakeConn) Invoke(_ context.Context, method string, args, reply any, _ ...grpc.CallOption) error {
+	f.method, f.req = method, proto.Clone(args.(proto.Message))
+	if f.err != nil {
+		return f.err
+	}
+	if f.reply != nil {
+		proto.Merge(reply.(proto.Message), f.reply)
+	}
+	return nil
+}
+
+func (f *fakeConn) NewStream(context.Context, *grpc.StreamDesc, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+	return nil, status.Error(codes.Unimplemented, "streams are not used")
+}
+
+func serveTranscoded(t *testing.T, conn *fakeConn, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	mux, err := newTranscoder(conn, conn, conn)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.Set("user_id", "caller")
+
+	require.NoError(t, transcode(mux)(c))
+	return rec
+}
+
+func TestTranscodeCreatePost(t *testing.T) {
+	conn := &fakeConn{reply: &pb.PostResponse{Id: "p1", Title: "Hello", UserId: "caller"}}
+
+	rec := serveTranscoded(t, conn, http.MethodPost, "/api/posts",
+		`{"title":"Hello","tags":["go"],"user_id":"someone-else","unknown":1}`)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, pb.PostService_CreatePost_FullMethodName, conn.method)
+	assert.True(t, proto.Equal(&pb.CreatePostRequest{Title: "Hello", Tags: []string{"go"}, UserId: "caller"}, conn.req))
+
+	var res map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	assert.Equal(t, "p1", res["id"])
+	assert.Equal(t, false, res["is_private"])
+}
+
+func TestTranscodeUnlikePost(t *testing.T) {
+	conn := &fakeConn{reply: &pb.LikeResponse{Success: true, LikeCount: 4}}
+
+	rec := serveTranscoded(t, conn, http.MethodDelete, "/api/posts/like/p1", "")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, pb.PostService_UnlikePost_FullMethodName, conn.method)
+	assert.True(t, proto.Equal(&pb.UnlikePostRequest{PostId: "p1", UserId: "caller"}, conn.req))
+	assert.JSONEq(t, `{"success": true, "liked": false, "like_count": 4}`, rec.Body.String())
+}
+
+func TestTranscodeUpdateComment(t *testing.T) {
+	conn := &fakeConn{reply: &pb.Comment{Id: "c1", Content: "new", EditedAt: "2024-05-02T00:00:00+00:00"}}
+
+	rec := serveTranscoded(t, conn, http.MethodPut, "/api/posts/p1/comments/c1", `{"content": "new", "user_id": "someone-else"}`)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, pb.PostService_UpdateComment_FullMethodName, conn.method)
+	assert.True(t, proto.Equal(&pb.UpdateCommentRequest{PostId: "p1", CommentId: "c1", UserId: "caller", Content: "new"}, conn.req))
+}
+
+func TestTranscodeDeleteComment(t *testing.T) {
+	conn := &fakeConn{reply: &pb.DeleteCommentResponse{Success: true, Tombstoned: true}}
+
+	rec := serveTranscoded(t, conn, http.MethodDelete, "/api/posts/p1/comments/c1", "")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, proto.Equal(&pb.DeleteCommentRequest{PostId: "p1", CommentId: "c1", UserId: "caller"}, conn.req))
+	assert.JSONEq(t, `{"success": true, "tombstoned": true}`, rec.Body.String())
+}
+
+func TestTranscodeCommentsLayout(t *testing.T) {
+	conn := &fakeConn{reply: &pb.CommentsResponse{
+		Comments: []*pb.Comment{{Id: "c1", Replies: []*pb.Comment{{Id: "c2", ParentId: "c1", Depth: 1}}}},
+		Total:    1,
+	}}
+
+	rec := serveTranscoded(t, conn, http.MethodGet, "/api/posts/comments/p1?layout=tree", "")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, proto.Equal(&pb.GetCommentsRequest{PostId: "p1", UserId: "caller", Layout: pb.CommentLayout_TREE}, conn.req))
+	var res struct {
+		Comments []struct {
+			Replies []struct {
+				ID       string `json:"id"`
+				ParentID string `json:"parent_id"`
+			} `json:"replies"`
+		} `json:"comments"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	assert.Equal(t, "c1", res.Comments[0].Replies[0].ParentID)
+
+	rec = serveTranscoded(t, conn, http.MethodGet, "/api/posts/comments/p1?layout=nested", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestTranscodeSetCommentReaction(t *testing.T) {
+	conn := &fakeConn{reply: &pb.ReactionResponse{Reactions: []*pb.ReactionCount{{Reaction: "❤️", Count: 2}}, MyReaction: "❤️"}}
+
+	rec := serveTranscoded(t, conn, http.MethodPut, "/api/posts/p1/comments/c1/reactions", `{"reaction": "❤️"}`)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, pb.PostService_SetReaction_FullMethodName, conn.method)
+	assert.True(t, proto.Equal(&pb.SetReactionRequest{PostId: "p1", CommentId: "c1", UserId: "caller", Reaction: "❤️"}, conn.req))
+	assert.JSONEq(t, `{"reactions": [{"reaction": "❤️", "count": 2}], "my_reaction": "❤️"}`, rec.Body.String())
+}
+
+func TestTranscodeRemovePostReaction(t *testing.T) {
+	conn := &fakeConn{reply: &pb.ReactionResponse{}}
+
+	rec := serveTranscoded(t, conn, http.MethodDelete, "/api/posts/p1/reactions", "")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, proto.Equal(&pb.RemoveReactionRequest{PostId: "p1", UserId: "caller"}, conn.req))
+}
+
+func TestTranscodeReactionsTrend(t *testing.T) {
+	conn := &fakeConn{reply: &pb.ReactionTrendResponse{Data: []*pb.ReactionTrendItem{{Date: "2026-03-01", Reaction: "👍", Count: 3}}}}
+
+	rec := serveTranscoded(t, conn, http.MethodGet, "/api/stats/posts/p1/reactions/trend?period=7d", "")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, proto.Equal(&pb.PostTrendRequest{PostId: "p1", Period: "7d"}, conn.req))
+	assert.JSONEq(t, `[{"date": "2026-03-01", "reaction": "👍", "count": 3}]`, rec.Body.String())
+}
+
+func TestTranscodeBookmarkPost(t *testing.T) {
+	conn := &fakeConn{reply: &pb.BookmarkResponse{Bookmarked: true, CollectionId: "c1"}}
+
+	rec := serveTranscoded(t, conn, http.MethodPost, "/api/posts/p1/bookmark", `{"collection_id": "c1"}`)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, proto.Equal(&pb.BookmarkPostRequest{PostId: "p1", UserId: "caller", CollectionId: "c1"}, conn.req))
+	assert.JSONEq(t, `{"bookmarked": true, "collection_id": "c1"}`, rec.Body.String())
+}
+
+func TestTranscodeListBookmarks(t *testing.T) {
+	conn := &fakeConn{reply: &pb.ListBookmarksResponse{NextCursor: "next.sig"}}
+
+	rec := serveTranscoded(t, conn, http.MethodGet, "/api/me/bookmarks?limit=20&collection_id=c1", "")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, proto.Equal(&pb.ListBookmarksRequest{UserId: "caller", Limit: 20, CollectionId: "c1"}, conn.req))
+	assert.Equal(t, `</api/me/bookmarks?collection_id=c1&cursor=next.sig&limit=20>; rel="next"`, rec.Header().Get("Link"))
+}
+
+func TestTranscodeCreateBookmarkCollection(t *testing.T) {
+	conn := &fakeConn{reply: &pb.BookmarkCollection{Id: "c1", Name: "Рецепты"}}
+
+	rec := serveTranscoded(t, conn, http.MethodPost, "/api/me/bookmarks/collections", `{"name": "Рецепты"}`)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.True(t, proto.Equal(&pb.CreateBookmarkCollectionRequest{UserId: "caller", Name: "Рецепты"}, conn.req))
+}
+
+func TestTranscodeListNotifications(t *testing.T) {
+	conn := &fakeConn{reply: &pb.ListNotificationsResponse{NextCursor: "next"}}
+
+	rec := serveTranscoded(t, conn, http.MethodGet, "/api/notifications?limit=5&unread_only=true", "")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, pb.NotificationService_ListNotifications_FullMethodName, conn.method)
+	assert.True(t, proto.Equal(&pb.ListNotificationsRequest{UserId: "caller", Limit: 5, UnreadOnly: true}, conn.req))
+	assert.Equal(t, `</api/notifications?cursor=next&limit=5&unread_only=true>; rel="next"`, rec.Header().Get("Link"))
+}
+
+func TestTranscodeMarkNotificationsRead(t *testing.T) {
+	conn := &fakeConn{reply: &pb.MarkReadResponse{Marked: 2}}
+
+	rec := serveTranscoded(t, conn, http.MethodPost, "/api/notifications/read", `{"ids": ["n1", "n2"]}`)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, proto.Equal(&pb.MarkReadRequest{UserId: "caller", Ids: []string{"n1", "n2"}}, conn.req))
+	assert.JSONEq(t, `{"marked": 2}`, rec.Body.String())
+}
+
+func TestTranscodeCreateReport(t *testing.T) {
+	conn := &fakeConn{reply: &pb.Report{Id: "r1", Status: "open"}}
+
+	rec := serveTranscoded(t, conn, http.MethodPost, "/api/reports",
+		`{"target_type": "comment", "target_id": "c1", "reason": "spam"}`)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.True(t, proto.Equal(&pb.CreateReportRequest{UserId: "caller", TargetType: "comment", TargetId: "c1", Reason: "spam"}, conn.req))
+}
+
+func TestTranscodeModerationQueue(t *testing.T) {
+	conn := &fakeConn{reply: &pb.ListModerationQueueResponse{NextCursor: "next"}}
+
+	rec := serveTranscoded(t, conn, http.MethodGet, "/api/moderation/queue?target_type=post&limit=20", "")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, proto.Equal(&pb.ListModerationQueueRequest{UserId: "caller", TargetType: "post", Limit: 20}, conn.req))
+	assert.Equal(t, `</api/moderation/queue?cursor=next&limit=20&target_type=post>; rel="next"`, rec.Header().Get("Link"))
+}
+
+func TestTranscodeCreateModerationDecision(t *testing.T) {
+	conn := &fakeConn{reply: &pb.ModerationDecision{Id: "d1", Action: "suspend"}}
+
+	rec := serveTranscoded(t, conn, http.MethodPost, "/api/moderation/decisions",
+		`{"target_type": "user", "target_id": "u1", "action": "suspend", "duration_hours": 24}`)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.True(t, proto.Equal(&pb.CreateModerationDecisionRequest{
+		UserId: "caller", TargetType: "user", TargetId: "u1", Action: "suspend", DurationHours: 24,
+	}, conn.req))
+}
+
+func TestTranscodeUserIDFromQueryIgnored(t *testing.T) {
+	conn := &fakeConn{reply: &pb.PostResponse{Id: "p1"}}
+
+	rec := serveTranscoded(t, conn, http.MethodGet, "/api/posts/p1?user_id=someone-else", "")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, proto.Equal(&pb.GetPostRequest{PostId: "p1", UserId: "caller"}, conn.req))
+}
+
+func TestTranscodeListPostsQuery(t *testing.T) {
+	conn := &fakeConn{reply: &pb.ListPostsResponse{NextCursor: "next.sig"}}
+
+	rec := serveTranscoded(t, conn, http.MethodGet,
+		"/api/posts_list?limit=5&tag=go,rust&tag_match=all&sort=most_liked&author_id=7f1c0c52-8a4e-4a8f-9d0f-2a6f1c3b9e11", "")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, proto.Equal(&pb.ListPostsRequest{
+		UserId:   "caller",
+		Limit:    5,
+		AuthorId: "7f1c0c52-8a4e-4a8f-9d0f-2a6f1c3b9e11",
+		Tags:     []string{"go", "rust"},
+		TagMatch: pb.TagMatch_ALL_TAGS,
+		Sort:     pb.PostSort_MOST_LIKED,
+	}, conn.req))
+	assert.Equal(t,
+		`</api/posts_list?author_id=7f1c0c52-8a4e-4a8f-9d0f-2a6f1c3b9e11&cursor=next.sig&limit=5&sort=most_liked&tag=go%2Crust&tag_match=all>; rel="next"`,
+		rec.Header().Get("Link"))
+}
+
+func TestTranscodeSearchPosts(t *testing.T) {
+	conn := &fakeConn{reply: &pb.SearchPostsResponse{Total: 1}}
+
+	rec := serveTranscoded(t, conn, http.MethodGet, "/api/posts/search?q=+go+&tags=db&page=2", "")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, pb.PostService_SearchPosts_FullMethodName, conn.method)
+	assert.True(t, proto.Equal(&pb.SearchPostsRequest{
+		Query: "go", UserId: "caller", Page: 2, Tags: []string{"db"},
+	}, conn.req))
+
+	rec = serveTranscoded(t, &fakeConn{}, http.MethodGet, "/api/posts/search", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"detail":"q is required"`)
+}
+
+func TestTranscodeTopPosts(t *testing.T) {
+	conn := &fakeConn{reply: &pb.TopPostsResponse{Posts: []*pb.PostItem{{PostId: "p1", Count: 3}}}}
+
+	rec := serveTranscoded(t, conn, http.MethodGet, "/api/stats/top/posts?metric=Likes&period=7d", "")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, proto.Equal(&pb.TopRequest{Metric: pb.Metric_LIKES, Period: "7d"}, conn.req))
+	assert.JSONEq(t, `[{"post_id":"p1","title":"","count":3}]`, rec.Body.String())
+
+	rec = serveTranscoded(t, conn, http.MethodGet, "/api/stats/top/users", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"detail":"metric parameter is required"`)
+
+	rec = serveTranscoded(t, conn, http.MethodGet, "/api/stats/top/users?metric=shares", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"detail":"Invalid metric. Use: views/likes/comments"`)
+}
+
+func TestTranscodePostStats(t *testing.T) {
+	conn := &fakeConn{reply: &pb.PostStatsResponse{Views: 1 << 60, Likes: 2}}
+
+	rec := serveTranscoded(t, conn, http.MethodGet, "/api/stats/posts/p1", "")
+
+	// Counters stay JSON numbers as they were before the routes were
+	// transcoded, protojson alone would write them as strings.
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `{"comments":0,"likes":2,"views":1152921504606846976}`, rec.Body.String())
+}
+
+func TestTranscodeDeletePost(t *testing.T) {
+	conn := &fakeConn{reply: &pb.DeletePostResponse{Success: true}}
+
+	rec := serveTranscoded(t, conn, http.MethodDelete, "/api/posts/p1", "")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, proto.Equal(&pb.DeletePostRequest{PostId: "p1", UserId: "caller"}, conn.req))
+	assert.JSONEq(t, `{"message":"post deleted"}`, rec.Body.String())
+}
+
+func TestTranscodeErrors(t *testing.T) {
+	rec := serveTranscoded(t, &fakeConn{err: status.Error(codes.NotFound, "Post not found or permission denied")},
+		http.MethodPost, "/api/posts/like/p1", "")
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, problem.ContentType, rec.Header().Get(echo.HeaderContentType))
+	assert.JSONEq(t, `{
+		"type": "/problems/not-found",
+		"title": "Not found",
+		"status": 404,
+		"detail": "Post not found or permission denied",
+		"instance": "/api/posts/like/p1"
+	}`, rec.Body.String())
+}
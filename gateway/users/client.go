@@ -0,0 +1,66 @@
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/nanoservices/pkg/logging"
+)
+
+type Profile struct {
+	UserID    string `json:"user_id"`
+	Username  string `json:"username"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Bio       string `json:"bio"`
+}
+
+// Client reads public profiles from users_service on behalf of the caller
+// whose Authorization header is passed along with every request.
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+func NewClient(baseURL string, httpClient *http.Client) *Client {
+	return &Client{baseURL: strings.TrimRight(baseURL, "/"), http: httpClient}
+}
+
+// Profiles fetches the profiles of ids in a single request. Users that do not
+// exist are missing from the returned map.
+func (c *Client) Profiles(ctx context.Context, authorization string, ids []string) (map[string]Profile, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		c.baseURL+"/api/profiles?ids="+url.QueryEscape(strings.Join(ids, ",")), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set(logging.RequestIDHeader, logging.RequestID(ctx))
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("users_service returned %s", resp.Status)
+	}
+
+	var body struct {
+		Profiles []Profile `json:"profiles"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decode profiles: %w", err)
+	}
+
+	profiles := make(map[string]Profile, len(body.Profiles))
+	for _, p := range body.Profiles {
+		profiles[p.UserID] = p
+	}
+	return profiles, nil
+}
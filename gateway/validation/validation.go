@@ -0,0 +1,186 @@
+// Package validation checks requests, and in development responses, against
+// the gateway's OpenAPI specification.
+package validation
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/legacy"
+	"github.com/labstack/echo/v4"
+	"github.com/nanoservices/gateway/problem"
+	"github.com/nanoservices/pkg/logging"
+)
+
+type Config struct {
+	// Responses also validates what the handlers send. Mismatches are only
+	// reported, the response reaches the client unchanged.
+	Responses bool
+	// OnResponseMismatch is called for every response that does not match
+	// the specification. By default the mismatch is logged.
+	OnResponseMismatch func(c echo.Context, err error)
+}
+
+type Validator struct {
+	router routers.Router
+	cfg    Config
+}
+
+// New loads spec. Servers are ignored so that routes match whatever host
+// the gateway is reached by.
+func New(spec []byte, cfg Config) (*Validator, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(spec)
+	if err != nil {
+		return nil, fmt.Errorf("load specification: %w", err)
+	}
+	doc.Servers = nil
+
+	router, err := legacy.NewRouter(doc)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.OnResponseMismatch == nil {
+		cfg.OnResponseMismatch = logMismatch
+	}
+	return &Validator{router: router, cfg: cfg}, nil
+}
+
+// Middleware rejects requests that do not match the specification with a
+// problem listing every invalid parameter and body field. Routes missing
+// from the specification, such as /metrics, are passed through.
+func (v *Validator) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			route, pathParams, err := v.router.FindRoute(req)
+			if err != nil {
+				return next(c)
+			}
+
+			input := &openapi3filter.RequestValidationInput{
+				Request:    req,
+				PathParams: pathParams,
+				Route:      route,
+				Options: &openapi3filter.Options{
+					MultiError: true,
+					// Authentication is checked by the JWT middleware.
+					AuthenticationFunc:  openapi3filter.NoopAuthenticationFunc,
+					SkipSettingDefaults: true,
+				},
+			}
+			if err := openapi3filter.ValidateRequest(req.Context(), input); err != nil {
+				p := problem.New(http.StatusBadRequest, "the request does not match the API specification")
+				p.Errors = fieldErrors(err, "")
+				return problem.Write(c, p)
+			}
+
+			if !v.cfg.Responses {
+				return next(c)
+			}
+			return v.checkResponse(c, next, input)
+		}
+	}
+}
+
+func (v *Validator) checkResponse(c echo.Context, next echo.HandlerFunc, input *openapi3filter.RequestValidationInput) error {
+	res := c.Response()
+	rec := &recorder{ResponseWriter: res.Writer}
+	res.Writer = rec
+	defer func() { res.Writer = rec.ResponseWriter }()
+
+	// Errors are written later by the HTTP error handler, streams and
+	// WebSockets cannot be buffered.
+	if err := next(c); err != nil || rec.streamed || !res.Committed {
+		return err
+	}
+
+	out := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: input,
+		Status:                 res.Status,
+		Header:                 res.Header(),
+		Options: &openapi3filter.Options{
+			MultiError:            true,
+			IncludeResponseStatus: true,
+		},
+	}
+	out.SetBodyBytes(rec.body.Bytes())
+	if err := openapi3filter.ValidateResponse(context.WithoutCancel(c.Request().Context()), out); err != nil {
+		v.cfg.OnResponseMismatch(c, err)
+	}
+	return nil
+}
+
+func logMismatch(c echo.Context, err error) {
+	req := c.Request()
+	logging.For("openapi").WarnContext(req.Context(), "Response does not match the specification",
+		"method", req.Method, "path", req.URL.Path, "status", c.Response().Status, "error", err)
+}
+
+// fieldErrors flattens the errors of ValidateRequest. Parameters are reported
+// by name and body fields by their dotted path, e.g. tags.0.
+func fieldErrors(err error, field string) []problem.FieldError {
+	switch e := err.(type) {
+	case openapi3.MultiError:
+		var out []problem.FieldError
+		for _, err := range e {
+			out = append(out, fieldErrors(err, field)...)
+		}
+		return out
+	case *openapi3filter.RequestError:
+		switch {
+		case e.Parameter != nil:
+			field = e.Parameter.Name
+		case e.RequestBody != nil:
+			field = "body"
+		}
+		if e.Err == nil {
+			return []problem.FieldError{{Field: field, Detail: e.Reason}}
+		}
+		if errors.Is(e.Err, openapi3filter.ErrInvalidRequired) {
+			return []problem.FieldError{{Field: field, Detail: "is required"}}
+		}
+		return fieldErrors(e.Err, field)
+	case *openapi3.SchemaError:
+		if path := e.JSONPointer(); len(path) > 0 && field == "body" {
+			field = strings.Join(path, ".")
+		}
+		return []problem.FieldError{{Field: field, Detail: e.Reason}}
+	}
+	return []problem.FieldError{{Field: field, Detail: err.Error()}}
+}
+
+// recorder keeps a copy of the response body. Flushed and hijacked
+// responses are marked as streamed and not validated.
+type recorder struct {
+	http.ResponseWriter
+	body     bytes.Buffer
+	streamed bool
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *recorder) Flush() {
+	r.streamed = true
+	http.NewResponseController(r.ResponseWriter).Flush()
+}
+
+func (r *recorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	r.streamed = true
+	return http.NewResponseController(r.ResponseWriter).Hijack()
+}
+
+func (r *recorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
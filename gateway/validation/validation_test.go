@@ -0,0 +1,190 @@
+package validation
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nanoservices/gateway/problem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const spec = `
+openapi: 3.0.0
+info:
+  title: test
+  version: 1.0.0
+servers:
+  - url: http://localhost:8080
+paths:
+  /posts/{post_id}:
+    put:
+      parameters:
+        - in: path
+          name: post_id
+          required: true
+          schema:
+            type: string
+        - in: query
+          name: limit
+          schema:
+            type: integer
+            maximum: 100
+        - in: query
+          name: sort
+          schema:
+            type: string
+            enum: [NEWEST, newest]
+      requestBody:
+        content:
+          application/json:
+            schema:
+              type: object
+              required: [title]
+              properties:
+                title:
+                  type: string
+                  minLength: 1
+                tags:
+                  type: array
+                  items:
+                    type: string
+      responses:
+        "200":
+          description: ok
+          content:
+            application/json:
+              schema:
+                type: object
+                required: [id]
+                properties:
+                  id:
+                    type: string
+`
+
+func newServer(t *testing.T, cfg Config, handler echo.HandlerFunc) *echo.Echo {
+	t.Helper()
+	v, err := New([]byte(spec), cfg)
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.Use(v.Middleware())
+	e.PUT("/posts/:id", handler)
+	e.GET("/metrics", handler)
+	return e
+}
+
+func serve(e *echo.Echo, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Host = "gateway:8080"
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestValidRequestPassesBodyThrough(t *testing.T) {
+	var got string
+	e := newServer(t, Config{}, func(c echo.Context) error {
+		body, _ := io.ReadAll(c.Request().Body)
+		got = string(body)
+		return c.JSON(http.StatusOK, map[string]string{"id": c.Param("id")})
+	})
+
+	rec := serve(e, http.MethodPut, "/posts/p1?limit=5&sort=newest", `{"title":"Hello","tags":["go"]}`)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `{"title":"Hello","tags":["go"]}`, got)
+}
+
+func TestInvalidRequestRejected(t *testing.T) {
+	called := false
+	e := newServer(t, Config{}, func(c echo.Context) error {
+		called = true
+		return c.NoContent(http.StatusOK)
+	})
+
+	rec := serve(e, http.MethodPut, "/posts/p1?limit=500&sort=random", `{"title":"","tags":[1]}`)
+
+	assert.False(t, called)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, problem.ContentType, rec.Header().Get(echo.HeaderContentType))
+
+	var p problem.Problem
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+	fields := map[string]string{}
+	for _, fe := range p.Errors {
+		fields[fe.Field] = fe.Detail
+	}
+	assert.Contains(t, fields["limit"], "number must be at most 100")
+	assert.Contains(t, fields["sort"], "not one of the allowed values")
+	assert.Contains(t, fields["title"], "minimum string length is 1")
+	assert.Contains(t, fields["tags.0"], "must be a string")
+}
+
+func TestMissingRequiredBodyField(t *testing.T) {
+	e := newServer(t, Config{}, func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	rec := serve(e, http.MethodPut, "/posts/p1", `{"tags":[]}`)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"field":"title"`)
+}
+
+func TestUnknownRoutesPassThrough(t *testing.T) {
+	e := newServer(t, Config{}, func(c echo.Context) error { return c.String(http.StatusOK, "ok") })
+
+	rec := serve(e, http.MethodGet, "/metrics?limit=abc", "")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestResponseMismatchReported(t *testing.T) {
+	var mismatch error
+	e := newServer(t, Config{
+		Responses:          true,
+		OnResponseMismatch: func(_ echo.Context, err error) { mismatch = err },
+	}, func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]int{"id": 1})
+	})
+
+	rec := serve(e, http.MethodPut, "/posts/p1", `{"title":"Hello"}`)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"id":1}`, rec.Body.String())
+	require.Error(t, mismatch)
+	assert.Contains(t, mismatch.Error(), "must be a string")
+}
+
+func TestResponseStatusNotInSpec(t *testing.T) {
+	var mismatch error
+	e := newServer(t, Config{
+		Responses:          true,
+		OnResponseMismatch: func(_ echo.Context, err error) { mismatch = err },
+	}, func(c echo.Context) error {
+		return c.JSON(http.StatusTeapot, map[string]string{"id": "p1"})
+	})
+
+	serve(e, http.MethodPut, "/posts/p1", `{"title":"Hello"}`)
+
+	require.Error(t, mismatch)
+	assert.Contains(t, mismatch.Error(), "status is not supported")
+}
+
+func TestMatchingResponseNotReported(t *testing.T) {
+	e := newServer(t, Config{
+		Responses:          true,
+		OnResponseMismatch: func(_ echo.Context, err error) { t.Errorf("unexpected mismatch: %v", err) },
+	}, func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]string{"id": c.Param("id")})
+	})
+
+	rec := serve(e, http.MethodPut, "/posts/p1", `{"title":"Hello"}`)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
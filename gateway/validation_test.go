@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	pb "github.com/nanoservices/gateway/generated"
+	"github.com/nanoservices/gateway/validation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// serveValidated sends a request through the validator and the transcoder,
+// failing the test when the response does not match openapi.yaml.
+func serveValidated(t *testing.T, conn *fakeConn, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	v, err := validation.New(openAPISpec, validation.Config{
+		Responses: true,
+		OnResponseMismatch: func(c echo.Context, err error) {
+			t.Errorf("%s %s: response does not match openapi.yaml: %v", c.Request().Method, c.Request().URL, err)
+		},
+	})
+	require.NoError(t, err)
+	mux, err := newTranscoder(conn, conn, conn)
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.Use(v.Middleware())
+	e.Any("/api/*", transcode(mux), func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("user_id", "caller")
+			return next(c)
+		}
+	})
+
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestNewValidator(t *testing.T) {
+	for _, mode := range []string{"", "requests", "all"} {
+		v, err := newValidator(mode)
+		require.NoError(t, err, mode)
+		assert.NotNil(t, v, mode)
+	}
+
+	v, err := newValidator("off")
+	require.NoError(t, err)
+	assert.Nil(t, v)
+
+	_, err = newValidator("strict")
+	assert.Error(t, err)
+}
+
+func TestTranscodedResponsesMatchSpec(t *testing.T) {
+	post := &pb.PostResponse{Id: "p1", Title: "Hello", UserId: "caller", Tags: []string{"go"}, LikeCount: 1, LikedByMe: true}
+	tests := []struct {
+		method, target, body string
+		reply                proto.Message
+		status               int
+	}{
+		{http.MethodPost, "/api/posts", `{"title":"Hello","tags":["go"]}`, post, http.StatusCreated},
+		{http.MethodGet, "/api/posts/p1", "", post, http.StatusOK},
+		{http.MethodGet, "/api/posts_list?limit=5&tag=go&tag_match=all&sort=most_liked", "",
+			&pb.ListPostsResponse{Posts: []*pb.PostResponse{post}, NextCursor: "next.sig"}, http.StatusOK},
+		{http.MethodGet, "/api/posts/search?q=go", "",
+			&pb.SearchPostsResponse{Total: 1, Facets: []*pb.TagFacet{{Tag: "go", Count: 1}}}, http.StatusOK},
+		{http.MethodDelete, "/api/posts/like/p1", "", &pb.LikeResponse{Success: true, LikeCount: 2}, http.StatusOK},
+		{http.MethodGet, "/api/stats/posts/p1", "", &pb.PostStatsResponse{Views: 3}, http.StatusOK},
+		{http.MethodGet, "/api/stats/top/posts?metric=likes&period=7d", "",
+			&pb.TopPostsResponse{Posts: []*pb.PostItem{{PostId: "p1", Count: 3}}}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		rec := serveValidated(t, &fakeConn{reply: tt.reply}, tt.method, tt.target, tt.body)
+		assert.Equal(t, tt.status, rec.Code, tt.target)
+	}
+}
+
+func TestTranscodedErrorsMatchSpec(t *testing.T) {
+	rec := serveValidated(t, &fakeConn{err: status.Error(codes.NotFound, "Post not found")},
+		http.MethodPost, "/api/posts/like/p1", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = serveValidated(t, &fakeConn{}, http.MethodGet, "/api/stats/top/users?metric=shares", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"field":"metric"`)
+}
+
+func TestInvalidRequestNotTranscoded(t *testing.T) {
+	conn := &fakeConn{}
+
+	rec := serveValidated(t, conn, http.MethodPost, "/api/posts", `{"title":"Hello","tags":"go"}`)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"field":"tags"`)
+	assert.Empty(t, conn.method)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	pb "github.com/nanoservices/notifications_service/generated"
+	"github.com/nanoservices/notifications_service/notifier"
+	"github.com/nanoservices/notifications_service/repository"
+	"github.com/nanoservices/notifications_service/server"
+	"github.com/nanoservices/pkg/logging"
+	"github.com/nanoservices/pkg/pubsub"
+)
+
+func main() {
+	if err := logging.Setup("notifications_service", os.Getenv("LOG_LEVEL")); err != nil {
+		slog.Error("Invalid LOG_LEVEL", "error", err)
+		os.Exit(1)
+	}
+
+	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable pool_max_conns=10",
+		os.Getenv("DB_HOST"), os.Getenv("DB_PORT"), os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_NAME"))
+	pool, err := pgxpool.New(context.Background(), connStr)
+	if err != nil {
+		slog.Error("Unable to create connection pool", "error", err)
+		os.Exit(1)
+	}
+	defer pool.Close()
+	repo := repository.NewRepository(pool)
+
+	postConn, err := grpc.NewClient(
+		getenv("EVENTS_SERVICE_ADDR", "events_service:50051"),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(logging.UnaryClientInterceptor()),
+	)
+	if err != nil {
+		slog.Error("Failed to create events service client", "error", err)
+		os.Exit(1)
+	}
+	defer postConn.Close()
+
+	brokers := strings.Split(getenv("KAFKA_BROKERS", "kafka:9092"), ",")
+	deadLetters, err := pubsub.NewKafkaPublisher(pubsub.KafkaConfig{Brokers: brokers})
+	if err != nil {
+		slog.Error("Failed to create Kafka publisher", "error", err)
+		os.Exit(1)
+	}
+	defer deadLetters.Close()
+	subscriber := pubsub.NewKafkaSubscriber(pubsub.KafkaSubscriberConfig{
+		Brokers: brokers,
+		GroupID: notifier.ConsumerGroup,
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	users := notifier.NewUsersClient(getenv("USER_SERVICE_URL", "http://users_service:8081"),
+		os.Getenv("INTERNAL_API_TOKEN"), &http.Client{Timeout: 5 * time.Second})
+	n := notifier.New(repo, notifier.NewPostClient(pb.NewPostServiceClient(postConn)), users)
+	go func() {
+		if err := n.Consume(ctx, subscriber, deadLetters); err != nil {
+			slog.Error("Consumer stopped", "error", err)
+			stop()
+		}
+	}()
+
+	lis, err := net.Listen("tcp", ":50053")
+	if err != nil {
+		slog.Error("Failed to listen", "error", err)
+		os.Exit(1)
+	}
+	s := grpc.NewServer(grpc.ChainUnaryInterceptor(logging.UnaryServerInterceptor()))
+	pb.RegisterNotificationServiceServer(s, server.New(repo))
+
+	go func() {
+		<-ctx.Done()
+		slog.Info("Shutting down the server")
+		s.GracefulStop()
+	}()
+
+	slog.Info("Starting server", "addr", lis.Addr().String())
+	if err := s.Serve(lis); err != nil {
+		slog.Error("gRPC server error", "error", err)
+		os.Exit(1)
+	}
+}
+
+func getenv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
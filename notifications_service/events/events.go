@@ -0,0 +1,41 @@
+// Package events decodes the envelope that producers wrap Kafka messages in.
+// The schemas of the payloads are owned by the gateway, see gateway/events.
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	UserRegistered = "user.registered"
+	PostLiked      = "post.liked"
+	PostUnliked    = "post.unliked"
+	PostCommented  = "post.commented"
+)
+
+type Envelope struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Version    int             `json:"version"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Producer   string          `json:"producer"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// ErrNotEnvelope is returned by Decode for messages written before the
+// envelope was introduced.
+var ErrNotEnvelope = errors.New("message is not an event envelope")
+
+// Decode parses an envelope without validating the payload.
+func Decode(data []byte) (*Envelope, error) {
+	var e Envelope
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	if e.Type == "" || e.Version == 0 || len(e.Payload) == 0 {
+		return nil, ErrNotEnvelope
+	}
+	return &e, nil
+}
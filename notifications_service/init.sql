@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS notifications (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    recipient_id UUID NOT NULL,
+    type VARCHAR(16) NOT NULL CHECK (type IN ('like', 'comment', 'mention')),
+    post_id UUID NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    read_at TIMESTAMP WITH TIME ZONE
+);
+
+-- A recipient has at most one unread notification per post and type, new
+-- events are folded into it.
+CREATE UNIQUE INDEX IF NOT EXISTS notifications_unread_idx ON notifications(recipient_id, type, post_id) WHERE read_at IS NULL;
+CREATE INDEX IF NOT EXISTS notifications_recipient_idx ON notifications(recipient_id, updated_at DESC, id DESC);
+
+CREATE TABLE IF NOT EXISTS notification_actors (
+    notification_id UUID NOT NULL REFERENCES notifications(id) ON DELETE CASCADE,
+    actor_id UUID NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (notification_id, actor_id)
+);
+
+CREATE TABLE IF NOT EXISTS notification_mutes (
+    user_id UUID NOT NULL,
+    type VARCHAR(16) NOT NULL,
+    PRIMARY KEY (user_id, type)
+);
+
+-- Usernames from user.registered events, mentions are resolved with them.
+CREATE TABLE IF NOT EXISTS users (
+    id UUID PRIMARY KEY,
+    username VARCHAR(255) UNIQUE NOT NULL
+);
@@ -0,0 +1,277 @@
+// Package notifier turns interaction events into notifications for the
+// author of the post and for the users mentioned in comments.
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nanoservices/notifications_service/events"
+	"github.com/nanoservices/pkg/logging"
+	"github.com/nanoservices/pkg/pubsub"
+)
+
+const (
+	Like    = "like"
+	Comment = "comment"
+	Mention = "mention"
+)
+
+// Types lists the notification types, each of them can be muted.
+var Types = []string{Like, Comment, Mention}
+
+const ConsumerGroup = "notifications-service"
+
+// legacyTypes are the event types of messages written before the envelope
+// was introduced.
+var legacyTypes = map[string]string{
+	"post_likes":         events.PostLiked,
+	"post_comments":      events.PostCommented,
+	"user_registrations": events.UserRegistered,
+}
+
+// Topics are the topics the notifier consumes. Unlikes share the likes topic.
+var Topics = []string{"post_likes", "post_comments", "user_registrations"}
+
+const (
+	maxAttempts = 3
+	retryDelay  = 500 * time.Millisecond
+	// maxMentions bounds the lookups a single comment can cause.
+	maxMentions = 10
+)
+
+// A mention is @username not preceded by a word character, so e-mail
+// addresses are not mistaken for mentions.
+var mentionPattern = regexp.MustCompile(`\B@([\p{L}\p{N}_]+(?:[.-][\p{L}\p{N}_]+)*)`)
+
+// ErrMalformed marks events that cannot be handled however often they are
+// retried.
+var ErrMalformed = errors.New("malformed event")
+
+// ErrPostNotFound is returned by PostAuthors for posts that are deleted or
+// not visible to the viewer.
+var ErrPostNotFound = errors.New("post not found")
+
+type Store interface {
+	AddActor(ctx context.Context, recipientID, typ, postID, actorID string, at time.Time) error
+	RemoveActor(ctx context.Context, recipientID, typ, postID, actorID string) error
+	SaveUser(ctx context.Context, userID, username string) error
+	UserIDs(ctx context.Context, usernames []string) (map[string]string, error)
+}
+
+type PostAuthors interface {
+	// Author returns the author of postID as seen by viewerID.
+	Author(ctx context.Context, postID, viewerID string) (string, error)
+}
+
+// Directory looks up users the store has not seen, e.g. those who registered
+// before the service started consuming user.registered events.
+type Directory interface {
+	UserIDs(ctx context.Context, usernames []string) (map[string]string, error)
+}
+
+type Notifier struct {
+	store Store
+	posts PostAuthors
+	users Directory
+
+	now        func() time.Time
+	retryDelay time.Duration
+}
+
+func New(store Store, posts PostAuthors, users Directory) *Notifier {
+	return &Notifier{store: store, posts: posts, users: users, now: time.Now, retryDelay: retryDelay}
+}
+
+type payload struct {
+	PostID   string `json:"post_id"`
+	UserID   string `json:"user_id"`
+	Content  string `json:"content"`
+	Username string `json:"username"`
+}
+
+// Consume handles the messages of Topics until ctx is canceled. A failing
+// message is retried and then published to the dead-letter topic of its
+// source topic, malformed ones are dead-lettered right away.
+func (n *Notifier) Consume(ctx context.Context, sub pubsub.EventSubscriber, deadLetters pubsub.EventPublisher) error {
+	logger := logging.For("kafka")
+	return sub.Subscribe(ctx, Topics, func(ctx context.Context, msg pubsub.Message) error {
+		ctx = logging.WithRequestID(ctx, msg.Header(logging.RequestIDHeader))
+		attempt := 1
+		err := n.Handle(ctx, msg)
+		for err != nil && !errors.Is(err, ErrMalformed) && attempt < maxAttempts {
+			logger.WarnContext(ctx, "Failed to handle event, retrying",
+				"topic", msg.Topic, "offset", msg.Offset, "attempt", attempt, "error", err)
+			select {
+			case <-time.After(n.retryDelay * time.Duration(attempt)):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			attempt++
+			err = n.Handle(ctx, msg)
+		}
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+
+		logger.ErrorContext(ctx, "Dead-lettering event",
+			"topic", msg.Topic, "offset", msg.Offset, "attempts", attempt, "error", err)
+		return deadLetters.Publish(ctx, pubsub.NewDeadLetter(msg, pubsub.Failure{
+			Err:      err.Error(),
+			Attempts: attempt,
+			Consumer: ConsumerGroup,
+			At:       n.now(),
+		}))
+	})
+}
+
+// Handle stores the notifications caused by one message.
+func (n *Notifier) Handle(ctx context.Context, msg pubsub.Message) error {
+	eventType, data, at := legacyTypes[msg.Topic], msg.Value, msg.Time
+	if e, err := events.Decode(msg.Value); err == nil {
+		eventType, data, at = e.Type, e.Payload, e.OccurredAt
+	} else if !errors.Is(err, events.ErrNotEnvelope) {
+		return fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	if at.IsZero() {
+		at = n.now()
+	}
+
+	var p payload
+	if err := json.Unmarshal(data, &p); err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	if err := uuid.Validate(p.UserID); err != nil {
+		return fmt.Errorf("%w: user_id: %v", ErrMalformed, err)
+	}
+
+	switch eventType {
+	case events.UserRegistered:
+		if p.Username == "" {
+			return nil
+		}
+		return n.store.SaveUser(ctx, p.UserID, p.Username)
+	case events.PostLiked, events.PostUnliked, events.PostCommented:
+		if err := uuid.Validate(p.PostID); err != nil {
+			return fmt.Errorf("%w: post_id: %v", ErrMalformed, err)
+		}
+	default:
+		// Other events of the same topics, e.g. newer types, are not
+		// notified about.
+		return nil
+	}
+
+	author, err := n.posts.Author(ctx, p.PostID, p.UserID)
+	if errors.Is(err, ErrPostNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	switch eventType {
+	case events.PostLiked:
+		if author == p.UserID {
+			return nil
+		}
+		return n.store.AddActor(ctx, author, Like, p.PostID, p.UserID, at)
+	case events.PostUnliked:
+		if author == p.UserID {
+			return nil
+		}
+		return n.store.RemoveActor(ctx, author, Like, p.PostID, p.UserID)
+	}
+
+	if author != p.UserID {
+		if err := n.store.AddActor(ctx, author, Comment, p.PostID, p.UserID, at); err != nil {
+			return err
+		}
+	}
+	return n.notifyMentions(ctx, p, author, at)
+}
+
+// notifyMentions notifies the users mentioned in a comment who can see the
+// post. The author of the post is already notified about the comment.
+func (n *Notifier) notifyMentions(ctx context.Context, p payload, author string, at time.Time) error {
+	usernames := Mentions(p.Content)
+	if len(usernames) == 0 {
+		return nil
+	}
+	ids, err := n.userIDs(ctx, usernames)
+	if err != nil {
+		return err
+	}
+
+	for _, username := range usernames {
+		recipient, ok := ids[username]
+		if !ok {
+			logging.For("notifier").InfoContext(ctx, "Mentioned user not found", "username", username, "post_id", p.PostID)
+			continue
+		}
+		if recipient == p.UserID || recipient == author {
+			continue
+		}
+		if _, err := n.posts.Author(ctx, p.PostID, recipient); errors.Is(err, ErrPostNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := n.store.AddActor(ctx, recipient, Mention, p.PostID, p.UserID, at); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// userIDs resolves usernames from the store and looks the missing ones up in
+// the directory, saving them for the next mentions.
+func (n *Notifier) userIDs(ctx context.Context, usernames []string) (map[string]string, error) {
+	ids, err := n.store.UserIDs(ctx, usernames)
+	if err != nil {
+		return nil, err
+	}
+	var missing []string
+	for _, username := range usernames {
+		if _, ok := ids[username]; !ok {
+			missing = append(missing, username)
+		}
+	}
+	if len(missing) == 0 {
+		return ids, nil
+	}
+
+	found, err := n.users.UserIDs(ctx, missing)
+	if err != nil {
+		return nil, fmt.Errorf("look up users: %w", err)
+	}
+	for username, id := range found {
+		if err := n.store.SaveUser(ctx, id, username); err != nil {
+			return nil, err
+		}
+		ids[username] = id
+	}
+	return ids, nil
+}
+
+// Mentions returns the distinct usernames mentioned in text in the order
+// they appear, at most maxMentions of them.
+func Mentions(text string) []string {
+	var usernames []string
+	seen := map[string]bool{}
+	for _, m := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		if seen[m[1]] {
+			continue
+		}
+		seen[m[1]] = true
+		usernames = append(usernames, m[1])
+		if len(usernames) == maxMentions {
+			break
+		}
+	}
+	return usernames
+}
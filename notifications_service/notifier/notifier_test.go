@@ -0,0 +1,277 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nanoservices/pkg/pubsub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	author = "0b8c8a43-5f6e-4c0e-9d6b-1f2a3b4c5d6e"
+	alice  = "1c9d9b54-6a7f-4d1f-8e7c-2a3b4c5d6e7f"
+	bob    = "2dae0c65-7b80-4e20-9f8d-3b4c5d6e7f80"
+	post   = "3ebf1d76-8c91-4f31-a09e-4c5d6e7f8091"
+)
+
+type call struct {
+	op, recipient, typ, actor string
+}
+
+type fakeStore struct {
+	calls []call
+	users map[string]string
+	err   error
+}
+
+func (s *fakeStore) AddActor(_ context.Context, recipientID, typ, postID, actorID string, _ time.Time) error {
+	s.calls = append(s.calls, call{"add", recipientID, typ, actorID})
+	return s.err
+}
+
+func (s *fakeStore) RemoveActor(_ context.Context, recipientID, typ, postID, actorID string) error {
+	s.calls = append(s.calls, call{"remove", recipientID, typ, actorID})
+	return s.err
+}
+
+func (s *fakeStore) SaveUser(_ context.Context, userID, username string) error {
+	if s.users == nil {
+		s.users = map[string]string{}
+	}
+	s.users[username] = userID
+	return s.err
+}
+
+func (s *fakeStore) UserIDs(_ context.Context, usernames []string) (map[string]string, error) {
+	ids := map[string]string{}
+	for _, u := range usernames {
+		if id, ok := s.users[u]; ok {
+			ids[u] = id
+		}
+	}
+	return ids, nil
+}
+
+// fakePosts knows the author of post and hides it from the viewers in
+// hiddenFrom.
+type fakePosts struct {
+	hiddenFrom map[string]bool
+}
+
+func (p fakePosts) Author(_ context.Context, postID, viewerID string) (string, error) {
+	if postID != post || p.hiddenFrom[viewerID] {
+		return "", ErrPostNotFound
+	}
+	return author, nil
+}
+
+// fakeDirectory plays users_service.
+type fakeDirectory struct {
+	users   map[string]string
+	err     error
+	lookups [][]string
+}
+
+func (d *fakeDirectory) UserIDs(_ context.Context, usernames []string) (map[string]string, error) {
+	d.lookups = append(d.lookups, usernames)
+	ids := map[string]string{}
+	for _, u := range usernames {
+		if id, ok := d.users[u]; ok {
+			ids[u] = id
+		}
+	}
+	return ids, d.err
+}
+
+func event(t *testing.T, topic, eventType string, payload map[string]string) pubsub.Message {
+	t.Helper()
+	data, err := json.Marshal(payload)
+	require.NoError(t, err)
+	value, err := json.Marshal(map[string]any{
+		"id":          "e1",
+		"type":        eventType,
+		"version":     1,
+		"occurred_at": time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+		"producer":    "events_service",
+		"payload":     json.RawMessage(data),
+	})
+	require.NoError(t, err)
+	return pubsub.Message{Topic: topic, Value: value}
+}
+
+func TestHandleLike(t *testing.T) {
+	store := &fakeStore{}
+	n := New(store, fakePosts{}, &fakeDirectory{})
+
+	require.NoError(t, n.Handle(context.Background(), event(t, "post_likes", "post.liked", map[string]string{"post_id": post, "user_id": alice})))
+	require.NoError(t, n.Handle(context.Background(), event(t, "post_likes", "post.unliked", map[string]string{"post_id": post, "user_id": alice})))
+
+	assert.Equal(t, []call{{"add", author, Like, alice}, {"remove", author, Like, alice}}, store.calls)
+}
+
+func TestHandleOwnLikeIgnored(t *testing.T) {
+	store := &fakeStore{}
+	n := New(store, fakePosts{}, &fakeDirectory{})
+
+	require.NoError(t, n.Handle(context.Background(), event(t, "post_likes", "post.liked", map[string]string{"post_id": post, "user_id": author})))
+
+	assert.Empty(t, store.calls)
+}
+
+func TestHandleLegacyLike(t *testing.T) {
+	store := &fakeStore{}
+	n := New(store, fakePosts{}, &fakeDirectory{})
+
+	msg := pubsub.Message{Topic: "post_likes", Value: []byte(`{"post_id": "` + post + `", "user_id": "` + alice + `"}`)}
+	require.NoError(t, n.Handle(context.Background(), msg))
+
+	assert.Equal(t, []call{{"add", author, Like, alice}}, store.calls)
+}
+
+func TestHandleCommentWithMentions(t *testing.T) {
+	store := &fakeStore{users: map[string]string{"alice": alice, "bob": bob, "owner": author}}
+	n := New(store, fakePosts{}, &fakeDirectory{})
+
+	content := "@bob @owner look, and mail me at alice@example.com @bob @nobody"
+	require.NoError(t, n.Handle(context.Background(), event(t, "post_comments", "post.commented", map[string]string{
+		"post_id": post, "user_id": alice, "content": content,
+	})))
+
+	// The author is notified about the comment only once, unknown users
+	// and e-mail addresses are not mentions.
+	assert.Equal(t, []call{{"add", author, Comment, alice}, {"add", bob, Mention, alice}}, store.calls)
+}
+
+func TestHandleMentionOfUserMissingFromStore(t *testing.T) {
+	store := &fakeStore{users: map[string]string{"bob": bob}}
+	users := &fakeDirectory{users: map[string]string{"alice": alice}}
+	n := New(store, fakePosts{}, users)
+	comment := event(t, "post_comments", "post.commented", map[string]string{
+		"post_id": post, "user_id": bob, "content": "@alice @bob @nobody",
+	})
+
+	require.NoError(t, n.Handle(context.Background(), comment))
+	require.NoError(t, n.Handle(context.Background(), comment))
+
+	// alice registered before her event could be consumed: she is looked up
+	// once and saved, nobody is looked up with every comment.
+	assert.Equal(t, [][]string{{"alice", "nobody"}, {"nobody"}}, users.lookups)
+	assert.Equal(t, alice, store.users["alice"])
+	assert.Equal(t, []call{
+		{"add", author, Comment, bob}, {"add", alice, Mention, bob},
+		{"add", author, Comment, bob}, {"add", alice, Mention, bob},
+	}, store.calls)
+}
+
+func TestHandleMentionDirectoryUnavailable(t *testing.T) {
+	n := New(&fakeStore{}, fakePosts{}, &fakeDirectory{err: errors.New("connection refused")})
+
+	err := n.Handle(context.Background(), event(t, "post_comments", "post.commented", map[string]string{
+		"post_id": post, "user_id": bob, "content": "@alice",
+	}))
+
+	assert.ErrorContains(t, err, "connection refused")
+	assert.NotErrorIs(t, err, ErrMalformed)
+}
+
+func TestHandleMentionOfUserWhoCannotSeePost(t *testing.T) {
+	store := &fakeStore{users: map[string]string{"bob": bob}}
+	n := New(store, fakePosts{hiddenFrom: map[string]bool{bob: true}}, &fakeDirectory{})
+
+	require.NoError(t, n.Handle(context.Background(), event(t, "post_comments", "post.commented", map[string]string{
+		"post_id": post, "user_id": author, "content": "thanks @bob",
+	})))
+
+	assert.Empty(t, store.calls)
+}
+
+func TestHandleDeletedPost(t *testing.T) {
+	store := &fakeStore{}
+	n := New(store, fakePosts{}, &fakeDirectory{})
+
+	other := "4fc02e87-9da2-4042-b1af-5d6e7f8091a2"
+	require.NoError(t, n.Handle(context.Background(), event(t, "post_likes", "post.liked", map[string]string{"post_id": other, "user_id": alice})))
+
+	assert.Empty(t, store.calls)
+}
+
+func TestHandleRegistration(t *testing.T) {
+	store := &fakeStore{}
+	n := New(store, fakePosts{}, &fakeDirectory{})
+
+	require.NoError(t, n.Handle(context.Background(), event(t, "user_registrations", "user.registered", map[string]string{"user_id": bob, "username": "bob"})))
+
+	assert.Equal(t, map[string]string{"bob": bob}, store.users)
+}
+
+func TestHandleMalformed(t *testing.T) {
+	n := New(&fakeStore{}, fakePosts{}, &fakeDirectory{})
+
+	err := n.Handle(context.Background(), event(t, "post_likes", "post.liked", map[string]string{"post_id": "1", "user_id": alice}))
+
+	assert.ErrorIs(t, err, ErrMalformed)
+}
+
+func TestMentions(t *testing.T) {
+	assert.Equal(t, []string{"anna.k", "ivan_petrov"}, Mentions("@anna.k, ask @ivan_petrov. And @anna.k again, not a@b.c"))
+	assert.Nil(t, Mentions("no mentions here"))
+}
+
+type fakeSubscriber struct {
+	msgs []pubsub.Message
+}
+
+func (s *fakeSubscriber) Subscribe(ctx context.Context, _ []string, handler pubsub.Handler) error {
+	for _, msg := range s.msgs {
+		if err := handler(ctx, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fakeSubscriber) Close() error { return nil }
+
+type fakePublisher struct {
+	published []pubsub.Message
+}
+
+func (p *fakePublisher) Publish(_ context.Context, msgs ...pubsub.Message) error {
+	p.published = append(p.published, msgs...)
+	return nil
+}
+
+func (p *fakePublisher) Close() error { return nil }
+
+func TestConsumeDeadLettersAfterRetries(t *testing.T) {
+	store := &fakeStore{err: errors.New("database is down")}
+	n := New(store, fakePosts{}, &fakeDirectory{})
+	n.retryDelay = time.Millisecond
+	msg := event(t, "post_likes", "post.liked", map[string]string{"post_id": post, "user_id": alice})
+	publisher := &fakePublisher{}
+
+	require.NoError(t, n.Consume(context.Background(), &fakeSubscriber{msgs: []pubsub.Message{msg}}, publisher))
+
+	assert.Len(t, store.calls, maxAttempts)
+	require.Len(t, publisher.published, 1)
+	dead := publisher.published[0]
+	assert.Equal(t, "post_likes.dlq", dead.Topic)
+	assert.Equal(t, "3", dead.Header(pubsub.HeaderAttempts))
+	assert.Equal(t, ConsumerGroup, dead.Header(pubsub.HeaderConsumer))
+}
+
+func TestConsumeDeadLettersMalformedRightAway(t *testing.T) {
+	publisher := &fakePublisher{}
+	n := New(&fakeStore{}, fakePosts{}, &fakeDirectory{})
+	msg := pubsub.Message{Topic: "post_comments", Value: []byte("not json")}
+
+	require.NoError(t, n.Consume(context.Background(), &fakeSubscriber{msgs: []pubsub.Message{msg}}, publisher))
+
+	require.Len(t, publisher.published, 1)
+	assert.Equal(t, "1", publisher.published[0].Header(pubsub.HeaderAttempts))
+}
@@ -0,0 +1,30 @@
+package notifier
+
+import (
+	"context"
+
+	pb "github.com/nanoservices/notifications_service/generated"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// PostClient resolves post authors with PostService.GetPost, which applies
+// the same visibility rules as for any other caller.
+type PostClient struct {
+	client pb.PostServiceClient
+}
+
+func NewPostClient(client pb.PostServiceClient) *PostClient {
+	return &PostClient{client: client}
+}
+
+func (c *PostClient) Author(ctx context.Context, postID, viewerID string) (string, error) {
+	post, err := c.client.GetPost(ctx, &pb.GetPostRequest{PostId: postID, UserId: viewerID})
+	if status.Code(err) == codes.NotFound {
+		return "", ErrPostNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return post.UserId, nil
+}
@@ -0,0 +1,62 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/nanoservices/pkg/logging"
+)
+
+// UsersClient looks users up with the internal batch profile endpoint of
+// users_service, authenticated with the service token users_service shares
+// with the other services rather than a user token.
+type UsersClient struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+func NewUsersClient(baseURL, token string, httpClient *http.Client) *UsersClient {
+	return &UsersClient{baseURL: strings.TrimRight(baseURL, "/"), token: token, http: httpClient}
+}
+
+// UserIDs returns the IDs of the existing users among usernames.
+func (c *UsersClient) UserIDs(ctx context.Context, usernames []string) (map[string]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		c.baseURL+"/internal/profiles?usernames="+url.QueryEscape(strings.Join(usernames, ",")), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set(logging.RequestIDHeader, logging.RequestID(ctx))
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("users_service returned %s", resp.Status)
+	}
+
+	var body struct {
+		Profiles []struct {
+			UserID   string `json:"user_id"`
+			Username string `json:"username"`
+		} `json:"profiles"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decode profiles: %w", err)
+	}
+
+	ids := make(map[string]string, len(body.Profiles))
+	for _, p := range body.Profiles {
+		ids[p.Username] = p.UserID
+	}
+	return ids, nil
+}
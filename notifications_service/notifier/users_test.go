@@ -0,0 +1,33 @@
+package notifier
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsersClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, "/internal/profiles", r.URL.Path)
+		assert.Equal(t, "alice,nobody", r.URL.Query().Get("usernames"))
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"profiles": [{"user_id": "` + alice + `", "username": "alice", "bio": "hi"}]}`))
+	}))
+	defer srv.Close()
+
+	ids, err := NewUsersClient(srv.URL+"/", "secret", srv.Client()).UserIDs(context.Background(), []string{"alice", "nobody"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"alice": alice}, ids)
+
+	_, err = NewUsersClient(srv.URL, "wrong", srv.Client()).UserIDs(context.Background(), []string{"alice"})
+	assert.ErrorContains(t, err, "401 Unauthorized")
+}
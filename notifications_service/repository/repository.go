@@ -0,0 +1,195 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type DB interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// Notification is a group of events of one type on one post. Events keep
+// being folded into it until the recipient reads it.
+type Notification struct {
+	ID         string
+	Type       string
+	PostID     string
+	ActorCount int
+	// ActorIDs holds up to three actors, the latest first.
+	ActorIDs  []string
+	Read      bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Position is the place of the last notification of a page.
+type Position struct {
+	UpdatedAt time.Time
+	ID        string
+}
+
+type Repository struct {
+	db DB
+}
+
+func NewRepository(db DB) *Repository {
+	return &Repository{db: db}
+}
+
+// AddActor folds an event of actorID into the unread notification of the
+// recipient for the post and type, creating it if there is none. Nothing is
+// stored if the recipient muted the type. Adding the same actor twice only
+// moves the notification up.
+func (r *Repository) AddActor(ctx context.Context, recipientID, typ, postID, actorID string, at time.Time) error {
+	query := `
+		WITH notification AS (
+			INSERT INTO notifications (recipient_id, type, post_id, created_at, updated_at)
+			SELECT $1, $2, $3, $5, $5
+			WHERE NOT EXISTS (SELECT 1 FROM notification_mutes WHERE user_id = $1 AND type = $2)
+			ON CONFLICT (recipient_id, type, post_id) WHERE read_at IS NULL
+			DO UPDATE SET updated_at = GREATEST(notifications.updated_at, EXCLUDED.updated_at)
+			RETURNING id
+		)
+		INSERT INTO notification_actors (notification_id, actor_id, created_at)
+		SELECT id, $4, $5 FROM notification
+		ON CONFLICT (notification_id, actor_id) DO UPDATE SET created_at = EXCLUDED.created_at`
+	_, err := r.db.Exec(ctx, query, recipientID, typ, postID, actorID, at)
+	return err
+}
+
+// RemoveActor takes an event of actorID back out of the unread notification,
+// e.g. after an unlike. The notification is deleted with its last actor.
+// Notifications that were read are left as they are.
+func (r *Repository) RemoveActor(ctx context.Context, recipientID, typ, postID, actorID string) error {
+	query := `
+		WITH target AS (
+			SELECT id FROM notifications
+			WHERE recipient_id = $1 AND type = $2 AND post_id = $3 AND read_at IS NULL
+		), removed AS (
+			DELETE FROM notification_actors
+			WHERE notification_id = (SELECT id FROM target) AND actor_id = $4
+			RETURNING notification_id
+		)
+		DELETE FROM notifications
+		WHERE id IN (SELECT notification_id FROM removed)
+		  AND NOT EXISTS (
+			SELECT 1 FROM notification_actors
+			WHERE notification_id = notifications.id AND actor_id <> $4
+		  )`
+	_, err := r.db.Exec(ctx, query, recipientID, typ, postID, actorID)
+	return err
+}
+
+// List returns the notifications of userID, most recently updated first.
+func (r *Repository) List(ctx context.Context, userID string, limit int, after *Position, unreadOnly bool) ([]Notification, error) {
+	var updatedAt *time.Time
+	var id *string
+	if after != nil {
+		updatedAt, id = &after.UpdatedAt, &after.ID
+	}
+	query := `
+		SELECT n.id, n.type, n.post_id, n.read_at IS NOT NULL, n.created_at, n.updated_at,
+		       (SELECT COUNT(*) FROM notification_actors WHERE notification_id = n.id),
+		       ARRAY(
+			       SELECT actor_id::text FROM notification_actors WHERE notification_id = n.id
+			       ORDER BY created_at DESC, actor_id LIMIT 3
+		       )
+		FROM notifications AS n
+		WHERE n.recipient_id = $1
+		  AND (NOT $2 OR n.read_at IS NULL)
+		  AND ($3::timestamptz IS NULL OR (n.updated_at, n.id) < ($3, $4::uuid))
+		ORDER BY n.updated_at DESC, n.id DESC
+		LIMIT $5`
+	rows, err := r.db.Query(ctx, query, userID, unreadOnly, updatedAt, id, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []Notification
+	for rows.Next() {
+		var n Notification
+		if err := rows.Scan(&n.ID, &n.Type, &n.PostID, &n.Read, &n.CreatedAt, &n.UpdatedAt, &n.ActorCount, &n.ActorIDs); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+func (r *Repository) UnreadCount(ctx context.Context, userID string) (int, error) {
+	var count int
+	err := r.db.QueryRow(ctx,
+		"SELECT COUNT(*) FROM notifications WHERE recipient_id = $1 AND read_at IS NULL", userID,
+	).Scan(&count)
+	return count, err
+}
+
+// MarkRead marks the notifications ids of userID as read, or all of them
+// when ids is empty, and returns how many were unread.
+func (r *Repository) MarkRead(ctx context.Context, userID string, ids []string) (int, error) {
+	query := `
+		UPDATE notifications SET read_at = NOW()
+		WHERE recipient_id = $1 AND read_at IS NULL
+		  AND (COALESCE(cardinality($2::uuid[]), 0) = 0 OR id = ANY($2::uuid[]))`
+	tag, err := r.db.Exec(ctx, query, userID, ids)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+func (r *Repository) MutedTypes(ctx context.Context, userID string) ([]string, error) {
+	rows, err := r.db.Query(ctx, "SELECT type FROM notification_mutes WHERE user_id = $1 ORDER BY type", userID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+// SetMutedTypes replaces the muted types of userID.
+func (r *Repository) SetMutedTypes(ctx context.Context, userID string, types []string) error {
+	query := `
+		WITH unmuted AS (
+			DELETE FROM notification_mutes WHERE user_id = $1 AND NOT type = ANY(COALESCE($2::text[], '{}'))
+		)
+		INSERT INTO notification_mutes (user_id, type)
+		SELECT $1, unnest($2::text[])
+		ON CONFLICT DO NOTHING`
+	_, err := r.db.Exec(ctx, query, userID, types)
+	return err
+}
+
+// SaveUser records the username of a registered user, mentions are resolved
+// with it.
+func (r *Repository) SaveUser(ctx context.Context, userID, username string) error {
+	_, err := r.db.Exec(ctx,
+		"INSERT INTO users (id, username) VALUES ($1, $2) ON CONFLICT (id) DO UPDATE SET username = EXCLUDED.username",
+		userID, username)
+	return err
+}
+
+// UserIDs maps the known usernames to user IDs, unknown ones are left out.
+func (r *Repository) UserIDs(ctx context.Context, usernames []string) (map[string]string, error) {
+	rows, err := r.db.Query(ctx, "SELECT username, id::text FROM users WHERE username = ANY($1::text[])", usernames)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make(map[string]string, len(usernames))
+	for rows.Next() {
+		var username, id string
+		if err := rows.Scan(&username, &id); err != nil {
+			return nil, err
+		}
+		ids[username] = id
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,172 @@
+// Package server implements NotificationService on top of the repository.
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	pb "github.com/nanoservices/notifications_service/generated"
+	"github.com/nanoservices/notifications_service/notifier"
+	"github.com/nanoservices/notifications_service/repository"
+	"github.com/nanoservices/pkg/logging"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultLimit = 10
+	maxLimit     = 100
+)
+
+type Store interface {
+	List(ctx context.Context, userID string, limit int, after *repository.Position, unreadOnly bool) ([]repository.Notification, error)
+	UnreadCount(ctx context.Context, userID string) (int, error)
+	MarkRead(ctx context.Context, userID string, ids []string) (int, error)
+	MutedTypes(ctx context.Context, userID string) ([]string, error)
+	SetMutedTypes(ctx context.Context, userID string, types []string) error
+}
+
+type Server struct {
+	pb.UnimplementedNotificationServiceServer
+	store Store
+}
+
+func New(store Store) *Server {
+	return &Server{store: store}
+}
+
+func (s *Server) ListNotifications(ctx context.Context, req *pb.ListNotificationsRequest) (*pb.ListNotificationsResponse, error) {
+	limit := int(req.Limit)
+	if limit < 1 || limit > maxLimit {
+		limit = defaultLimit
+	}
+	var after *repository.Position
+	if req.Cursor != "" {
+		position, err := decodeCursor(req.Cursor)
+		if err != nil {
+			return nil, invalidArgument("cursor", "invalid cursor")
+		}
+		after = &position
+	}
+
+	// One extra notification tells whether another page exists.
+	notifications, err := s.store.List(ctx, req.UserId, limit+1, after, req.UnreadOnly)
+	if err != nil {
+		return nil, internal(ctx, "list notifications", err)
+	}
+	resp := &pb.ListNotificationsResponse{}
+	if len(notifications) > limit {
+		notifications = notifications[:limit]
+		last := notifications[limit-1]
+		resp.NextCursor = encodeCursor(repository.Position{UpdatedAt: last.UpdatedAt, ID: last.ID})
+	}
+	for _, n := range notifications {
+		resp.Notifications = append(resp.Notifications, &pb.Notification{
+			Id:         n.ID,
+			Type:       n.Type,
+			PostId:     n.PostID,
+			ActorCount: int32(n.ActorCount),
+			ActorIds:   n.ActorIDs,
+			Read:       n.Read,
+			CreatedAt:  n.CreatedAt.UTC().Format(time.RFC3339),
+			UpdatedAt:  n.UpdatedAt.UTC().Format(time.RFC3339),
+		})
+	}
+	return resp, nil
+}
+
+func (s *Server) GetUnreadCount(ctx context.Context, req *pb.UnreadCountRequest) (*pb.UnreadCountResponse, error) {
+	count, err := s.store.UnreadCount(ctx, req.UserId)
+	if err != nil {
+		return nil, internal(ctx, "count unread notifications", err)
+	}
+	return &pb.UnreadCountResponse{Unread: int32(count)}, nil
+}
+
+func (s *Server) MarkRead(ctx context.Context, req *pb.MarkReadRequest) (*pb.MarkReadResponse, error) {
+	for _, id := range req.Ids {
+		if err := uuid.Validate(id); err != nil {
+			return nil, invalidArgument("ids", "ids must be UUIDs")
+		}
+	}
+	marked, err := s.store.MarkRead(ctx, req.UserId, req.Ids)
+	if err != nil {
+		return nil, internal(ctx, "mark notifications read", err)
+	}
+	return &pb.MarkReadResponse{Marked: int32(marked)}, nil
+}
+
+func (s *Server) GetSettings(ctx context.Context, req *pb.GetSettingsRequest) (*pb.NotificationSettings, error) {
+	muted, err := s.store.MutedTypes(ctx, req.UserId)
+	if err != nil {
+		return nil, internal(ctx, "get muted types", err)
+	}
+	return &pb.NotificationSettings{MutedTypes: muted}, nil
+}
+
+func (s *Server) UpdateSettings(ctx context.Context, req *pb.UpdateSettingsRequest) (*pb.NotificationSettings, error) {
+	muted := []string{}
+	for _, t := range req.MutedTypes {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if !slices.Contains(notifier.Types, t) {
+			return nil, invalidArgument("muted_types", "muted_types must be any of "+strings.Join(notifier.Types, ", "))
+		}
+		if !slices.Contains(muted, t) {
+			muted = append(muted, t)
+		}
+	}
+	if err := s.store.SetMutedTypes(ctx, req.UserId, muted); err != nil {
+		return nil, internal(ctx, "set muted types", err)
+	}
+	slices.Sort(muted)
+	return &pb.NotificationSettings{MutedTypes: muted}, nil
+}
+
+// Cursors only ever select notifications of the caller, so unlike the post
+// cursors they are not signed.
+func encodeCursor(p repository.Position) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(p.UpdatedAt.UnixMicro(), 10) + ":" + p.ID))
+}
+
+func decodeCursor(cursor string) (repository.Position, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return repository.Position{}, err
+	}
+	micros, id, ok := strings.Cut(string(data), ":")
+	if !ok {
+		return repository.Position{}, errors.New("missing separator")
+	}
+	us, err := strconv.ParseInt(micros, 10, 64)
+	if err != nil {
+		return repository.Position{}, err
+	}
+	if err := uuid.Validate(id); err != nil {
+		return repository.Position{}, err
+	}
+	return repository.Position{UpdatedAt: time.UnixMicro(us).UTC(), ID: id}, nil
+}
+
+// invalidArgument returns INVALID_ARGUMENT with the violation as
+// google.rpc.BadRequest details, as the other services do.
+func invalidArgument(field, description string) error {
+	st := status.New(codes.InvalidArgument, description)
+	if detailed, err := st.WithDetails(&errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: field, Description: description}},
+	}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+func internal(ctx context.Context, action string, err error) error {
+	logging.For("grpc").ErrorContext(ctx, "Failed to "+action, "error", err)
+	return status.Error(codes.Internal, "failed to "+action)
+}
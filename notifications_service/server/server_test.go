@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "github.com/nanoservices/notifications_service/generated"
+	"github.com/nanoservices/notifications_service/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type fakeStore struct {
+	notifications []repository.Notification
+	limit         int
+	after         *repository.Position
+	marked        []string
+	muted         []string
+}
+
+func (s *fakeStore) List(_ context.Context, _ string, limit int, after *repository.Position, _ bool) ([]repository.Notification, error) {
+	s.limit, s.after = limit, after
+	if len(s.notifications) > limit {
+		return s.notifications[:limit], nil
+	}
+	return s.notifications, nil
+}
+
+func (s *fakeStore) UnreadCount(context.Context, string) (int, error) {
+	return len(s.notifications), nil
+}
+
+func (s *fakeStore) MarkRead(_ context.Context, _ string, ids []string) (int, error) {
+	s.marked = ids
+	return len(ids), nil
+}
+
+func (s *fakeStore) MutedTypes(context.Context, string) ([]string, error) {
+	return s.muted, nil
+}
+
+func (s *fakeStore) SetMutedTypes(_ context.Context, _ string, types []string) error {
+	s.muted = types
+	return nil
+}
+
+func notifications(count int) []repository.Notification {
+	base := time.Date(2026, 3, 1, 12, 0, 0, 123456000, time.UTC)
+	out := make([]repository.Notification, count)
+	for i := range out {
+		out[i] = repository.Notification{
+			ID:         []string{"0b8c8a43-5f6e-4c0e-9d6b-1f2a3b4c5d6e", "1c9d9b54-6a7f-4d1f-8e7c-2a3b4c5d6e7f", "2dae0c65-7b80-4e20-9f8d-3b4c5d6e7f80"}[i],
+			Type:       "like",
+			ActorCount: 12,
+			UpdatedAt:  base.Add(-time.Duration(i) * time.Minute),
+		}
+	}
+	return out
+}
+
+func TestListNotificationsPages(t *testing.T) {
+	store := &fakeStore{notifications: notifications(3)}
+	s := New(store)
+
+	first, err := s.ListNotifications(context.Background(), &pb.ListNotificationsRequest{UserId: "u1", Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, 3, store.limit)
+	require.Len(t, first.Notifications, 2)
+	assert.EqualValues(t, 12, first.Notifications[0].ActorCount)
+	require.NotEmpty(t, first.NextCursor)
+
+	_, err = s.ListNotifications(context.Background(), &pb.ListNotificationsRequest{UserId: "u1", Limit: 2, Cursor: first.NextCursor})
+	require.NoError(t, err)
+	assert.Equal(t, &repository.Position{UpdatedAt: store.notifications[1].UpdatedAt, ID: store.notifications[1].ID}, store.after)
+}
+
+func TestListNotificationsLastPage(t *testing.T) {
+	s := New(&fakeStore{notifications: notifications(2)})
+
+	resp, err := s.ListNotifications(context.Background(), &pb.ListNotificationsRequest{UserId: "u1"})
+
+	require.NoError(t, err)
+	assert.Len(t, resp.Notifications, 2)
+	assert.Empty(t, resp.NextCursor)
+}
+
+func TestListNotificationsInvalidCursor(t *testing.T) {
+	s := New(&fakeStore{})
+
+	_, err := s.ListNotifications(context.Background(), &pb.ListNotificationsRequest{UserId: "u1", Cursor: "forged"})
+
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestMarkReadRejectsInvalidIDs(t *testing.T) {
+	store := &fakeStore{}
+	s := New(store)
+
+	_, err := s.MarkRead(context.Background(), &pb.MarkReadRequest{UserId: "u1", Ids: []string{"1"}})
+
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Nil(t, store.marked)
+}
+
+func TestUpdateSettings(t *testing.T) {
+	store := &fakeStore{}
+	s := New(store)
+
+	resp, err := s.UpdateSettings(context.Background(), &pb.UpdateSettingsRequest{UserId: "u1", MutedTypes: []string{"Mention", "like", "mention"}})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"like", "mention"}, resp.MutedTypes)
+	assert.ElementsMatch(t, []string{"mention", "like"}, store.muted)
+}
+
+func TestUpdateSettingsUnknownType(t *testing.T) {
+	s := New(&fakeStore{})
+
+	_, err := s.UpdateSettings(context.Background(), &pb.UpdateSettingsRequest{UserId: "u1", MutedTypes: []string{"view"}})
+
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -0,0 +1,108 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type Check func(ctx context.Context) error
+
+type CheckResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Latency  string `json:"latency"`
+	Optional bool   `json:"optional,omitempty"`
+}
+
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Checker serves liveness and readiness probes. Readiness runs every
+// registered dependency check and turns false once Shutdown is called.
+// Optional dependencies that are down only make the report degraded.
+type Checker struct {
+	timeout      time.Duration
+	names        []string
+	checks       map[string]Check
+	optional     map[string]bool
+	shuttingDown atomic.Bool
+}
+
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout, checks: make(map[string]Check), optional: make(map[string]bool)}
+}
+
+func (h *Checker) Add(name string, check Check) {
+	h.names = append(h.names, name)
+	h.checks[name] = check
+}
+
+// AddOptional registers a dependency the service can serve requests without.
+func (h *Checker) AddOptional(name string, check Check) {
+	h.Add(name, check)
+	h.optional[name] = true
+}
+
+func (h *Checker) Shutdown() {
+	h.shuttingDown.Store(true)
+}
+
+func (h *Checker) Liveness(c echo.Context) error {
+	return c.JSON(http.StatusOK, Report{Status: "ok"})
+}
+
+func (h *Checker) Readiness(c echo.Context) error {
+	report := h.Check(c.Request().Context())
+	if report.Status != "ready" && report.Status != "degraded" {
+		return c.JSON(http.StatusServiceUnavailable, report)
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+func (h *Checker) Check(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	report := Report{Status: "ready", Checks: make(map[string]CheckResult, len(h.names))}
+	if h.shuttingDown.Load() {
+		report.Status = "shutting_down"
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, name := range h.names {
+		wg.Add(1)
+		go func(name string, check Check, optional bool) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := check(ctx)
+			result := CheckResult{Status: "up", Latency: time.Since(start).String(), Optional: optional}
+			if err != nil {
+				result.Status = "down"
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = result
+			switch {
+			case err == nil:
+			case !optional && (report.Status == "ready" || report.Status == "degraded"):
+				report.Status = "not_ready"
+			case optional && report.Status == "ready":
+				report.Status = "degraded"
+			}
+		}(name, h.checks[name], h.optional[name])
+	}
+	wg.Wait()
+
+	return report
+}
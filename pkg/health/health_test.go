@@ -0,0 +1,110 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func readiness(t *testing.T, checker *Checker) (int, Report) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+	rec := httptest.NewRecorder()
+
+	_ = checker.Readiness(e.NewContext(req, rec))
+
+	var report Report
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	return rec.Code, report
+}
+
+func TestReadiness(t *testing.T) {
+	t.Run("All dependencies up", func(t *testing.T) {
+		checker := NewChecker(time.Second)
+		checker.Add("postgres", func(ctx context.Context) error { return nil })
+
+		code, report := readiness(t, checker)
+
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "ready", report.Status)
+		assert.Equal(t, "up", report.Checks["postgres"].Status)
+	})
+
+	t.Run("Dependency down", func(t *testing.T) {
+		checker := NewChecker(time.Second)
+		checker.Add("postgres", func(ctx context.Context) error { return errors.New("connection refused") })
+
+		code, report := readiness(t, checker)
+
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, "not_ready", report.Status)
+		assert.Equal(t, "down", report.Checks["postgres"].Status)
+		assert.Equal(t, "connection refused", report.Checks["postgres"].Error)
+	})
+
+	t.Run("Optional dependency down", func(t *testing.T) {
+		checker := NewChecker(time.Second)
+		checker.Add("postgres", func(ctx context.Context) error { return nil })
+		checker.AddOptional("notifications_service", func(ctx context.Context) error { return errors.New("connection refused") })
+
+		code, report := readiness(t, checker)
+
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "degraded", report.Status)
+		assert.Equal(t, "down", report.Checks["notifications_service"].Status)
+		assert.True(t, report.Checks["notifications_service"].Optional)
+	})
+
+	t.Run("Required and optional dependencies down", func(t *testing.T) {
+		checker := NewChecker(time.Second)
+		checker.Add("postgres", func(ctx context.Context) error { return errors.New("connection refused") })
+		checker.AddOptional("notifications_service", func(ctx context.Context) error { return errors.New("connection refused") })
+
+		code, report := readiness(t, checker)
+
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, "not_ready", report.Status)
+	})
+
+	t.Run("Check times out", func(t *testing.T) {
+		checker := NewChecker(10 * time.Millisecond)
+		checker.Add("postgres", func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+
+		code, report := readiness(t, checker)
+
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, "down", report.Checks["postgres"].Status)
+	})
+
+	t.Run("Not ready during shutdown", func(t *testing.T) {
+		checker := NewChecker(time.Second)
+		checker.Add("postgres", func(ctx context.Context) error { return nil })
+		checker.Shutdown()
+
+		code, report := readiness(t, checker)
+
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, "shutting_down", report.Status)
+	})
+}
+
+func TestLiveness(t *testing.T) {
+	checker := NewChecker(time.Second)
+	checker.Add("postgres", func(ctx context.Context) error { return errors.New("down") })
+	e := echo.New()
+	rec := httptest.NewRecorder()
+
+	_ = checker.Liveness(e.NewContext(httptest.NewRequest(http.MethodGet, "/healthz", nil), rec))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
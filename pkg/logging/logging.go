@@ -0,0 +1,115 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+type ctxKey struct{}
+
+var (
+	mu           sync.RWMutex
+	base         slog.Handler = slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})
+	defaultLevel              = slog.LevelInfo
+	levels                    = map[string]slog.Level{}
+)
+
+// Setup installs a JSON logger for service. spec is a comma separated list
+// of levels: a bare level sets the default and component=level overrides it
+// for a single component, e.g. "info,kafka=debug,http=warn".
+func Setup(service, spec string) error {
+	def, overrides, err := parseLevels(spec)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	base = slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}).
+		WithAttrs([]slog.Attr{slog.String("service", service)})
+	defaultLevel = def
+	levels = overrides
+	mu.Unlock()
+
+	slog.SetDefault(For("main"))
+	return nil
+}
+
+// For returns the logger of a component. Records logged with a context that
+// carries a request ID get a request_id attribute.
+func For(component string) *slog.Logger {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	level, ok := levels[component]
+	if !ok {
+		level = defaultLevel
+	}
+	return slog.New(&handler{
+		next:  base.WithAttrs([]slog.Attr{slog.String("component", component)}),
+		level: level,
+	})
+}
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+func parseLevels(spec string) (slog.Level, map[string]slog.Level, error) {
+	def := slog.LevelInfo
+	overrides := map[string]slog.Level{}
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		component, value, scoped := strings.Cut(part, "=")
+		if !scoped {
+			value = component
+		}
+
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(value)); err != nil {
+			return 0, nil, err
+		}
+		if scoped {
+			overrides[strings.TrimSpace(component)] = level
+		} else {
+			def = level
+		}
+	}
+	return def, overrides, nil
+}
+
+type handler struct {
+	next  slog.Handler
+	level slog.Level
+}
+
+func (h *handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level && h.next.Enabled(ctx, level)
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &handler{next: h.next.WithAttrs(attrs), level: h.level}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return &handler{next: h.next.WithGroup(name), level: h.level}
+}
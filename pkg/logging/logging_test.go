@@ -0,0 +1,49 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLevels(t *testing.T) {
+	t.Run("Default and component levels", func(t *testing.T) {
+		def, overrides, err := parseLevels("warn, handlers=debug,http=error")
+
+		assert.NoError(t, err)
+		assert.Equal(t, slog.LevelWarn, def)
+		assert.Equal(t, map[string]slog.Level{"handlers": slog.LevelDebug, "http": slog.LevelError}, overrides)
+	})
+
+	t.Run("Empty spec", func(t *testing.T) {
+		def, overrides, err := parseLevels("")
+
+		assert.NoError(t, err)
+		assert.Equal(t, slog.LevelInfo, def)
+		assert.Empty(t, overrides)
+	})
+
+	t.Run("Unknown level", func(t *testing.T) {
+		_, _, err := parseLevels("handlers=loud")
+
+		assert.Error(t, err)
+	})
+}
+
+func TestComponentLevel(t *testing.T) {
+	assert.NoError(t, Setup("notifications_service", "warn,handlers=debug"))
+	ctx := context.Background()
+
+	assert.True(t, For("handlers").Enabled(ctx, slog.LevelDebug))
+	assert.False(t, For("http").Enabled(ctx, slog.LevelInfo))
+	assert.True(t, For("http").Enabled(ctx, slog.LevelWarn))
+}
+
+func TestRequestID(t *testing.T) {
+	ctx := WithRequestID(context.Background(), "req-123")
+
+	assert.Equal(t, "req-123", RequestID(ctx))
+	assert.Empty(t, RequestID(context.Background()))
+}
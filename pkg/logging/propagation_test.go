@@ -0,0 +1,30 @@
+package logging
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestRequestIDPropagation(t *testing.T) {
+	var outgoing metadata.MD
+	invoker := func(ctx context.Context, _ string, _, _ any, _ *grpc.ClientConn, _ ...grpc.CallOption) error {
+		outgoing, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	}
+	ctx := WithRequestID(context.Background(), "req-123")
+	assert.NoError(t, UnaryClientInterceptor()(ctx, "/PostService/GetPost", nil, nil, nil, invoker))
+	assert.Equal(t, []string{"req-123"}, outgoing.Get("x-request-id"))
+
+	var got string
+	handler := func(ctx context.Context, _ any) (any, error) {
+		got = RequestID(ctx)
+		return nil, nil
+	}
+	_, err := UnaryServerInterceptor()(metadata.NewIncomingContext(context.Background(), outgoing), nil, nil, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, "req-123", got)
+}
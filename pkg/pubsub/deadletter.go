@@ -0,0 +1,117 @@
+package pubsub
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Events a consumer gives up on are published to the dead-letter topic of
+// their source topic, with the original key, value and headers and the
+// dlq.* headers describing the failure.
+const (
+	DeadLetterSuffix = ".dlq"
+
+	HeaderError             = "dlq.error"
+	HeaderAttempts          = "dlq.attempts"
+	HeaderOriginalTopic     = "dlq.original_topic"
+	HeaderOriginalPartition = "dlq.original_partition"
+	HeaderOriginalOffset    = "dlq.original_offset"
+	HeaderFailedAt          = "dlq.failed_at"
+	HeaderConsumer          = "dlq.consumer"
+
+	deadLetterPrefix = "dlq."
+)
+
+// DeadLetterTopic returns the dead-letter topic of topic.
+func DeadLetterTopic(topic string) string {
+	if strings.HasSuffix(topic, DeadLetterSuffix) {
+		return topic
+	}
+	return topic + DeadLetterSuffix
+}
+
+// Failure describes why a consumer gave up on a message.
+type Failure struct {
+	Err      string
+	Attempts int
+	Consumer string
+	At       time.Time
+}
+
+// DeadLetter is a message read from a dead-letter topic.
+type DeadLetter struct {
+	Failure
+	OriginalTopic     string
+	OriginalPartition int
+	OriginalOffset    int64
+}
+
+// NewDeadLetter returns the dead-letter message for msg consumed from its
+// source topic.
+func NewDeadLetter(msg Message, f Failure) Message {
+	headers := withoutDeadLetterHeaders(msg.Headers)
+	headers = append(headers,
+		Header{Key: HeaderError, Value: []byte(f.Err)},
+		Header{Key: HeaderAttempts, Value: []byte(strconv.Itoa(f.Attempts))},
+		Header{Key: HeaderOriginalTopic, Value: []byte(msg.Topic)},
+		Header{Key: HeaderOriginalPartition, Value: []byte(strconv.Itoa(msg.Partition))},
+		Header{Key: HeaderOriginalOffset, Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+		Header{Key: HeaderFailedAt, Value: []byte(f.At.UTC().Format(time.RFC3339))},
+		Header{Key: HeaderConsumer, Value: []byte(f.Consumer)},
+	)
+	return Message{Topic: DeadLetterTopic(msg.Topic), Key: msg.Key, Value: msg.Value, Headers: headers}
+}
+
+// ParseDeadLetter reads the failure headers of a dead-letter message.
+func ParseDeadLetter(msg Message) (DeadLetter, error) {
+	d := DeadLetter{
+		Failure:       Failure{Err: msg.Header(HeaderError), Consumer: msg.Header(HeaderConsumer)},
+		OriginalTopic: msg.Header(HeaderOriginalTopic),
+	}
+	if d.OriginalTopic == "" {
+		return d, errors.New("missing " + HeaderOriginalTopic + " header")
+	}
+
+	var err error
+	if d.Attempts, err = strconv.Atoi(msg.Header(HeaderAttempts)); err != nil {
+		return d, fmt.Errorf("invalid %s header: %w", HeaderAttempts, err)
+	}
+	if d.OriginalPartition, err = strconv.Atoi(msg.Header(HeaderOriginalPartition)); err != nil {
+		return d, fmt.Errorf("invalid %s header: %w", HeaderOriginalPartition, err)
+	}
+	if d.OriginalOffset, err = strconv.ParseInt(msg.Header(HeaderOriginalOffset), 10, 64); err != nil {
+		return d, fmt.Errorf("invalid %s header: %w", HeaderOriginalOffset, err)
+	}
+	if d.At, err = time.Parse(time.RFC3339, msg.Header(HeaderFailedAt)); err != nil {
+		return d, fmt.Errorf("invalid %s header: %w", HeaderFailedAt, err)
+	}
+	return d, nil
+}
+
+// Replay returns the message to publish to the source topic of a
+// dead-letter message: the original key, value and headers.
+func Replay(msg Message) (Message, error) {
+	d, err := ParseDeadLetter(msg)
+	if err != nil {
+		return Message{}, err
+	}
+	return Message{
+		Topic:   d.OriginalTopic,
+		Key:     msg.Key,
+		Value:   msg.Value,
+		Headers: withoutDeadLetterHeaders(msg.Headers),
+	}, nil
+}
+
+func withoutDeadLetterHeaders(headers []Header) []Header {
+	out := make([]Header, 0, len(headers)+7)
+	for _, h := range headers {
+		if !strings.HasPrefix(h.Key, deadLetterPrefix) {
+			out = append(out, h)
+		}
+	}
+	return out
+}
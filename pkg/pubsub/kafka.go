@@ -0,0 +1,157 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nanoservices/pkg/logging"
+	"github.com/segmentio/kafka-go"
+)
+
+type KafkaConfig struct {
+	Brokers []string
+	// RequiredAcks is all (the default), one or none.
+	RequiredAcks string
+	// BatchSize and BatchTimeout bound how long the writer waits to fill a
+	// batch, kafka-go waits up to a second by default.
+	BatchSize    int
+	BatchTimeout time.Duration
+}
+
+// ParseAcks converts the RequiredAcks setting.
+func ParseAcks(s string) (kafka.RequiredAcks, error) {
+	switch strings.ToLower(s) {
+	case "", "all":
+		return kafka.RequireAll, nil
+	case "one", "1":
+		return kafka.RequireOne, nil
+	case "none", "0":
+		return kafka.RequireNone, nil
+	}
+	return 0, fmt.Errorf("unknown required acks %q, expected all, one or none", s)
+}
+
+// KafkaPublisher sends messages to the topic set on each message. Keys are
+// hashed to partitions, so messages with the same key keep their order.
+type KafkaPublisher struct {
+	w *kafka.Writer
+}
+
+func NewKafkaPublisher(cfg KafkaConfig) (*KafkaPublisher, error) {
+	acks, err := ParseAcks(cfg.RequiredAcks)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.BatchTimeout <= 0 {
+		cfg.BatchTimeout = 10 * time.Millisecond
+	}
+	return &KafkaPublisher{w: &kafka.Writer{
+		Addr:                   kafka.TCP(cfg.Brokers...),
+		Balancer:               &kafka.Hash{},
+		RequiredAcks:           acks,
+		BatchSize:              cfg.BatchSize,
+		BatchTimeout:           cfg.BatchTimeout,
+		AllowAutoTopicCreation: true,
+	}}, nil
+}
+
+func (p *KafkaPublisher) Publish(ctx context.Context, msgs ...Message) error {
+	out := make([]kafka.Message, len(msgs))
+	for i, m := range msgs {
+		out[i] = kafka.Message{Topic: m.Topic, Key: m.Key, Value: m.Value, Headers: toKafkaHeaders(m.Headers)}
+	}
+	return p.w.WriteMessages(ctx, out...)
+}
+
+func (p *KafkaPublisher) Close() error {
+	return p.w.Close()
+}
+
+type KafkaSubscriberConfig struct {
+	Brokers []string
+	GroupID string
+	// FromLatest starts a new consumer group at the newest offset instead
+	// of the oldest one.
+	FromLatest bool
+}
+
+// KafkaSubscriber reads topics in a consumer group. Offsets are committed
+// after the handler returns.
+type KafkaSubscriber struct {
+	cfg KafkaSubscriberConfig
+}
+
+func NewKafkaSubscriber(cfg KafkaSubscriberConfig) *KafkaSubscriber {
+	return &KafkaSubscriber{cfg: cfg}
+}
+
+func (s *KafkaSubscriber) Subscribe(ctx context.Context, topics []string, handler Handler) error {
+	start := kafka.FirstOffset
+	if s.cfg.FromLatest {
+		start = kafka.LastOffset
+	}
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     s.cfg.Brokers,
+		GroupID:     s.cfg.GroupID,
+		GroupTopics: topics,
+		StartOffset: start,
+	})
+	defer reader.Close()
+
+	logger := logging.For("kafka")
+	for {
+		msg, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return nil
+			}
+			return err
+		}
+
+		m := Message{
+			Topic:     msg.Topic,
+			Key:       msg.Key,
+			Value:     msg.Value,
+			Headers:   fromKafkaHeaders(msg.Headers),
+			Partition: msg.Partition,
+			Offset:    msg.Offset,
+			Time:      msg.Time,
+		}
+		if err := handler(ctx, m); err != nil {
+			logger.WarnContext(ctx, "Failed to handle message",
+				"topic", msg.Topic, "partition", msg.Partition, "offset", msg.Offset, "error", err)
+		}
+		if err := reader.CommitMessages(ctx, msg); err != nil {
+			if errors.Is(err, context.Canceled) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func (s *KafkaSubscriber) Close() error {
+	return nil
+}
+
+func toKafkaHeaders(headers []Header) []kafka.Header {
+	out := make([]kafka.Header, len(headers))
+	for i, h := range headers {
+		out[i] = kafka.Header{Key: h.Key, Value: h.Value}
+	}
+	return out
+}
+
+func fromKafkaHeaders(headers []kafka.Header) []Header {
+	out := make([]Header, len(headers))
+	for i, h := range headers {
+		out[i] = Header{Key: h.Key, Value: h.Value}
+	}
+	return out
+}
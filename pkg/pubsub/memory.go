@@ -0,0 +1,120 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/nanoservices/pkg/logging"
+)
+
+var ErrClosed = errors.New("broker is closed")
+
+// Memory is an in-process broker for tests. It keeps every published
+// message and delivers it to the subscribers of its topic.
+type Memory struct {
+	mu        sync.Mutex
+	published []Message
+	offsets   map[string]int64
+	subs      map[string][]chan Message
+	closed    bool
+}
+
+func NewMemory() *Memory {
+	return &Memory{offsets: make(map[string]int64), subs: make(map[string][]chan Message)}
+}
+
+func (m *Memory) Publish(ctx context.Context, msgs ...Message) error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return ErrClosed
+	}
+	var deliveries []func() error
+	for _, msg := range msgs {
+		msg.Offset = m.offsets[msg.Topic]
+		msg.Time = time.Now()
+		m.offsets[msg.Topic]++
+		m.published = append(m.published, msg)
+		for _, ch := range m.subs[msg.Topic] {
+			ch, msg := ch, msg
+			deliveries = append(deliveries, func() error {
+				select {
+				case ch <- msg:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+		}
+	}
+	m.mu.Unlock()
+
+	for _, deliver := range deliveries {
+		if err := deliver(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Published returns the messages published to topic so far.
+func (m *Memory) Published(topic string) []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []Message
+	for _, msg := range m.published {
+		if msg.Topic == topic {
+			out = append(out, msg)
+		}
+	}
+	return out
+}
+
+// Subscribe receives the messages published after it was called.
+func (m *Memory) Subscribe(ctx context.Context, topics []string, handler Handler) error {
+	ch := make(chan Message, 64)
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return ErrClosed
+	}
+	for _, topic := range topics {
+		m.subs[topic] = append(m.subs[topic], ch)
+	}
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		for _, topic := range topics {
+			subs := m.subs[topic]
+			for i, c := range subs {
+				if c == ch {
+					m.subs[topic] = append(subs[:i], subs[i+1:]...)
+					break
+				}
+			}
+		}
+		m.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg := <-ch:
+			if err := handler(ctx, msg); err != nil {
+				logging.For("pubsub").WarnContext(ctx, "Failed to handle message",
+					"topic", msg.Topic, "offset", msg.Offset, "error", err)
+			}
+		}
+	}
+}
+
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	return nil
+}
@@ -0,0 +1,105 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/nanoservices/pkg/logging"
+	"github.com/nats-io/nats.go"
+)
+
+// keyHeader carries the message key, core NATS has no keys.
+const keyHeader = "Event-Key"
+
+type NATSConfig struct {
+	URL  string
+	Name string
+	// QueueGroup makes subscribers with the same group share the messages
+	// instead of each receiving all of them.
+	QueueGroup string
+}
+
+// NATS is a lightweight broker for local development. Topics map to
+// subjects, messages are not persisted and are lost while no subscriber is
+// connected.
+type NATS struct {
+	conn  *nats.Conn
+	group string
+}
+
+func NewNATS(cfg NATSConfig) (*NATS, error) {
+	conn, err := nats.Connect(cfg.URL, nats.Name(cfg.Name), nats.MaxReconnects(-1), nats.RetryOnFailedConnect(true))
+	if err != nil {
+		return nil, fmt.Errorf("connect to NATS: %w", err)
+	}
+	return &NATS{conn: conn, group: cfg.QueueGroup}, nil
+}
+
+func (n *NATS) Publish(ctx context.Context, msgs ...Message) error {
+	for _, m := range msgs {
+		out := nats.NewMsg(m.Topic)
+		out.Data = m.Value
+		if len(m.Key) > 0 {
+			out.Header.Set(keyHeader, string(m.Key))
+		}
+		for _, h := range m.Headers {
+			out.Header.Add(h.Key, string(h.Value))
+		}
+		if err := n.conn.PublishMsg(out); err != nil {
+			return err
+		}
+	}
+	return n.conn.FlushWithContext(ctx)
+}
+
+func (n *NATS) Subscribe(ctx context.Context, topics []string, handler Handler) error {
+	ch := make(chan *nats.Msg, 256)
+	for _, topic := range topics {
+		var sub *nats.Subscription
+		var err error
+		if n.group != "" {
+			sub, err = n.conn.ChanQueueSubscribe(topic, n.group, ch)
+		} else {
+			sub, err = n.conn.ChanSubscribe(topic, ch)
+		}
+		if err != nil {
+			return err
+		}
+		defer sub.Unsubscribe()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg := <-ch:
+			m := Message{Topic: msg.Subject, Value: msg.Data}
+			for key, values := range msg.Header {
+				if key == keyHeader {
+					m.Key = []byte(msg.Header.Get(keyHeader))
+					continue
+				}
+				for _, v := range values {
+					m.Headers = append(m.Headers, Header{Key: key, Value: []byte(v)})
+				}
+			}
+			if err := handler(ctx, m); err != nil {
+				logging.For("pubsub").WarnContext(ctx, "Failed to handle message", "topic", m.Topic, "error", err)
+			}
+		}
+	}
+}
+
+// Check reports whether the connection to the server is up.
+func (n *NATS) Check(context.Context) error {
+	if status := n.conn.Status(); status != nats.CONNECTED {
+		return errors.New("connection is " + status.String())
+	}
+	return nil
+}
+
+func (n *NATS) Close() error {
+	n.conn.Close()
+	return nil
+}
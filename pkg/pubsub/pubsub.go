@@ -0,0 +1,54 @@
+// Package pubsub hides the message broker behind EventPublisher and
+// EventSubscriber so that handlers and consumers can be tested without one.
+package pubsub
+
+import (
+	"context"
+	"time"
+)
+
+type Header struct {
+	Key   string
+	Value []byte
+}
+
+type Message struct {
+	Topic   string
+	Key     []byte
+	Value   []byte
+	Headers []Header
+
+	// Partition, Offset and Time are set on consumed messages when the
+	// broker provides them.
+	Partition int
+	Offset    int64
+	Time      time.Time
+}
+
+// Header returns the value of the first header named key.
+func (m *Message) Header(key string) string {
+	for _, h := range m.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+type EventPublisher interface {
+	// Publish returns once the broker accepted every message. Messages with
+	// the same key are delivered in the order they were published.
+	Publish(ctx context.Context, msgs ...Message) error
+	Close() error
+}
+
+// Handler processes one consumed message. A returned error is logged and
+// the message is not redelivered.
+type Handler func(ctx context.Context, msg Message) error
+
+type EventSubscriber interface {
+	// Subscribe calls handler for the messages of topics until ctx is
+	// canceled, then returns nil.
+	Subscribe(ctx context.Context, topics []string, handler Handler) error
+	Close() error
+}
@@ -0,0 +1,120 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryDeliversToSubscribers(t *testing.T) {
+	m := NewMemory()
+	ctx, cancel := context.WithCancel(context.Background())
+	got := make(chan Message, 4)
+	done := make(chan error)
+	go func() {
+		done <- m.Subscribe(ctx, []string{"a"}, func(_ context.Context, msg Message) error {
+			got <- msg
+			return errors.New("ignored")
+		})
+	}()
+
+	require.Eventually(t, func() bool {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return len(m.subs["a"]) == 1
+	}, time.Second, time.Millisecond)
+
+	require.NoError(t, m.Publish(context.Background(),
+		Message{Topic: "a", Key: []byte("k"), Value: []byte("1"), Headers: []Header{{Key: "h", Value: []byte("v")}}},
+		Message{Topic: "b", Value: []byte("2")},
+		Message{Topic: "a", Value: []byte("3")},
+	))
+
+	first, second := <-got, <-got
+	assert.Equal(t, "1", string(first.Value))
+	assert.Equal(t, "k", string(first.Key))
+	assert.Equal(t, "v", first.Header("h"))
+	assert.Equal(t, int64(0), first.Offset)
+	assert.Equal(t, "3", string(second.Value))
+	assert.Equal(t, int64(1), second.Offset)
+
+	assert.Len(t, m.Published("a"), 2)
+	assert.Len(t, m.Published("b"), 1)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestMemoryClosed(t *testing.T) {
+	m := NewMemory()
+	require.NoError(t, m.Close())
+
+	assert.ErrorIs(t, m.Publish(context.Background(), Message{Topic: "a"}), ErrClosed)
+	assert.ErrorIs(t, m.Subscribe(context.Background(), []string{"a"}, nil), ErrClosed)
+}
+
+func TestParseAcks(t *testing.T) {
+	for in, want := range map[string]kafka.RequiredAcks{
+		"":     kafka.RequireAll,
+		"all":  kafka.RequireAll,
+		"One":  kafka.RequireOne,
+		"none": kafka.RequireNone,
+	} {
+		got, err := ParseAcks(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+
+	_, err := ParseAcks("two")
+	assert.ErrorContains(t, err, `unknown required acks "two"`)
+}
+
+func TestDeadLetterRoundTrip(t *testing.T) {
+	failedAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	msg := Message{
+		Topic: "post_likes", Key: []byte("p1"), Value: []byte("{}"), Partition: 2, Offset: 41,
+		Headers: []Header{{Key: "traceparent", Value: []byte("00-abc")}, {Key: HeaderError, Value: []byte("old")}},
+	}
+
+	dead := NewDeadLetter(msg, Failure{Err: "missing user_id", Attempts: 3, Consumer: "stats-service-group", At: failedAt})
+	assert.Equal(t, "post_likes.dlq", dead.Topic)
+	assert.Equal(t, "p1", string(dead.Key))
+	assert.Equal(t, "missing user_id", dead.Header(HeaderError))
+
+	d, err := ParseDeadLetter(dead)
+	require.NoError(t, err)
+	assert.Equal(t, DeadLetter{
+		Failure:           Failure{Err: "missing user_id", Attempts: 3, Consumer: "stats-service-group", At: failedAt},
+		OriginalTopic:     "post_likes",
+		OriginalPartition: 2,
+		OriginalOffset:    41,
+	}, d)
+
+	replayed, err := Replay(dead)
+	require.NoError(t, err)
+	assert.Equal(t, Message{
+		Topic: "post_likes", Key: []byte("p1"), Value: []byte("{}"),
+		Headers: []Header{{Key: "traceparent", Value: []byte("00-abc")}},
+	}, replayed)
+}
+
+func TestParseDeadLetterInvalidHeaders(t *testing.T) {
+	_, err := ParseDeadLetter(Message{Topic: "post_likes.dlq"})
+	assert.ErrorContains(t, err, "missing dlq.original_topic header")
+
+	_, err = ParseDeadLetter(Message{Headers: []Header{
+		{Key: HeaderOriginalTopic, Value: []byte("post_likes")},
+		{Key: HeaderAttempts, Value: []byte("many")},
+	}})
+	assert.ErrorContains(t, err, "invalid dlq.attempts header")
+}
+
+func TestDeadLetterTopic(t *testing.T) {
+	assert.Equal(t, "post_views.dlq", DeadLetterTopic("post_views"))
+	assert.Equal(t, "post_views.dlq", DeadLetterTopic("post_views.dlq"))
+}
@@ -0,0 +1,67 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/nanoservices/pkg/pubsub"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// HeaderCarrier adapts message headers to a TextMapCarrier so trace context
+// can travel with the message.
+type HeaderCarrier struct {
+	Headers *[]pubsub.Header
+}
+
+var _ propagation.TextMapCarrier = HeaderCarrier{}
+
+func (c HeaderCarrier) Get(key string) string {
+	for _, h := range *c.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (c HeaderCarrier) Set(key, value string) {
+	for i, h := range *c.Headers {
+		if h.Key == key {
+			(*c.Headers)[i].Value = []byte(value)
+			return
+		}
+	}
+	*c.Headers = append(*c.Headers, pubsub.Header{Key: key, Value: []byte(value)})
+}
+
+func (c HeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(*c.Headers))
+	for _, h := range *c.Headers {
+		keys = append(keys, h.Key)
+	}
+	return keys
+}
+
+// StartProducerSpan starts a producer span for msg and injects its context
+// into the message headers.
+func StartProducerSpan(ctx context.Context, msg *pubsub.Message) (context.Context, trace.Span) {
+	topic := msg.Topic
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, topic+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			semconv.MessagingDestinationName(topic),
+			semconv.MessagingOperationTypePublish,
+		),
+	)
+	otel.GetTextMapPropagator().Inject(ctx, HeaderCarrier{Headers: &msg.Headers})
+	return ctx, span
+}
+
+// Extract returns ctx enriched with the trace context carried by msg.
+func Extract(ctx context.Context, msg *pubsub.Message) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, HeaderCarrier{Headers: &msg.Headers})
+}
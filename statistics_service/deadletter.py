@@ -0,0 +1,28 @@
+"""Dead-letter convention shared with gateway/pubsub/deadletter.go: events a
+consumer gives up on go to <topic>.dlq with the original key, value and
+headers plus dlq.* headers describing the failure."""
+from datetime import datetime, timezone
+
+DLQ_SUFFIX = '.dlq'
+HEADER_PREFIX = 'dlq.'
+
+
+def dead_letter_topic(topic):
+    if topic.endswith(DLQ_SUFFIX):
+        return topic
+    return topic + DLQ_SUFFIX
+
+
+def dead_letter_headers(msg, error, attempts, consumer, failed_at=None):
+    failed_at = failed_at or datetime.now(timezone.utc)
+    headers = [(k, v) for k, v in (msg.headers or ()) if not k.startswith(HEADER_PREFIX)]
+    headers += [
+        ('dlq.error', str(error).encode()),
+        ('dlq.attempts', str(attempts).encode()),
+        ('dlq.original_topic', msg.topic.encode()),
+        ('dlq.original_partition', str(msg.partition).encode()),
+        ('dlq.original_offset', str(msg.offset).encode()),
+        ('dlq.failed_at', failed_at.astimezone(timezone.utc).strftime('%Y-%m-%dT%H:%M:%SZ').encode()),
+        ('dlq.consumer', consumer.encode()),
+    ]
+    return headers
@@ -2,6 +2,12 @@ from datetime import datetime, timedelta
 import sys
 import asyncpg
 
+def _start_date(days):
+    if days is None:
+        return None
+    return (datetime.now() - timedelta(days=days)).date()
+
+
 class PostgresManager:
     def __init__(self, pool: asyncpg.Pool):
         self.pool = pool
@@ -13,8 +19,9 @@ class PostgresManager:
                 event_type, 
                 post_id, 
                 user_id, 
-                content
-            ) VALUES ($1, $2, $3, $4, $5)
+                content,
+                reaction
+            ) VALUES ($1, $2, $3, $4, $5, $6)
         """
         
         await self.pool.execute(
@@ -23,7 +30,25 @@ class PostgresManager:
             event['event_type'],
             event['post_id'],
             event['user_id'],
-            event.get('content')
+            event.get('content'),
+            event.get('reaction')
+        )
+
+    async def remove_event(self, event: dict):
+        """Deletes the latest event of the same type, user and reaction, it
+        is what an unlike or a removed reaction takes back."""
+        query = """
+            DELETE FROM events
+            WHERE id = (
+                SELECT id FROM events
+                WHERE post_id = $1 AND user_id = $2 AND event_type = $3
+                  AND reaction IS NOT DISTINCT FROM $4
+                ORDER BY event_time DESC, id DESC
+                LIMIT 1
+            )
+        """
+        await self.pool.execute(
+            query, event['post_id'], event['user_id'], event['event_type'], event.get('reaction')
         )
 
     async def get_post_stats(self, post_id: str) -> tuple:
@@ -68,7 +93,23 @@ class PostgresManager:
             "count": row[1]
         } for row in result]
         
-    async def get_top_posts(self, metric: str) -> list:
+    async def get_reaction_trend(self, post_id: str, days: int) -> list:
+        query = """
+            SELECT
+                DATE(event_time) as date,
+                reaction,
+                COUNT(*) as count
+            FROM events
+            WHERE
+                post_id = $1 AND
+                event_type = 'reaction' AND
+                event_time >= $2
+            GROUP BY DATE(event_time), reaction
+            ORDER BY DATE(event_time), reaction
+        """
+        return await self.pool.fetch(query, post_id, _start_date(days))
+
+    async def get_top_posts(self, metric: str, days: int = None) -> list:
         metric_map = {
             0: "view",
             1: "like",
@@ -85,13 +126,15 @@ class PostgresManager:
                 COUNT(*) as count
             FROM events
             WHERE event_type = $1
+              AND ($2::date IS NULL OR event_time >= $2)
             GROUP BY post_id
             ORDER BY count DESC
             LIMIT 10
         """
         result = await self.pool.fetch(
             query, 
-            event_type
+            event_type,
+            _start_date(days)
         )
         
         return [{
@@ -99,7 +142,7 @@ class PostgresManager:
             "count": row["count"]
         } for row in result]
 
-    async def get_top_users(self, metric: str) -> list:
+    async def get_top_users(self, metric: str, days: int = None) -> list:
         metric_map = {
             0: "view",
             1: "like",
@@ -116,13 +159,15 @@ class PostgresManager:
                 COUNT(*) as count
             FROM events
             WHERE event_type = $1
+              AND ($2::date IS NULL OR event_time >= $2)
             GROUP BY user_id
             ORDER BY count DESC
             LIMIT 10
         """
         result = await self.pool.fetch(
             query, 
-            event_type
+            event_type,
+            _start_date(days)
         )
         
         return [{
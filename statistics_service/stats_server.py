@@ -2,18 +2,73 @@ import asyncio
 import os
 import json
 import logging
-from datetime import datetime
+from datetime import datetime, timezone
 import sys
 
-from aiokafka import AIOKafkaConsumer
+from aiokafka import AIOKafkaConsumer, AIOKafkaProducer
 import grpc
 from grpc import aio
 from repository import PostgresManager, create_pool
+from deadletter import dead_letter_headers, dead_letter_topic
 from generated import statistics_pb2_grpc, statistics_pb2
 
 logging.basicConfig(level=logging.INFO)
 logger = logging.getLogger("StatsService")
 
+KAFKA_BOOTSTRAP_SERVERS = os.getenv('KAFKA_BOOTSTRAP_SERVERS', 'kafka:9092')
+CONSUMER_GROUP = 'stats-service-group'
+# A failed insert is retried MAX_ATTEMPTS times before the event is
+# dead-lettered, malformed events are dead-lettered right away.
+MAX_ATTEMPTS = 3
+RETRY_DELAY = 0.5
+
+EVENT_TYPES = {
+    'post_views': 'view',
+    'post_likes': 'like',
+    'post_comments': 'comment',
+    'post_reactions': 'reaction'
+}
+
+# Events that take back an earlier event instead of being counted.
+REMOVAL_TYPES = {'post.unliked', 'reaction.removed'}
+
+def top_period_days(period):
+    """Top lists cover all events unless a period like 7d is given."""
+    if period in ('', 'all'):
+        return None
+    if not period.endswith('d') or not period[:-1].isdigit():
+        raise ValueError(f"Invalid period: {period}")
+    return int(period[:-1])
+
+def parse_event(value):
+    """Reads an interaction event, either wrapped in the shared envelope or
+    in the flat format written before it was introduced."""
+    event = json.loads(value.decode())
+    if 'type' in event and 'payload' in event:
+        event_type = event['type']
+        payload = event['payload']
+        occurred_at = event['occurred_at']
+    else:
+        event_type = None
+        payload = event
+        occurred_at = event['timestamp']
+    # datetime.fromisoformat only understands the "Z" suffix since Python 3.11.
+    if occurred_at.endswith('Z'):
+        occurred_at = occurred_at[:-1] + '+00:00'
+    event_time = datetime.fromisoformat(occurred_at)
+    # events.event_time is a TIMESTAMP without time zone in UTC.
+    if event_time.tzinfo is not None:
+        event_time = event_time.astimezone(timezone.utc).replace(tzinfo=None)
+    return {
+        'type': event_type,
+        'event_time': event_time,
+        'post_id': payload['post_id'],
+        'user_id': payload['user_id'],
+        'content': payload.get('content') or '',
+        'reaction': payload.get('reaction'),
+        'comment_id': payload.get('comment_id'),
+    }
+
 class StatsService(statistics_pb2_grpc.StatsServiceServicer):
     def __init__(self, db):
         self.db = db
@@ -39,6 +94,21 @@ class StatsService(statistics_pb2_grpc.StatsServiceServicer):
     async def GetCommentsTrend(self, request, context):
         return await self._handle_trend(request, context, 'comment')
 
+    async def GetReactionsTrend(self, request, context):
+        try:
+            days = int(request.period[:-1]) if request.period != 'all' else 365*10
+            data = await self.db.get_reaction_trend(request.post_id, days)
+            return statistics_pb2.ReactionTrendResponse(
+                data=[statistics_pb2.ReactionTrendItem(
+                    date=d['date'].isoformat(),
+                    reaction=d['reaction'],
+                    count=d['count']
+                ) for d in data]
+            )
+        except Exception as e:
+            logger.error(f"GetReactionsTrend error: {str(e)}")
+            await context.abort(grpc.StatusCode.INTERNAL, str(e))
+
     async def _handle_trend(self, request, context, metric):
         try:
             days = int(request.period[:-1]) if request.period != 'all' else 365*10
@@ -57,7 +127,7 @@ class StatsService(statistics_pb2_grpc.StatsServiceServicer):
         try:
             print('start getting top posts', file=sys.stderr)
             
-            data = await self.db.get_top_posts(request.metric)
+            data = await self.db.get_top_posts(request.metric, top_period_days(request.period))
             return statistics_pb2.TopPostsResponse(
                 posts=[statistics_pb2.PostItem(
                     post_id=item["post_id"],
@@ -78,7 +148,7 @@ class StatsService(statistics_pb2_grpc.StatsServiceServicer):
     async def GetTopUsers(self, request, context):
         try:
             
-            data = await self.db.get_top_users(request.metric)
+            data = await self.db.get_top_users(request.metric, top_period_days(request.period))
             return statistics_pb2.TopUsersResponse(
                 users=[statistics_pb2.UserItem(
                     user_id=item["user_id"],
@@ -94,46 +164,66 @@ class StatsService(statistics_pb2_grpc.StatsServiceServicer):
             context.set_details(f"Internal error: {str(e)}")
             return statistics_pb2.TopUsersResponse()
         
+async def dead_letter(producer, msg, error, attempts):
+    logger.error(f"Dead-lettering event from {msg.topic} at offset {msg.offset} "
+                 f"after {attempts} attempt(s): {error}")
+    try:
+        await producer.send_and_wait(
+            dead_letter_topic(msg.topic),
+            msg.value,
+            key=msg.key,
+            headers=dead_letter_headers(msg, error, attempts, CONSUMER_GROUP),
+        )
+    except Exception as e:
+        logger.error(f"Failed to dead-letter event from {msg.topic} at offset {msg.offset}: {str(e)}")
+
+async def handle_message(msg, db, producer):
+    try:
+        event = parse_event(msg.value)
+        event['event_type'] = EVENT_TYPES[msg.topic]
+    except Exception as e:
+        await dead_letter(producer, msg, e, 1)
+        return
+
+    # Reactions to comments are not part of the post statistics.
+    if event['comment_id']:
+        return
+    store = db.remove_event if event['type'] in REMOVAL_TYPES else db.insert_event
+    for attempt in range(1, MAX_ATTEMPTS + 1):
+        try:
+            await store(event)
+            logger.debug(f"Processed event: {event['post_id']}")
+            return
+        except Exception as e:
+            if attempt == MAX_ATTEMPTS:
+                await dead_letter(producer, msg, e, attempt)
+                return
+            logger.warning(f"Error processing event, retrying: {str(e)}")
+            await asyncio.sleep(RETRY_DELAY * attempt)
+
 async def consume_events(db):
     consumer = AIOKafkaConsumer(
-        'post_views',
-        'post_likes',
-        'post_comments',
-        bootstrap_servers='kafka:9092',
-        group_id="stats-service-group",
+        *EVENT_TYPES,
+        bootstrap_servers=KAFKA_BOOTSTRAP_SERVERS,
+        group_id=CONSUMER_GROUP,
         auto_offset_reset='earliest',
         max_poll_interval_ms=300000,
         session_timeout_ms=10000,
         request_timeout_ms=15000
     )
-    
-    event_type_mapping = {
-        'post_views': 'view',
-        'post_likes': 'like',
-        'post_comments': 'comment'
-    }
+    producer = AIOKafkaProducer(bootstrap_servers=KAFKA_BOOTSTRAP_SERVERS)
+
     try:
         await consumer.start()
+        await producer.start()
         logger.info("Connected to Kafka")
         print("kafka started", file=sys.stderr)
         
         async for msg in consumer:
-            try:
-                event = json.loads(msg.value.decode())
-                event_type = event_type_mapping[msg.topic]
-                
-                await db.insert_event({
-                    'event_time': datetime.fromisoformat(event['timestamp']),
-                    'event_type': event_type,
-                    'post_id': event['post_id'],
-                    'user_id': event['user_id'],
-                    'content': event.get('content', '')
-                })
-                logger.debug(f"Processed event: {event['post_id']}")
-            except Exception as e:
-                logger.error(f"Error processing event: {str(e)}")
+            await handle_message(msg, db, producer)
     finally:
         await consumer.stop()
+        await producer.stop()
         logger.info("Kafka consumer stopped")
         os._exit(0)
    
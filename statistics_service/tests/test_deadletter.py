@@ -0,0 +1,28 @@
+from datetime import datetime, timezone
+from types import SimpleNamespace
+
+from deadletter import dead_letter_headers, dead_letter_topic
+
+
+def test_dead_letter_topic():
+    assert dead_letter_topic('post_likes') == 'post_likes.dlq'
+    assert dead_letter_topic('post_likes.dlq') == 'post_likes.dlq'
+
+
+def test_dead_letter_headers():
+    msg = SimpleNamespace(topic='post_likes', partition=2, offset=41,
+                          headers=[('traceparent', b'00-abc'), ('dlq.error', b'old')])
+
+    headers = dead_letter_headers(msg, KeyError('user_id'), 3, 'stats-service-group',
+                                  failed_at=datetime(2026, 3, 1, 15, 0, tzinfo=timezone.utc))
+
+    assert headers == [
+        ('traceparent', b'00-abc'),
+        ('dlq.error', b"'user_id'"),
+        ('dlq.attempts', b'3'),
+        ('dlq.original_topic', b'post_likes'),
+        ('dlq.original_partition', b'2'),
+        ('dlq.original_offset', b'41'),
+        ('dlq.failed_at', b'2026-03-01T15:00:00Z'),
+        ('dlq.consumer', b'stats-service-group'),
+    ]
@@ -17,6 +17,29 @@ async def test_get_post_stats():
     assert "COUNT(*) FILTER (WHERE event_type = 'view')" in sql
     assert mock_pool.fetchrow.call_args[0][1] == "post123"
 
+@pytest.mark.asyncio
+async def test_remove_event():
+    mock_pool = AsyncMock()
+    db = PostgresManager(mock_pool)
+
+    await db.remove_event({"post_id": "post123", "user_id": "user1", "event_type": "like"})
+
+    sql = mock_pool.execute.call_args[0][0]
+    assert "DELETE FROM events" in sql
+    assert "reaction IS NOT DISTINCT FROM $4" in sql
+    assert mock_pool.execute.call_args[0][1:] == ("post123", "user1", "like", None)
+
+@pytest.mark.asyncio
+async def test_get_reaction_trend():
+    mock_pool = AsyncMock()
+    db = PostgresManager(mock_pool)
+
+    await db.get_reaction_trend("post123", 7)
+
+    sql = mock_pool.fetch.call_args[0][0]
+    assert "GROUP BY DATE(event_time), reaction" in sql
+    assert mock_pool.fetch.call_args[0][1:] == ("post123", (datetime.now() - timedelta(days=7)).date())
+
 @pytest.mark.asyncio
 async def test_get_trend():
     mock_pool = AsyncMock()
@@ -54,6 +77,20 @@ async def test_get_top_users():
     assert "GROUP BY user_id" in sql
     assert mock_pool.fetch.call_args[0][1] == "comment"
 
+@pytest.mark.asyncio
+async def test_get_top_posts_period():
+    mock_pool = AsyncMock()
+    db = PostgresManager(mock_pool)
+
+    await db.get_top_posts(1, 7)
+
+    sql = mock_pool.fetch.call_args[0][0]
+    assert "event_time >= $2" in sql
+    assert mock_pool.fetch.call_args[0][2] == (datetime.now() - timedelta(days=7)).date()
+
+    await db.get_top_posts(1)
+    assert mock_pool.fetch.call_args[0][2] is None
+
 @pytest.mark.asyncio
 async def test_get_trend_all_time():
     mock_pool = AsyncMock()
@@ -1,8 +1,10 @@
 import pytest
+import json
 from unittest.mock import AsyncMock, MagicMock
 from grpc import StatusCode
 import datetime
-from stats_server import StatsService
+import stats_server
+from stats_server import StatsService, handle_message, parse_event
 from repository import PostgresManager
 from generated import statistics_pb2
 
@@ -97,6 +99,20 @@ async def test_get_top_posts_invalid_metric(stats_service, mock_db, mock_context
     mock_context.set_code.assert_called_with(StatusCode.INVALID_ARGUMENT)
     mock_context.set_details.assert_called_with("Invalid metric: 5")
 
+@pytest.mark.asyncio
+async def test_get_top_posts_period(stats_service, mock_db, mock_context):
+    mock_db.get_top_posts = AsyncMock(return_value=[])
+
+    await stats_service.GetTopPosts(statistics_pb2.TopRequest(metric=statistics_pb2.LIKES, period="7d"), mock_context)
+    mock_db.get_top_posts.assert_called_with(statistics_pb2.LIKES, 7)
+
+    await stats_service.GetTopPosts(statistics_pb2.TopRequest(metric=statistics_pb2.LIKES), mock_context)
+    mock_db.get_top_posts.assert_called_with(statistics_pb2.LIKES, None)
+
+    await stats_service.GetTopPosts(statistics_pb2.TopRequest(period="week"), mock_context)
+    mock_context.set_code.assert_called_with(StatusCode.INVALID_ARGUMENT)
+    mock_context.set_details.assert_called_with("Invalid period: week")
+
 @pytest.mark.asyncio
 async def test_get_top_users_success(stats_service, mock_db):
     test_data = [{"user_id": "u1", "count": 50}, {"user_id": "u2", "count": 30}]
@@ -117,4 +133,130 @@ async def test_get_top_users_error(stats_service, mock_db, mock_context):
     await stats_service.GetTopUsers(request, mock_context)
     
     mock_context.set_code.assert_called_with(StatusCode.INTERNAL)
-    mock_context.set_details.assert_called_with("Internal error: DB error")
\ No newline at end of file
+    mock_context.set_details.assert_called_with("Internal error: DB error")
+
+def test_parse_event_envelope():
+    event = parse_event(b'{"id": "e1", "type": "post.commented", "version": 1, "occurred_at": "2026-03-01T15:00:00+03:00", '
+                        b'"producer": "events_service", "payload": {"post_id": "p1", "user_id": "u1", "content": "hi"}}')
+
+    assert event == {
+        'type': 'post.commented',
+        'event_time': datetime.datetime(2026, 3, 1, 12, 0),
+        'post_id': 'p1',
+        'user_id': 'u1',
+        'content': 'hi',
+        'reaction': None,
+        'comment_id': None,
+    }
+
+def test_parse_event_legacy():
+    event = parse_event(b'{"user_id": "u1", "post_id": "p1", "timestamp": "2026-03-01T12:00:00", "content": null}')
+
+    assert event['type'] is None
+    assert event['event_time'] == datetime.datetime(2026, 3, 1, 12, 0)
+    assert event['post_id'] == 'p1'
+    assert event['content'] == ''
+
+def kafka_message(value, topic='post_likes'):
+    msg = MagicMock()
+    msg.topic = topic
+    msg.partition = 0
+    msg.offset = 7
+    msg.key = b'p1'
+    msg.value = value
+    msg.headers = []
+    return msg
+
+@pytest.mark.asyncio
+async def test_handle_message_inserts_event(mock_db):
+    mock_db.insert_event = AsyncMock()
+    producer = MagicMock()
+    producer.send_and_wait = AsyncMock()
+
+    await handle_message(kafka_message(b'{"user_id": "u1", "post_id": "p1", "timestamp": "2026-03-01T12:00:00"}'),
+                         mock_db, producer)
+
+    assert mock_db.insert_event.call_args[0][0]['event_type'] == 'like'
+    producer.send_and_wait.assert_not_called()
+
+@pytest.mark.asyncio
+async def test_handle_message_removes_like_on_unlike(mock_db):
+    mock_db.insert_event = AsyncMock()
+    mock_db.remove_event = AsyncMock()
+    producer = MagicMock()
+    producer.send_and_wait = AsyncMock()
+
+    await handle_message(kafka_message(b'{"id": "e2", "type": "post.unliked", "version": 1, "occurred_at": "2026-03-01T12:00:00Z", '
+                                       b'"producer": "events_service", "payload": {"post_id": "p1", "user_id": "u1"}}'),
+                         mock_db, producer)
+
+    assert mock_db.remove_event.call_args[0][0]['user_id'] == 'u1'
+    mock_db.insert_event.assert_not_called()
+    producer.send_and_wait.assert_not_called()
+
+@pytest.mark.asyncio
+async def test_handle_message_reactions(mock_db):
+    mock_db.insert_event = AsyncMock()
+    mock_db.remove_event = AsyncMock()
+    producer = MagicMock()
+    producer.send_and_wait = AsyncMock()
+
+    def reaction(event_type, **payload):
+        envelope = {"id": "e3", "type": event_type, "version": 1, "occurred_at": "2026-03-01T12:00:00Z",
+                    "producer": "events_service", "payload": dict({"post_id": "p1", "user_id": "u1"}, **payload)}
+        return kafka_message(json.dumps(envelope).encode(), topic='post_reactions')
+
+    await handle_message(reaction("reaction.added", reaction="❤️"), mock_db, producer)
+    await handle_message(reaction("reaction.removed", reaction="👍"), mock_db, producer)
+    await handle_message(reaction("reaction.added", reaction="😂", comment_id="c1"), mock_db, producer)
+
+    added = mock_db.insert_event.call_args[0][0]
+    assert (added['event_type'], added['reaction']) == ('reaction', '❤️')
+    removed = mock_db.remove_event.call_args[0][0]
+    assert (removed['event_type'], removed['reaction']) == ('reaction', '👍')
+    assert mock_db.insert_event.call_count == 1
+
+@pytest.mark.asyncio
+async def test_get_reactions_trend(stats_service, mock_db, mock_context):
+    mock_db.get_reaction_trend = AsyncMock(return_value=[
+        {'date': datetime.date(2026, 3, 1), 'reaction': '👍', 'count': 2},
+        {'date': datetime.date(2026, 3, 1), 'reaction': '❤️', 'count': 1},
+    ])
+
+    response = await stats_service.GetReactionsTrend(
+        statistics_pb2.PostTrendRequest(post_id='p1', period='7d'), mock_context
+    )
+
+    mock_db.get_reaction_trend.assert_called_once_with('p1', 7)
+    assert [(d.date, d.reaction, d.count) for d in response.data] == [('2026-03-01', '👍', 2), ('2026-03-01', '❤️', 1)]
+
+@pytest.mark.asyncio
+async def test_handle_message_dead_letters_malformed_event(mock_db):
+    mock_db.insert_event = AsyncMock()
+    producer = MagicMock()
+    producer.send_and_wait = AsyncMock()
+
+    await handle_message(kafka_message(b'not json'), mock_db, producer)
+
+    mock_db.insert_event.assert_not_called()
+    args, kwargs = producer.send_and_wait.call_args
+    assert args == ('post_likes.dlq', b'not json')
+    assert kwargs['key'] == b'p1'
+    headers = dict(kwargs['headers'])
+    assert headers['dlq.attempts'] == b'1'
+    assert headers['dlq.original_offset'] == b'7'
+
+@pytest.mark.asyncio
+async def test_handle_message_retries_before_dead_lettering(mock_db, monkeypatch):
+    monkeypatch.setattr(stats_server, 'RETRY_DELAY', 0)
+    mock_db.insert_event = AsyncMock(side_effect=Exception("connection refused"))
+    producer = MagicMock()
+    producer.send_and_wait = AsyncMock()
+
+    await handle_message(kafka_message(b'{"user_id": "u1", "post_id": "p1", "timestamp": "2026-03-01T12:00:00"}'),
+                         mock_db, producer)
+
+    assert mock_db.insert_event.call_count == 3
+    headers = dict(producer.send_and_wait.call_args[1]['headers'])
+    assert headers['dlq.attempts'] == b'3'
+    assert headers['dlq.error'] == b'connection refused'
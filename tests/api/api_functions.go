@@ -1,8 +1,11 @@
 package api
 
 import (
+	"bufio"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/nanoservices/tests/models"
 	"github.com/nanoservices/tests/utils"
@@ -71,3 +74,42 @@ func GetTopPosts(token, metric, period string) ([]models.TopPostItem, error) {
 	err := utils.SendRequest("GET", url, nil, http.StatusOK, &topPosts, token)
 	return topPosts, err
 }
+
+// WatchPostStats opens the live stats stream of a post. Updates are delivered
+// on the returned channel until stop is called.
+func WatchPostStats(token, postID string) (<-chan models.StatsResponse, func(), error) {
+	resp, err := utils.SendHTTPRequest("GET", utils.BaseURL+"/stats/posts/"+postID+"/live", nil, token)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, nil, fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+
+	updates := make(chan models.StatsResponse)
+	done := make(chan struct{})
+	go func() {
+		defer close(updates)
+		lines := bufio.NewScanner(resp.Body)
+		for lines.Scan() {
+			data, ok := strings.CutPrefix(lines.Text(), "data: ")
+			if !ok {
+				continue
+			}
+			var stats models.StatsResponse
+			if err := json.Unmarshal([]byte(data), &stats); err != nil {
+				continue
+			}
+			select {
+			case updates <- stats:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return updates, func() {
+		close(done)
+		resp.Body.Close()
+	}, nil
+}
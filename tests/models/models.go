@@ -82,8 +82,22 @@ type TopPostItem struct {
 	Count  int    `json:"count"`
 }
 
+// ErrorResponse covers both the gateway's problem+json errors and the plain
+// {"error": ...} bodies proxied from the users service.
 type ErrorResponse struct {
-	Error string `json:"error"`
+	Error  string `json:"error"`
+	Title  string `json:"title"`
+	Detail string `json:"detail"`
+}
+
+func (e ErrorResponse) Message() string {
+	switch {
+	case e.Error != "":
+		return e.Error
+	case e.Detail != "":
+		return e.Detail
+	}
+	return e.Title
 }
 
 type TokenResponse struct {
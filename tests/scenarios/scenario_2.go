@@ -49,11 +49,14 @@ func Scenario2(user models.User) {
 	randomPost := posts[rand.Intn(len(posts))]
 	fmt.Printf("Selected random post: ID=%s, Title=%s\n", randomPost.ID, randomPost.Title)
 
-	stats, err := api.GetPostStats(token, randomPost.ID)
+	updates, stop, err := api.WatchPostStats(token, randomPost.ID)
 	if err != nil {
-		fmt.Println("[ ] Get stats failed:", err)
+		fmt.Println("[ ] Watch stats failed:", err)
 		return
 	}
+	defer stop()
+
+	stats := <-updates
 	fmt.Printf("[*] Initial stats: Views=%d\n", stats.Views)
 
 	fmt.Println("[...] Simulating post view...")
@@ -63,16 +66,19 @@ func Scenario2(user models.User) {
 	}
 	fmt.Println("[*] Post viewed")
 
-	fmt.Println("[...] Waiting for stats update (2s)...")
-	time.Sleep(2 * time.Second)
-
-	updatedStats, err := api.GetPostStats(token, randomPost.ID)
-	if err != nil {
-		fmt.Println("[ ] Get updated stats failed:", err)
+	fmt.Println("[...] Waiting for live stats update...")
+	select {
+	case updatedStats, ok := <-updates:
+		if !ok {
+			fmt.Println("[ ] Live stats stream closed")
+			return
+		}
+		fmt.Printf("[*] Updated stats: Views=%d (delta: +%d)\n",
+			updatedStats.Views, updatedStats.Views-stats.Views)
+	case <-time.After(10 * time.Second):
+		fmt.Println("[ ] No stats update within 10s")
 		return
 	}
-	fmt.Printf("[*] Updated stats: Views=%d (delta: +%d)\n",
-		updatedStats.Views, updatedStats.Views-stats.Views)
 
 	fmt.Println("[...] Requesting views trend...")
 	trendItems, err := api.GetViewsTrend(token, randomPost.ID, "7d")
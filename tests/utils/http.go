@@ -10,10 +10,10 @@ import (
 	"github.com/nanoservices/tests/models"
 )
 
-const baseURL = "http://localhost:8080/api"
+const BaseURL = "http://localhost:8080/api"
 
 func SendRequest(method, endpoint string, data interface{}, expectedStatus int, result interface{}, token string) error {
-	url := baseURL + endpoint
+	url := BaseURL + endpoint
 	resp, err := SendHTTPRequest(method, url, data, token)
 	if err != nil {
 		return err
@@ -24,8 +24,8 @@ func SendRequest(method, endpoint string, data interface{}, expectedStatus int,
 
 	if resp.StatusCode != expectedStatus {
 		var errResp models.ErrorResponse
-		if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error != "" {
-			return fmt.Errorf("status %d: %s", resp.StatusCode, errResp.Error)
+		if err := json.Unmarshal(body, &errResp); err == nil && errResp.Message() != "" {
+			return fmt.Errorf("status %d: %s", resp.StatusCode, errResp.Message())
 		}
 		return fmt.Errorf("unexpected status: %d, response: %s", resp.StatusCode, string(body))
 	}
@@ -3,7 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -13,17 +13,40 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"github.com/nanoservices/pkg/health"
+	"github.com/nanoservices/pkg/logging"
+	"github.com/nanoservices/pkg/tracing"
 	"github.com/nanoservices/users_service/handlers"
+	"github.com/nanoservices/users_service/metrics"
 	authMiddleware "github.com/nanoservices/users_service/middleware"
 	"github.com/nanoservices/users_service/repository"
 )
 
 func main() {
+	if err := logging.Setup("users_service", os.Getenv("LOG_LEVEL")); err != nil {
+		slog.Error("Invalid LOG_LEVEL", "error", err)
+		os.Exit(1)
+	}
+
+	shutdownTracing, err := tracing.Init(context.Background(), "users_service")
+	if err != nil {
+		slog.Error("Failed to init tracing", "error", err)
+		os.Exit(1)
+	}
+	defer shutdownTracing(context.Background())
+
 	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
 
-	e.Use(middleware.Logger())
+	e.Use(authMiddleware.RequestID())
+	e.Use(authMiddleware.AccessLog())
 	e.Use(middleware.Recover())
+	e.Use(tracing.Middleware())
+	e.Use(metrics.Middleware())
 
 	dbHost := os.Getenv("DB_HOST")
 	dbPort := os.Getenv("DB_PORT")
@@ -34,45 +57,67 @@ func main() {
 	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable pool_max_conns=10",
 		dbHost, dbPort, dbUser, dbPassword, dbName)
 
-	pool, err := pgxpool.New(context.Background(), connStr)
+	poolConfig, err := pgxpool.ParseConfig(connStr)
 	if err != nil {
-		log.Fatalf("Unable to create connection pool: %v\n", err)
+		slog.Error("Unable to parse database config", "error", err)
+		os.Exit(1)
+	}
+	poolConfig.ConnConfig.Tracer = tracing.QueryTracer{}
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
+	if err != nil {
+		slog.Error("Unable to create connection pool", "error", err)
+		os.Exit(1)
 	}
 	defer pool.Close()
+	prometheus.MustRegister(metrics.NewPoolCollector(pool))
 
 	repo := repository.NewRepository(pool)
 	handlers := handlers.NewHandlers(repo, os.Getenv("JWT_SECRET"))
 
+	checker := health.NewChecker(2 * time.Second)
+	checker.Add("postgres", pool.Ping)
+
+	e.GET("/healthz", checker.Liveness)
+	e.GET("/readyz", checker.Readiness)
+	e.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
 	e.POST("/api/register", handlers.Register)
 	e.POST("/api/login", handlers.Login)
 	api := e.Group("")
 	api.Use(authMiddleware.JWTAuth(os.Getenv("JWT_SECRET")))
 	api.GET("/api/profile", handlers.Profile)
 	api.POST("/api/profile", handlers.UpdateProfile)
+	api.GET("/api/profiles", handlers.PublicProfiles)
+	internal := e.Group("/internal")
+	internal.Use(authMiddleware.ServiceAuth(os.Getenv("INTERNAL_API_TOKEN")))
+	internal.GET("/profiles", handlers.PublicProfiles)
 
 	s := &http.Server{
 		Addr: ":8081",
 	}
 
 	go func() {
+		slog.Info("Starting server", "addr", s.Addr)
 		if err := e.StartServer(s); err != nil {
-			e.Logger.Info("Shutting down the server")
+			slog.Info("Shutting down the server", "reason", err)
 		}
 	}()
 
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
+	checker.Shutdown()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	if err := e.Shutdown(ctx); err != nil {
-		e.Logger.Fatal("HTTP server shutdown error:", err)
+		slog.Error("HTTP server shutdown error", "error", err)
+		os.Exit(1)
 	}
 
 	select {
 	case <-ctx.Done():
-		log.Printf("timeout of 5 seconds.\n")
+		slog.Info("timeout of 5 seconds.")
 	}
 }
@@ -2,13 +2,16 @@ package handlers
 
 import (
 	"errors"
-	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
 	"github.com/jackc/pgx"
 	"github.com/labstack/echo/v4"
+	"github.com/nanoservices/pkg/logging"
+	"github.com/nanoservices/users_service/metrics"
 	"github.com/nanoservices/users_service/models"
 	"github.com/nanoservices/users_service/repository"
 	"golang.org/x/crypto/bcrypt"
@@ -24,9 +27,13 @@ func NewHandlers(repo repository.RepositoryInt, secret string) *UserHandler {
 }
 
 func (h *UserHandler) Register(c echo.Context) error {
+	ctx := c.Request().Context()
+	logger := logging.For("handlers")
+
 	var input models.Register
 	if err := c.Bind(&input); err != nil {
-		log.Println("Invalid input")
+		logger.WarnContext(ctx, "Invalid input", "error", err)
+		metrics.Registrations.WithLabelValues("invalid_input").Inc()
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid input"})
 	}
 
@@ -34,56 +41,71 @@ func (h *UserHandler) Register(c echo.Context) error {
 	if err != nil {
 		roleID.ID, err = h.repo.CreateRole(c.Request().Context(), "user", "Default user role")
 		if err != nil {
-			log.Println("Failed to create role")
+			logger.ErrorContext(ctx, "Failed to create role", "error", err)
+			metrics.Registrations.WithLabelValues("failure").Inc()
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create role"})
 		}
 	}
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Username+input.Password), bcrypt.DefaultCost)
 	if err != nil {
-		log.Println("Failed to create user", err)
+		logger.ErrorContext(ctx, "Failed to create user", "error", err)
+		metrics.Registrations.WithLabelValues("failure").Inc()
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create user"})
 	}
 
 	userID, err := h.repo.CreateUser(c.Request().Context(), input.Username, string(hashedPassword), roleID.ID)
 	if err != nil {
-		log.Println("Failed to create user", err)
+		logger.ErrorContext(ctx, "Failed to create user", "error", err)
+		metrics.Registrations.WithLabelValues("failure").Inc()
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create user"})
 	}
 
 	_, err = h.repo.CreateProfile(c.Request().Context(), userID, "", "", input.Email, "", "", "")
 	if err != nil {
-		log.Println("Failed to create profile")
+		logger.ErrorContext(ctx, "Failed to create profile", "error", err)
+		metrics.Registrations.WithLabelValues("failure").Inc()
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create profile"})
 	}
 
+	metrics.Registrations.WithLabelValues("success").Inc()
 	return c.JSON(http.StatusCreated, map[string]string{"message": "User registered successfully", "id": userID})
 }
 
 func (h *UserHandler) Login(c echo.Context) error {
 	var input models.Login
 	if err := c.Bind(&input); err != nil {
+		loginFailed("invalid_input")
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid input"})
 	}
 
 	user, err := h.repo.GetUserByUsername(c.Request().Context(), input.Username)
 	if err != nil {
+		loginFailed("unknown_user")
 		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid username"})
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(input.Username+input.Password)); err != nil {
+		loginFailed("wrong_password")
 		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid password"})
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": user.ID})
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": user.ID, "role": user.Role})
 	tokenString, err := token.SignedString([]byte(h.secret))
 	if err != nil {
+		loginFailed("token_error")
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "generating token error"})
 	}
 
+	metrics.Logins.WithLabelValues("success").Inc()
 	return c.JSON(http.StatusOK, map[string]string{"message": "Authentication successful", "Token": tokenString})
 }
 
+func loginFailed(reason string) {
+	metrics.Logins.WithLabelValues("failure").Inc()
+	metrics.FailedLogins.WithLabelValues(reason).Inc()
+}
+
 func (h *UserHandler) Profile(c echo.Context) error {
 	userId := c.Get("user_id").(string)
 
@@ -98,6 +120,66 @@ func (h *UserHandler) Profile(c echo.Context) error {
 	return c.JSON(http.StatusOK, profile)
 }
 
+const maxProfileBatch = 100
+
+// PublicProfiles returns the public profiles of the comma separated user IDs
+// in the ids query parameter, or of the usernames in usernames. Unknown users
+// are omitted from the result.
+func (h *UserHandler) PublicProfiles(c echo.Context) error {
+	ids, usernames := splitList(c.QueryParam("ids")), splitList(c.QueryParam("usernames"))
+	keys := ids
+	switch {
+	case len(ids) > 0 && len(usernames) > 0:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Pass either ids or usernames"})
+	case len(usernames) > 0:
+		keys = usernames
+	case len(ids) == 0:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "ids or usernames is required"})
+	}
+	for _, id := range ids {
+		if _, err := uuid.Parse(id); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid user ID: " + id})
+		}
+	}
+	if len(keys) > maxProfileBatch {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Too many users"})
+	}
+
+	var (
+		profiles []models.PublicProfile
+		err      error
+	)
+	if len(ids) > 0 {
+		profiles, err = h.repo.GetPublicProfiles(c.Request().Context(), ids)
+	} else {
+		profiles, err = h.repo.GetPublicProfilesByUsername(c.Request().Context(), usernames)
+	}
+	if err != nil {
+		logging.For("handlers").ErrorContext(c.Request().Context(), "Failed to fetch profiles", "error", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch profiles"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{"profiles": profiles})
+}
+
+// splitList returns the distinct non-empty items of a comma separated list.
+func splitList(list string) []string {
+	var items []string
+	seen := map[string]struct{}{}
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if _, ok := seen[item]; ok {
+			continue
+		}
+		seen[item] = struct{}{}
+		items = append(items, item)
+	}
+	return items
+}
+
 func (h *UserHandler) UpdateProfile(c echo.Context) error {
 	var input models.UpdateProfile
 	if err := c.Bind(&input); err != nil {
@@ -1,17 +1,22 @@
 package handlers
 
 import (
+	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt"
 	"github.com/jackc/pgx"
 	"github.com/labstack/echo/v4"
+	"github.com/nanoservices/users_service/metrics"
 	"github.com/nanoservices/users_service/mocks"
 	"github.com/nanoservices/users_service/models"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"golang.org/x/crypto/bcrypt"
@@ -134,6 +139,29 @@ func TestLogin(t *testing.T) {
 		assert.Contains(t, rec.Body.String(), "Authentication successful")
 	})
 
+	t.Run("Token carries the role", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"username":"john_doe","password":"password123"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+
+		c := e.NewContext(req, rec)
+		passwordHash, _ := bcrypt.GenerateFromPassword([]byte("john_doe"+"password123"), bcrypt.DefaultCost)
+		repoMock.On("GetUserByUsername", mock.Anything, "john_doe").
+			Return(models.User{ID: "user-id-123", Role: "moderator", PasswordHash: string(passwordHash)}, nil).Once()
+
+		_ = handler.Login(c)
+
+		var body map[string]string
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		claims := jwt.MapClaims{}
+		_, err := jwt.ParseWithClaims(body["Token"], claims, func(*jwt.Token) (interface{}, error) {
+			return []byte("secret"), nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "moderator", claims["role"])
+	})
+
 	t.Run("Invalid username", func(t *testing.T) {
 		e := echo.New()
 		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"username":"john_doe","password":"password123"}`))
@@ -143,11 +171,13 @@ func TestLogin(t *testing.T) {
 		c := e.NewContext(req, rec)
 		repoMock.On("GetUserByUsername", mock.Anything, "john_doe").
 			Return(models.User{}, pgx.ErrNoRows).Once()
+		failedBefore := testutil.ToFloat64(metrics.FailedLogins.WithLabelValues("unknown_user"))
 
 		_ = handler.Login(c)
 
 		assert.Equal(t, http.StatusUnauthorized, rec.Code)
 		assert.Contains(t, rec.Body.String(), "Invalid username")
+		assert.Equal(t, failedBefore+1, testutil.ToFloat64(metrics.FailedLogins.WithLabelValues("unknown_user")))
 	})
 
 	t.Run("Invalid password", func(t *testing.T) {
@@ -325,3 +355,111 @@ func TestUpdateProfile(t *testing.T) {
 		assert.Contains(t, rec.Body.String(), "Failed to update profile")
 	})
 }
+
+func TestPublicProfiles(t *testing.T) {
+	repoMock := new(mocks.MockRepository)
+	handler := NewHandlers(repoMock, "secret")
+
+	const (
+		john = "6f1c2a9e-4b1d-4c8e-9a57-0d3f2b7e8c11"
+		jane = "a2d4e6f8-1b3c-4d5e-8f70-9a1b2c3d4e5f"
+	)
+
+	t.Run("Successful profiles retrieval", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/api/profiles?ids="+john+","+jane+","+john, nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		repoMock.On("GetPublicProfiles", mock.Anything, []string{john, jane}).
+			Return([]models.PublicProfile{{UserID: john, Username: "john_doe", FirstName: "John"}}, nil).Once()
+
+		_ = handler.PublicProfiles(c)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), "john_doe")
+		assert.NotContains(t, rec.Body.String(), "email")
+	})
+
+	t.Run("Successful profiles retrieval by username", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/api/profiles?usernames=john_doe,ghost,john_doe", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		repoMock.On("GetPublicProfilesByUsername", mock.Anything, []string{"john_doe", "ghost"}).
+			Return([]models.PublicProfile{{UserID: john, Username: "john_doe"}}, nil).Once()
+
+		_ = handler.PublicProfiles(c)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), john)
+	})
+
+	t.Run("Both ids and usernames", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/api/profiles?ids="+john+"&usernames=john_doe", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		_ = handler.PublicProfiles(c)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "either ids or usernames")
+	})
+
+	t.Run("Too many usernames", func(t *testing.T) {
+		e := echo.New()
+		names := make([]string, maxProfileBatch+1)
+		for i := range names {
+			names[i] = "user" + strconv.Itoa(i)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/api/profiles?usernames="+strings.Join(names, ","), nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		_ = handler.PublicProfiles(c)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "Too many users")
+	})
+
+	t.Run("Missing ids", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/api/profiles", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		_ = handler.PublicProfiles(c)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "ids or usernames is required")
+	})
+
+	t.Run("Invalid id", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/api/profiles?ids="+john+",not-a-uuid", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		_ = handler.PublicProfiles(c)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "Invalid user ID")
+	})
+
+	t.Run("Get profiles error", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/api/profiles?ids="+john, nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		repoMock.On("GetPublicProfiles", mock.Anything, []string{john}).
+			Return([]models.PublicProfile(nil), errors.New("db down")).Once()
+
+		_ = handler.PublicProfiles(c)
+
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.Contains(t, rec.Body.String(), "Failed to fetch profiles")
+	})
+}
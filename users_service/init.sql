@@ -29,3 +29,9 @@ CREATE TABLE IF NOT EXISTS user_profiles (
 );
 
 CREATE INDEX IF NOT EXISTS idx_users_username ON users (username);
+
+-- Moderators are appointed by switching role_id of the user to this role.
+INSERT INTO roles (name, description) VALUES
+    ('user', 'Default user role'),
+    ('moderator', 'Reviews reports and moderates content')
+ON CONFLICT (name) DO NOTHING;
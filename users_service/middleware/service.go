@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ServiceAuth admits other services of the deployment presenting token as a
+// bearer token. User tokens are not accepted, and with an empty token every
+// request is rejected.
+func ServiceAuth(token string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			got, ok := strings.CutPrefix(c.Request().Header.Get("Authorization"), "Bearer ")
+			if token == "" || !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				return c.JSON(401, map[string]string{"error": "invalid service token"})
+			}
+			return next(c)
+		}
+	}
+}
@@ -44,3 +44,41 @@ func (m *DBMock) Exec(ctx context.Context, sql string, args ...any) (pgconn.Comm
 	mockArgs := m.Called(ctx, sql, args)
 	return mockArgs.Get(0).(pgconn.CommandTag), mockArgs.Error(1)
 }
+
+type PgxRowsMock struct {
+	mock.Mock
+}
+
+func (r *PgxRowsMock) Close() {}
+
+func (r *PgxRowsMock) Err() error {
+	return r.Called().Error(0)
+}
+
+func (r *PgxRowsMock) CommandTag() pgconn.CommandTag {
+	return pgconn.CommandTag{}
+}
+
+func (r *PgxRowsMock) FieldDescriptions() []pgconn.FieldDescription {
+	return nil
+}
+
+func (r *PgxRowsMock) Next() bool {
+	return r.Called().Bool(0)
+}
+
+func (r *PgxRowsMock) Scan(dest ...any) error {
+	return r.Called(dest...).Error(0)
+}
+
+func (r *PgxRowsMock) Values() ([]any, error) {
+	return nil, nil
+}
+
+func (r *PgxRowsMock) RawValues() [][]byte {
+	return nil
+}
+
+func (r *PgxRowsMock) Conn() *pgx.Conn {
+	return nil
+}
@@ -45,3 +45,13 @@ func (m *MockRepository) UpdateProfile(ctx context.Context, userID, firstName, l
 	args := m.Called(ctx, userID, firstName, lastName, email, phoneNumber, bio, birthdate)
 	return args.Error(0)
 }
+
+func (m *MockRepository) GetPublicProfiles(ctx context.Context, userIDs []string) ([]models.PublicProfile, error) {
+	args := m.Called(ctx, userIDs)
+	return args.Get(0).([]models.PublicProfile), args.Error(1)
+}
+
+func (m *MockRepository) GetPublicProfilesByUsername(ctx context.Context, usernames []string) ([]models.PublicProfile, error) {
+	args := m.Called(ctx, usernames)
+	return args.Get(0).([]models.PublicProfile), args.Error(1)
+}
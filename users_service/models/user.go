@@ -15,6 +15,7 @@ type Role struct {
 type User struct {
 	ID           string    `json:"id"`
 	RoleID       string    `json:"role_id"`
+	Role         string    `json:"role"`
 	Username     string    `json:"username"`
 	PasswordHash string    `json:"-"`
 	CreatedAt    time.Time `json:"created_at"`
@@ -32,3 +33,12 @@ type UserProfile struct {
 	Bio         string    `json:"bio"`
 	CreatedAt   time.Time `json:"created_at"`
 }
+
+// PublicProfile is the part of a profile that other users may see.
+type PublicProfile struct {
+	UserID    string `json:"user_id"`
+	Username  string `json:"username"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Bio       string `json:"bio"`
+}
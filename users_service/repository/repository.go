@@ -17,6 +17,8 @@ type RepositoryInt interface {
 	CreateProfile(ctx context.Context, userID, firstName, lastName, email, birthdate, phoneNumber, bio string) (string, error)
 	GetProfileByUserID(ctx context.Context, userID string) (models.UserProfile, error)
 	UpdateProfile(ctx context.Context, userID, firstName, lastName, email, phoneNumber, bio, birthdate string) error
+	GetPublicProfiles(ctx context.Context, userIDs []string) ([]models.PublicProfile, error)
+	GetPublicProfilesByUsername(ctx context.Context, usernames []string) ([]models.PublicProfile, error)
 }
 
 type Repository struct {
@@ -70,13 +72,14 @@ func (r *Repository) CreateUser(ctx context.Context, username, passwordHash, rol
 
 func (r *Repository) GetUserByUsername(ctx context.Context, username string) (models.User, error) {
 	query := `
-		SELECT id, role_id, username, password_hash, created_at, updated_at 
-		FROM users 
-		WHERE username = $1`
+		SELECT u.id, u.role_id, COALESCE(r.name, ''), u.username, u.password_hash, u.created_at, u.updated_at
+		FROM users u
+		LEFT JOIN roles r ON r.id = u.role_id
+		WHERE u.username = $1`
 	row := r.pool.QueryRow(ctx, query, username)
 
 	var user models.User
-	err := row.Scan(&user.ID, &user.RoleID, &user.Username, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt)
+	err := row.Scan(&user.ID, &user.RoleID, &user.Role, &user.Username, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		return models.User{}, err
 	}
@@ -130,3 +133,34 @@ func (r *Repository) UpdateProfile(ctx context.Context, userID, firstName, lastN
 	_, err := r.pool.Exec(context.Background(), query, firstName, lastName, email, birthdate, phoneNumber, bio, userID)
 	return err
 }
+
+func (r *Repository) GetPublicProfiles(ctx context.Context, userIDs []string) ([]models.PublicProfile, error) {
+	return r.publicProfiles(ctx, "u.id = ANY($1::uuid[])", userIDs)
+}
+
+func (r *Repository) GetPublicProfilesByUsername(ctx context.Context, usernames []string) ([]models.PublicProfile, error) {
+	return r.publicProfiles(ctx, "u.username = ANY($1::text[])", usernames)
+}
+
+func (r *Repository) publicProfiles(ctx context.Context, where string, keys []string) ([]models.PublicProfile, error) {
+	query := `
+		SELECT u.id, u.username, COALESCE(p.first_name, ''), COALESCE(p.last_name, ''), COALESCE(p.bio, '')
+		FROM users u
+		LEFT JOIN user_profiles p ON p.user_id = u.id
+		WHERE ` + where
+	rows, err := r.pool.Query(ctx, query, keys)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	profiles := make([]models.PublicProfile, 0, len(keys))
+	for rows.Next() {
+		var profile models.PublicProfile
+		if err := rows.Scan(&profile.UserID, &profile.Username, &profile.FirstName, &profile.LastName, &profile.Bio); err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, profile)
+	}
+	return profiles, rows.Err()
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"strings"
 	"testing"
 	"time"
 
@@ -132,20 +133,22 @@ func TestGetUserByUsername(t *testing.T) {
 		dbMock.On("QueryRow", mock.Anything, mock.Anything, mock.Anything).
 			Return(rowMock).Once()
 
-		rowMock.On("Scan", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		rowMock.On("Scan", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
 			Run(func(args mock.Arguments) {
 				*args[0].(*string) = "user-id-123"
 				*args[1].(*string) = "role-id-123"
-				*args[2].(*string) = "john_doe"
-				*args[3].(*string) = "hashed-password"
-				*args[4].(*time.Time) = time.Now()
+				*args[2].(*string) = "moderator"
+				*args[3].(*string) = "john_doe"
+				*args[4].(*string) = "hashed-password"
 				*args[5].(*time.Time) = time.Now()
+				*args[6].(*time.Time) = time.Now()
 			}).Return(nil).Once()
 
 		user, err := repo.GetUserByUsername(ctx, "john_doe")
 
 		assert.NoError(t, err)
 		assert.Equal(t, "user-id-123", user.ID)
+		assert.Equal(t, "moderator", user.Role)
 		assert.Equal(t, "john_doe", user.Username)
 	})
 
@@ -153,7 +156,7 @@ func TestGetUserByUsername(t *testing.T) {
 		dbMock.On("QueryRow", mock.Anything, mock.Anything, mock.Anything).
 			Return(rowMock).Once()
 
-		rowMock.On("Scan", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		rowMock.On("Scan", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
 			Return(assert.AnError).Once()
 
 		user, err := repo.GetUserByUsername(ctx, "john_doe")
@@ -265,3 +268,89 @@ func TestUpdateProfile(t *testing.T) {
 		assert.Error(t, err)
 	})
 }
+
+func TestGetPublicProfiles(t *testing.T) {
+	dbMock := new(mocks.DBMock)
+	repo := NewRepository(dbMock)
+	ctx := context.Background()
+
+	t.Run("Successful profiles retrieval", func(t *testing.T) {
+		rowsMock := new(mocks.PgxRowsMock)
+		dbMock.On("Query", mock.Anything, mock.Anything, mock.Anything).
+			Return(rowsMock, nil).Once()
+
+		rowsMock.On("Next").Return(true).Once()
+		rowsMock.On("Scan", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+			Run(func(args mock.Arguments) {
+				*args[0].(*string) = "user-id-123"
+				*args[1].(*string) = "john_doe"
+				*args[2].(*string) = "John"
+				*args[3].(*string) = "Doe"
+				*args[4].(*string) = "Bio text"
+			}).Return(nil).Once()
+		rowsMock.On("Next").Return(false).Once()
+		rowsMock.On("Err").Return(nil).Once()
+
+		profiles, err := repo.GetPublicProfiles(ctx, []string{"user-id-123", "user-id-456"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []models.PublicProfile{{
+			UserID:    "user-id-123",
+			Username:  "john_doe",
+			FirstName: "John",
+			LastName:  "Doe",
+			Bio:       "Bio text",
+		}}, profiles)
+	})
+
+	t.Run("Error during query", func(t *testing.T) {
+		dbMock.On("Query", mock.Anything, mock.Anything, mock.Anything).
+			Return((*mocks.PgxRowsMock)(nil), assert.AnError).Once()
+
+		profiles, err := repo.GetPublicProfiles(ctx, []string{"user-id-123"})
+
+		assert.Error(t, err)
+		assert.Nil(t, profiles)
+	})
+
+	t.Run("Error during scan", func(t *testing.T) {
+		rowsMock := new(mocks.PgxRowsMock)
+		dbMock.On("Query", mock.Anything, mock.Anything, mock.Anything).
+			Return(rowsMock, nil).Once()
+
+		rowsMock.On("Next").Return(true).Once()
+		rowsMock.On("Scan", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+			Return(assert.AnError).Once()
+
+		profiles, err := repo.GetPublicProfiles(ctx, []string{"user-id-123"})
+
+		assert.Error(t, err)
+		assert.Nil(t, profiles)
+	})
+}
+
+func TestGetPublicProfilesByUsername(t *testing.T) {
+	dbMock := new(mocks.DBMock)
+	repo := NewRepository(dbMock)
+	ctx := context.Background()
+
+	rowsMock := new(mocks.PgxRowsMock)
+	dbMock.On("Query", mock.Anything, mock.MatchedBy(func(query string) bool {
+		return strings.Contains(query, "u.username = ANY($1::text[])")
+	}), mock.Anything).Return(rowsMock, nil).Once()
+
+	rowsMock.On("Next").Return(true).Once()
+	rowsMock.On("Scan", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			*args[0].(*string) = "user-id-123"
+			*args[1].(*string) = "john_doe"
+		}).Return(nil).Once()
+	rowsMock.On("Next").Return(false).Once()
+	rowsMock.On("Err").Return(nil).Once()
+
+	profiles, err := repo.GetPublicProfilesByUsername(ctx, []string{"john_doe", "ghost"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []models.PublicProfile{{UserID: "user-id-123", Username: "john_doe"}}, profiles)
+	dbMock.AssertExpectations(t)
+}